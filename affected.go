@@ -0,0 +1,244 @@
+package modules
+
+import (
+	"path/filepath"
+	"sort"
+
+	"github.com/bobg/errors"
+	"golang.org/x/tools/go/packages"
+)
+
+// AffectedPackages loads the packages in the Go modules in dir and its subdirectories
+// that are affected by changes to the given files.
+// The result maps module directories to the packages loaded from them.
+// This function calls Walker.AffectedPackages with a default Walker.
+func AffectedPackages(dir string, changedFiles []string) (map[string][]*packages.Package, error) {
+	var w Walker
+	return w.AffectedPackages(dir, changedFiles)
+}
+
+// AffectedPackages loads the packages in the Go modules in dir and its subdirectories
+// that are affected by changes to the given files.
+// The result maps module directories
+// (each of which will have dir as a prefix)
+// to the packages loaded from them.
+// Modules with no affected packages are absent from the result.
+//
+// Relative paths in changedFiles are interpreted relative to dir.
+// Each changed file is mapped to the innermost module containing it,
+// and then to the package in the nearest enclosing directory.
+// A change to a module's go.mod or go.sum file affects every package in the module.
+// Files outside any module are ignored.
+//
+// The affected packages are those containing changed files,
+// plus every package in the tree that imports one of those,
+// directly or indirectly.
+// This is determined from an [ImportGraph],
+// which requires only a cheap metadata-only load of the tree;
+// only the affected packages are then fully loaded,
+// as with [Walker.LoadEach].
+func (w *Walker) AffectedPackages(dir string, changedFiles []string) (map[string][]*packages.Package, error) {
+	g, err := w.BuildImportGraph(dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "building import graph")
+	}
+
+	absModuleDirs, err := w.absModuleDirs(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		byDir    = make(map[string][]*ImportNode) // package dir -> nodes
+		byModule = make(map[string][]*ImportNode) // module dir -> nodes
+	)
+	for _, n := range g.Nodes {
+		if n.Dir != "" {
+			byDir[n.Dir] = append(byDir[n.Dir], n)
+		}
+		byModule[n.ModuleDir] = append(byModule[n.ModuleDir], n)
+	}
+
+	var (
+		affected = make(map[string]*ImportNode)
+		queue    []*ImportNode
+	)
+	add := func(n *ImportNode) {
+		if _, ok := affected[n.PkgPath]; ok {
+			return
+		}
+		affected[n.PkgPath] = n
+		queue = append(queue, n)
+	}
+
+	for _, file := range changedFiles {
+		if !filepath.IsAbs(file) {
+			file = filepath.Join(dir, file)
+		}
+		file, err = filepath.Abs(file)
+		if err != nil {
+			return nil, errors.Wrap(err, "getting absolute path")
+		}
+
+		absModuleDir, ok := containingModule(file, absModuleDirs)
+		if !ok {
+			continue
+		}
+		moduleDir := absModuleDirs[absModuleDir]
+
+		if base := filepath.Base(file); filepath.Dir(file) == absModuleDir && (base == "go.mod" || base == "go.sum") {
+			for _, n := range byModule[moduleDir] {
+				add(n)
+			}
+			continue
+		}
+
+		for d := filepath.Dir(file); ; d = filepath.Dir(d) {
+			var found bool
+			for _, n := range byDir[d] {
+				if n.ModuleDir == moduleDir {
+					add(n)
+					found = true
+				}
+			}
+			if found || d == absModuleDir {
+				break
+			}
+		}
+	}
+
+	for len(queue) > 0 {
+		n := queue[0]
+		queue = queue[1:]
+		for _, importer := range n.ImportedBy {
+			add(importer)
+		}
+	}
+
+	patterns := make(map[string][]string) // module dir -> package paths
+	for _, n := range affected {
+		patterns[n.ModuleDir] = append(patterns[n.ModuleDir], n.PkgPath)
+	}
+
+	w2 := *w
+	w2.PatternsFor = func(moduleDir string) []string {
+		result := patterns[moduleDir]
+		sort.Strings(result)
+		return result
+	}
+
+	result := make(map[string][]*packages.Package)
+	err = w.Each(dir, func(moduleDir string) error {
+		if len(patterns[moduleDir]) == 0 {
+			return nil
+		}
+		pkgs, err := w2.load(moduleDir, 0)
+		if err != nil {
+			return err
+		}
+		result[moduleDir] = pkgs
+		return nil
+	})
+
+	return result, err
+}
+
+// containingModule finds the innermost module containing the file or directory at path,
+// given the absolute directories of the modules in a tree.
+// Both path and the result are absolute.
+func containingModule(path string, absModuleDirs map[string]string) (string, bool) {
+	for d := path; ; {
+		if _, ok := absModuleDirs[d]; ok {
+			return d, true
+		}
+		parent := filepath.Dir(d)
+		if parent == d {
+			return "", false
+		}
+		d = parent
+	}
+}
+
+// AffectedModules reports the Go modules in dir and its subdirectories
+// that are affected by changes to the given files.
+// This function calls Walker.AffectedModules with a default Walker.
+func AffectedModules(dir string, changedFiles []string) ([]string, error) {
+	var w Walker
+	return w.AffectedModules(dir, changedFiles)
+}
+
+// AffectedModules reports the Go modules in dir and its subdirectories
+// that are affected by changes to the given files.
+// The result is a list of module directories
+// (each of which will have dir as a prefix)
+// in the order [Walker.Each] visits them.
+//
+// Relative paths in changedFiles are interpreted relative to dir.
+// Each changed file is attributed to the innermost module containing it,
+// and files outside any module are ignored.
+// The affected modules are those containing changed files,
+// plus every module in the tree that depends on one of those,
+// directly or indirectly,
+// according to [Walker.BuildModuleGraph].
+//
+// This is coarser than [Walker.AffectedPackages],
+// but needs no package loading
+// (unless w.GraphImports is set).
+// Combine it with [Walker.ChangedModules] to find the modules affected by a git change.
+func (w *Walker) AffectedModules(dir string, changedFiles []string) ([]string, error) {
+	g, err := w.BuildModuleGraph(dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "building module graph")
+	}
+
+	absModuleDirs, err := w.absModuleDirs(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byDir := make(map[string]*ModuleNode)
+	for _, node := range g.Nodes {
+		byDir[node.Dir] = node
+	}
+
+	var (
+		affected = make(map[*ModuleNode]bool)
+		queue    []*ModuleNode
+	)
+	add := func(node *ModuleNode) {
+		if node == nil || affected[node] {
+			return
+		}
+		affected[node] = true
+		queue = append(queue, node)
+	}
+
+	for _, file := range changedFiles {
+		if !filepath.IsAbs(file) {
+			file = filepath.Join(dir, file)
+		}
+		file, err = filepath.Abs(file)
+		if err != nil {
+			return nil, errors.Wrap(err, "getting absolute path")
+		}
+		if absModuleDir, ok := containingModule(file, absModuleDirs); ok {
+			add(byDir[absModuleDirs[absModuleDir]])
+		}
+	}
+
+	for len(queue) > 0 {
+		node := queue[0]
+		queue = queue[1:]
+		for _, dependent := range node.Dependents {
+			add(dependent)
+		}
+	}
+
+	var result []string
+	for _, node := range g.Nodes {
+		if affected[node] {
+			result = append(result, node.Dir)
+		}
+	}
+	return result, nil
+}
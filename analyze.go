@@ -0,0 +1,262 @@
+package modules
+
+import (
+	"fmt"
+	"go/token"
+	"go/types"
+	"reflect"
+	"sort"
+
+	"github.com/bobg/errors"
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/packages"
+)
+
+// AnalysisDiagnostic is a diagnostic reported by an analyzer run with [Walker.AnalyzeEach].
+type AnalysisDiagnostic struct {
+	analysis.Diagnostic
+
+	// Analyzer is the analyzer that reported the diagnostic.
+	Analyzer *analysis.Analyzer
+
+	// PkgPath is the import path of the package being analyzed.
+	PkgPath string
+
+	// Position is the position of the diagnostic,
+	// i.e. of Diagnostic.Pos.
+	Position token.Position
+}
+
+// analysisLoadMode is what analyzers need loaded.
+// Dependencies outside the module get their types from export data.
+const analysisLoadMode = packages.NeedName | packages.NeedFiles | packages.NeedCompiledGoFiles | packages.NeedImports | packages.NeedTypes | packages.NeedTypesSizes | packages.NeedSyntax | packages.NeedTypesInfo | packages.NeedModule
+
+// AnalyzeEach runs the given analyzers on the packages of each Go module in dir and its subdirectories.
+// This function calls Walker.AnalyzeEach with a default Walker.
+func AnalyzeEach(dir string, analyzers []*analysis.Analyzer, f func(string, []AnalysisDiagnostic) error) error {
+	var w Walker
+	return w.AnalyzeEach(dir, analyzers, f)
+}
+
+// AnalyzeEach runs the given analyzers on the packages of each Go module in dir and its subdirectories.
+// The callback receives the module's directory
+// (which will have dir as a prefix)
+// and the diagnostics reported in its packages,
+// sorted by position.
+//
+// Packages are loaded as with [Walker.LoadEach],
+// except that the load mode is whatever the analyzers need.
+// The analyzers
+// (and the analyzers they require)
+// are run on each loaded package,
+// with a package's imports analyzed before the package itself,
+// so facts flow from one package to another within a module.
+// Packages outside the module are not analyzed,
+// so analyzers find no facts about them.
+// As with other analysis drivers,
+// an analyzer is not run on a package with errors
+// unless its RunDespiteErrors field is true.
+func (w *Walker) AnalyzeEach(dir string, analyzers []*analysis.Analyzer, f func(string, []AnalysisDiagnostic) error) error {
+	if err := analysis.Validate(analyzers); err != nil {
+		return errors.Wrap(err, "validating analyzers")
+	}
+	return w.withLoadMode(analysisLoadMode).LoadEach(dir, func(subdir string, pkgs []*packages.Package) error {
+		diags, err := runAnalyzers(analyzers, pkgs)
+		if err != nil {
+			return errors.Wrapf(err, "analyzing %s", subdir)
+		}
+		return f(subdir, diags)
+	})
+}
+
+// analysisRun is the state of running analyzers on the packages of one module.
+type analysisRun struct {
+	results  map[analysisKey]*analysisResult
+	objFacts map[objectFactKey]analysis.Fact
+	pkgFacts map[packageFactKey]analysis.Fact
+	diags    []AnalysisDiagnostic
+}
+
+type analysisKey struct {
+	a   *analysis.Analyzer
+	pkg *packages.Package
+}
+
+type analysisResult struct {
+	result  any
+	skipped bool
+	err     error
+}
+
+type objectFactKey struct {
+	obj types.Object
+	t   reflect.Type
+}
+
+type packageFactKey struct {
+	pkg *types.Package
+	t   reflect.Type
+}
+
+func runAnalyzers(analyzers []*analysis.Analyzer, pkgs []*packages.Package) ([]AnalysisDiagnostic, error) {
+	r := &analysisRun{
+		results:  make(map[analysisKey]*analysisResult),
+		objFacts: make(map[objectFactKey]analysis.Fact),
+		pkgFacts: make(map[packageFactKey]analysis.Fact),
+	}
+
+	for _, pkg := range importOrder(pkgs) {
+		for _, a := range analyzers {
+			if res := r.run(a, pkg); res.err != nil {
+				return nil, res.err
+			}
+		}
+	}
+
+	sort.SliceStable(r.diags, func(i, j int) bool {
+		pi, pj := r.diags[i].Position, r.diags[j].Position
+		if pi.Filename != pj.Filename {
+			return pi.Filename < pj.Filename
+		}
+		if pi.Offset != pj.Offset {
+			return pi.Offset < pj.Offset
+		}
+		return r.diags[i].Analyzer.Name < r.diags[j].Analyzer.Name
+	})
+	return r.diags, nil
+}
+
+// importOrder returns pkgs sorted so that each package comes after any others in pkgs that it imports.
+func importOrder(pkgs []*packages.Package) []*packages.Package {
+	var (
+		inSet  = make(map[*packages.Package]bool)
+		seen   = make(map[*packages.Package]bool)
+		result []*packages.Package
+		visit  func(*packages.Package)
+	)
+	for _, pkg := range pkgs {
+		inSet[pkg] = true
+	}
+	visit = func(pkg *packages.Package) {
+		if seen[pkg] {
+			return
+		}
+		seen[pkg] = true
+		paths := make([]string, 0, len(pkg.Imports))
+		for path := range pkg.Imports {
+			paths = append(paths, path)
+		}
+		sort.Strings(paths)
+		for _, path := range paths {
+			if imp := pkg.Imports[path]; inSet[imp] {
+				visit(imp)
+			}
+		}
+		result = append(result, pkg)
+	}
+	for _, pkg := range pkgs {
+		visit(pkg)
+	}
+	return result
+}
+
+// run runs the analyzer a on pkg,
+// after the analyzers it requires,
+// memoizing the result.
+func (r *analysisRun) run(a *analysis.Analyzer, pkg *packages.Package) *analysisResult {
+	key := analysisKey{a: a, pkg: pkg}
+	if res, ok := r.results[key]; ok {
+		return res
+	}
+	res := r.exec(a, pkg)
+	r.results[key] = res
+	return res
+}
+
+func (r *analysisRun) exec(a *analysis.Analyzer, pkg *packages.Package) *analysisResult {
+	if pkg.Types == nil || (pkg.IllTyped && !a.RunDespiteErrors) {
+		return &analysisResult{skipped: true}
+	}
+
+	resultOf := make(map[*analysis.Analyzer]any)
+	for _, req := range a.Requires {
+		res := r.run(req, pkg)
+		if res.err != nil || res.skipped {
+			return res
+		}
+		resultOf[req] = res.result
+	}
+
+	factTypes := make(map[reflect.Type]bool)
+	for _, f := range a.FactTypes {
+		factTypes[reflect.TypeOf(f)] = true
+	}
+
+	pass := &analysis.Pass{
+		Analyzer:     a,
+		Fset:         pkg.Fset,
+		Files:        pkg.Syntax,
+		OtherFiles:   pkg.OtherFiles,
+		IgnoredFiles: pkg.IgnoredFiles,
+		Pkg:          pkg.Types,
+		TypesInfo:    pkg.TypesInfo,
+		TypesSizes:   pkg.TypesSizes,
+		TypeErrors:   pkg.TypeErrors,
+		ResultOf:     resultOf,
+		Report: func(d analysis.Diagnostic) {
+			r.diags = append(r.diags, AnalysisDiagnostic{
+				Diagnostic: d,
+				Analyzer:   a,
+				PkgPath:    pkg.PkgPath,
+				Position:   pkg.Fset.Position(d.Pos),
+			})
+		},
+		ImportObjectFact: func(obj types.Object, fact analysis.Fact) bool {
+			stored, ok := r.objFacts[objectFactKey{obj: obj, t: reflect.TypeOf(fact)}]
+			if ok {
+				reflect.ValueOf(fact).Elem().Set(reflect.ValueOf(stored).Elem())
+			}
+			return ok
+		},
+		ImportPackageFact: func(p *types.Package, fact analysis.Fact) bool {
+			stored, ok := r.pkgFacts[packageFactKey{pkg: p, t: reflect.TypeOf(fact)}]
+			if ok {
+				reflect.ValueOf(fact).Elem().Set(reflect.ValueOf(stored).Elem())
+			}
+			return ok
+		},
+		ExportObjectFact: func(obj types.Object, fact analysis.Fact) {
+			if obj.Pkg() != pkg.Types {
+				panic(fmt.Sprintf("analyzer %s exported a fact about %s, which is not in package %s", a.Name, obj, pkg.PkgPath))
+			}
+			r.objFacts[objectFactKey{obj: obj, t: reflect.TypeOf(fact)}] = fact
+		},
+		ExportPackageFact: func(fact analysis.Fact) {
+			r.pkgFacts[packageFactKey{pkg: pkg.Types, t: reflect.TypeOf(fact)}] = fact
+		},
+		AllObjectFacts: func() []analysis.ObjectFact {
+			var result []analysis.ObjectFact
+			for k, fact := range r.objFacts {
+				if factTypes[k.t] {
+					result = append(result, analysis.ObjectFact{Object: k.obj, Fact: fact})
+				}
+			}
+			return result
+		},
+		AllPackageFacts: func() []analysis.PackageFact {
+			var result []analysis.PackageFact
+			for k, fact := range r.pkgFacts {
+				if factTypes[k.t] {
+					result = append(result, analysis.PackageFact{Package: k.pkg, Fact: fact})
+				}
+			}
+			return result
+		},
+	}
+
+	result, err := a.Run(pass)
+	if err != nil {
+		return &analysisResult{err: errors.Wrapf(err, "running %s on %s", a.Name, pkg.PkgPath)}
+	}
+	return &analysisResult{result: result}
+}
@@ -0,0 +1,256 @@
+package modules
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/bobg/errors"
+	"golang.org/x/mod/modfile"
+)
+
+// EachAtRev calls f for each Go module in repoDir and its subdirectories
+// as of the git revision rev,
+// passing it the directory the module would occupy in a checkout of rev
+// and the module's parsed go.mod file as of rev.
+// This function calls Walker.EachAtRev with a default Walker.
+func EachAtRev(repoDir, rev string, f func(string, *modfile.File) error) error {
+	var w Walker
+	return w.EachAtRev(repoDir, rev, f)
+}
+
+// EachAtRev calls f for each Go module in repoDir and its subdirectories
+// as of the git revision rev,
+// passing it the directory the module would occupy in a checkout of rev
+// (which will have repoDir as a prefix)
+// and the module's parsed go.mod file as of rev.
+// The files are read from the git repository containing repoDir,
+// which need not have rev checked out;
+// the working tree and index are not touched.
+//
+// Modules are visited in the order [Walker.EachGomod] would visit them in a checkout of rev,
+// skipping the same directories
+// (judging by [IgnoreFileName] files as of rev),
+// and f may return [filepath.SkipDir] or [filepath.SkipAll] in the same way.
+// Links are not followed,
+// and the contents of git submodules,
+// which are not part of the repository's tree,
+// are not visited.
+func (w *Walker) EachAtRev(repoDir, rev string, f func(string, *modfile.File) error) error {
+	entries, err := lsTree(repoDir, rev)
+	if err != nil {
+		return errors.Wrapf(err, "listing files in %s at %s", repoDir, rev)
+	}
+
+	var (
+		gomods  = make(map[string]string) // module directory -> go.mod blob
+		ignores = make(map[string]string) // ignore file path -> blob
+		oids    []string
+	)
+	for _, e := range entries {
+		if e.typ != "blob" || (e.mode != "100644" && e.mode != "100755") {
+			continue
+		}
+		switch path.Base(e.path) {
+		case "go.mod":
+			gomods[path.Dir(e.path)] = e.oid
+			oids = append(oids, e.oid)
+		case IgnoreFileName:
+			if !w.NoIgnoreFiles {
+				ignores[e.path] = e.oid
+				oids = append(oids, e.oid)
+			}
+		}
+	}
+
+	blobs, err := catBlobs(repoDir, oids)
+	if err != nil {
+		return errors.Wrapf(err, "reading files in %s at %s", repoDir, rev)
+	}
+
+	ig := w.newIgnorer(repoDir)
+	if ig != nil {
+		ig.readFile = func(filename string) ([]byte, error) {
+			rel, err := filepath.Rel(repoDir, filename)
+			if err != nil {
+				return nil, err
+			}
+			oid, ok := ignores[filepath.ToSlash(rel)]
+			if !ok {
+				return nil, fs.ErrNotExist
+			}
+			return blobs[oid], nil
+		}
+	}
+
+	dirs := make([]string, 0, len(gomods))
+	for dir := range gomods {
+		dirs = append(dirs, dir)
+	}
+	// Sorting by path segments gives the order of a depth-first walk
+	// that visits each directory's entries in lexical order.
+	slices.SortFunc(dirs, func(a, b string) int {
+		return slices.Compare(revSegments(a), revSegments(b))
+	})
+
+	var (
+		skipped = make(map[string]bool) // by slash-separated relative directory
+		found   int
+	)
+	for _, rel := range dirs {
+		if skip, err := w.skipAtRev(ig, repoDir, rel, skipped); err != nil {
+			return err
+		} else if skip {
+			continue
+		}
+
+		var (
+			dir       = filepath.Join(repoDir, filepath.FromSlash(rel))
+			gomodPath = filepath.Join(dir, "go.mod")
+		)
+		mf, err := w.parseGomod(gomodPath, blobs[gomods[rel]])
+		if err != nil {
+			return WalkError{Dir: dir, Op: "visiting", Err: err}
+		}
+
+		found++
+		err = f(dir, mf)
+		switch {
+		case errors.Is(err, filepath.SkipDir):
+			skipped[rel] = true
+		case errors.Is(err, filepath.SkipAll):
+			return nil
+		case err != nil:
+			return WalkError{Dir: dir, Op: "visiting", Err: err}
+		}
+		if w.Limit > 0 && found >= w.Limit {
+			return nil
+		}
+	}
+
+	if found == 0 && w.RequireModules {
+		return WalkError{Dir: repoDir, Op: "walking", Err: ErrNoModules}
+	}
+	return nil
+}
+
+// skipAtRev tells whether the walk in [Walker.EachAtRev] skips the module directory rel
+// (slash-separated and relative to root)
+// because it or a directory above it is skipped.
+// The skipped map records the directories already known to be skipped,
+// and is updated.
+func (w *Walker) skipAtRev(ig *ignorer, root, rel string, skipped map[string]bool) (bool, error) {
+	if rel == "." {
+		return skipped[rel], nil
+	}
+	if skipped["."] {
+		return true, nil
+	}
+	segments := revSegments(rel)
+	for i := range segments {
+		prefix := strings.Join(segments[:i+1], "/")
+		if skipped[prefix] {
+			return true, nil
+		}
+		if w.skipReason(segments[i]) != "" {
+			skipped[prefix] = true
+			return true, nil
+		}
+		ignored, err := ig.ignored(filepath.Join(root, filepath.FromSlash(prefix)))
+		if err != nil {
+			return false, err
+		}
+		if ignored {
+			skipped[prefix] = true
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func revSegments(rel string) []string {
+	if rel == "." {
+		return nil
+	}
+	return strings.Split(rel, "/")
+}
+
+// treeEntry is an entry in the output of git ls-tree.
+type treeEntry struct {
+	mode, typ, oid string
+
+	// path is slash-separated
+	// and relative to the directory in which git ls-tree runs.
+	path string
+}
+
+// lsTree lists the files at rev in dir and its subdirectories,
+// recursively.
+func lsTree(dir, rev string) ([]treeEntry, error) {
+	out, err := git(dir, "ls-tree", "-r", "-z", rev)
+	if err != nil {
+		return nil, err
+	}
+	var result []treeEntry
+	for _, line := range strings.Split(out, "\x00") {
+		if line == "" {
+			continue
+		}
+		info, p, ok := strings.Cut(line, "\t")
+		fields := strings.Fields(info)
+		if !ok || len(fields) != 3 {
+			return nil, fmt.Errorf("unexpected git ls-tree output %q", line)
+		}
+		result = append(result, treeEntry{mode: fields[0], typ: fields[1], oid: fields[2], path: p})
+	}
+	return result, nil
+}
+
+// catBlobs returns the contents of the git blobs with the given object IDs,
+// in the repository containing dir.
+func catBlobs(dir string, oids []string) (map[string][]byte, error) {
+	result := make(map[string][]byte, len(oids))
+	if len(oids) == 0 {
+		return result, nil
+	}
+
+	cmd := exec.Command("git", "cat-file", "--batch")
+	cmd.Dir = dir
+	cmd.Stdin = strings.NewReader(strings.Join(oids, "\n") + "\n")
+	stderr := new(bytes.Buffer)
+	cmd.Stderr = stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, errors.Wrapf(err, "running git cat-file: %s", bytes.TrimSpace(stderr.Bytes()))
+	}
+
+	r := bufio.NewReader(bytes.NewReader(out))
+	for range oids {
+		header, err := r.ReadString('\n')
+		if err != nil {
+			return nil, errors.Wrap(err, "reading git cat-file output")
+		}
+		fields := strings.Fields(header)
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("unexpected git cat-file output %q", strings.TrimSpace(header))
+		}
+		size, err := strconv.Atoi(fields[2])
+		if err != nil {
+			return nil, errors.Wrapf(err, "parsing size in git cat-file output %q", strings.TrimSpace(header))
+		}
+		data := make([]byte, size+1) // including the trailing newline
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil, errors.Wrap(err, "reading git cat-file output")
+		}
+		result[fields[0]] = data[:size]
+	}
+	return result, nil
+}
@@ -0,0 +1,137 @@
+package modules
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+
+	"github.com/bobg/errors"
+)
+
+// BazelModule describes a Go module in a tree in Bazel terms.
+// See [Graph.BazelModules].
+type BazelModule struct {
+	// Path is the module path.
+	Path string
+
+	// Package is the Bazel package label of the module's directory,
+	// such as "//" for the root of the tree
+	// or "//tools/gen" for a subdirectory.
+	Package string
+
+	// Gomod is the Bazel label of the module's go.mod file,
+	// such as "//:go.mod" or "//tools/gen:go.mod".
+	Gomod string
+
+	// Deps are the Package labels of the modules in the tree that this one depends on,
+	// in the order of [Graph.Nodes].
+	Deps []string
+}
+
+// GazellePrefix returns the gazelle directive that belongs in the BUILD.bazel file of the module's directory,
+// telling gazelle the import path of the packages there.
+func (m BazelModule) GazellePrefix() string {
+	return "# gazelle:prefix " + m.Path
+}
+
+// BazelModules describes the modules in g in Bazel terms,
+// in the order of g.Nodes,
+// with labels relative to root,
+// which is normally the directory of the Bazel workspace's MODULE.bazel file.
+// It is an error for a module to be outside root.
+func (g *Graph) BazelModules(root string) ([]BazelModule, error) {
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return nil, errors.Wrapf(err, "getting absolute path of %s", root)
+	}
+
+	labels := make(map[*ModuleNode]string, len(g.Nodes))
+	for _, node := range g.Nodes {
+		absDir, err := filepath.Abs(node.Dir)
+		if err != nil {
+			return nil, errors.Wrapf(err, "getting absolute path of %s", node.Dir)
+		}
+		rel, err := filepath.Rel(absRoot, absDir)
+		if err != nil || !filepath.IsLocal(rel) {
+			return nil, fmt.Errorf("module %s is not in %s", node.Dir, root)
+		}
+		if rel == "." {
+			labels[node] = "//"
+		} else {
+			labels[node] = "//" + filepath.ToSlash(rel)
+		}
+	}
+
+	result := make([]BazelModule, 0, len(g.Nodes))
+	for _, node := range g.Nodes {
+		m := BazelModule{
+			Path:    node.Path,
+			Package: labels[node],
+			Gomod:   labels[node] + ":go.mod",
+		}
+		for _, dep := range node.Deps {
+			m.Deps = append(m.Deps, labels[dep])
+		}
+		result = append(result, m)
+	}
+	return result, nil
+}
+
+// WriteModuleBazel writes a fragment of a MODULE.bazel file to w
+// declaring the Go dependencies of the modules in g
+// to the go_deps extension of gazelle,
+// with one go_deps.from_file for each module's go.mod file.
+// Labels are relative to root,
+// as in [Graph.BazelModules].
+//
+// The fragment begins with comments listing the modules
+// and the dependencies among them,
+// and the gazelle:prefix directive each module's directory needs
+// (see [BazelModule.GazellePrefix]),
+// so that gazelle resolves imports between the modules to local targets.
+func (g *Graph) WriteModuleBazel(w io.Writer, root string) error {
+	mods, err := g.BazelModules(root)
+	if err != nil {
+		return err
+	}
+
+	buf := new(bytes.Buffer)
+	fmt.Fprintln(buf, "# Go modules in this repository:")
+	for _, m := range mods {
+		fmt.Fprintf(buf, "#   %s (%s)\n", m.Package, m.Path)
+		fmt.Fprintf(buf, "#     BUILD.bazel: %s\n", m.GazellePrefix())
+		for _, dep := range m.Deps {
+			fmt.Fprintf(buf, "#     depends on %s\n", dep)
+		}
+	}
+	fmt.Fprintln(buf)
+	fmt.Fprintln(buf, `go_deps = use_extension("@gazelle//:extensions.bzl", "go_deps")`)
+	for _, m := range mods {
+		fmt.Fprintf(buf, "go_deps.from_file(go_mod = %s)\n", strconv.Quote(m.Gomod))
+	}
+
+	_, err = w.Write(buf.Bytes())
+	return errors.Wrap(err, "writing MODULE.bazel fragment")
+}
+
+// WriteModuleBazel writes a MODULE.bazel fragment for the Go modules in dir and its subdirectories to out,
+// with labels relative to dir.
+// This function calls Walker.WriteModuleBazel with a default Walker.
+func WriteModuleBazel(dir string, out io.Writer) error {
+	var w Walker
+	return w.WriteModuleBazel(dir, out)
+}
+
+// WriteModuleBazel writes a MODULE.bazel fragment for the Go modules in dir and its subdirectories to out,
+// with labels relative to dir.
+// It uses the module graph produced by [Walker.BuildModuleGraph].
+// See [Graph.WriteModuleBazel].
+func (w *Walker) WriteModuleBazel(dir string, out io.Writer) error {
+	g, err := w.BuildModuleGraph(dir)
+	if err != nil {
+		return err
+	}
+	return g.WriteModuleBazel(out, dir)
+}
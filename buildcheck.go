@@ -0,0 +1,132 @@
+package modules
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/bobg/errors"
+)
+
+// BuildCheckResult is the result of building one Go module for one platform.
+// See [Walker.BuildCheckEach].
+type BuildCheckResult struct {
+	// Dir is the directory containing the module's go.mod file.
+	Dir string
+
+	// Platform is the platform the module was built for.
+	Platform Platform
+
+	// Failed tells whether the build failed.
+	Failed bool
+
+	// Packages are the import paths of the packages that failed to build,
+	// in the order reported by "go build".
+	// It may be empty even when Failed is true,
+	// for example if the build failed before compiling any package.
+	Packages []string
+
+	// Output is the standard error of "go build",
+	// which includes the compiler errors.
+	Output string
+}
+
+// BuildCheckEach builds each Go module in dir and its subdirectories for each of the given platforms.
+// This function calls Walker.BuildCheckEach with a default Walker.
+func BuildCheckEach(ctx context.Context, dir string, platforms []Platform) ([]BuildCheckResult, error) {
+	var w Walker
+	return w.BuildCheckEach(ctx, dir, platforms)
+}
+
+// BuildCheckEach builds each Go module in dir and its subdirectories for each of the given platforms,
+// using "go build" with GOOS and GOARCH set as for [Walker.LoadEachMatrix],
+// and discarding the results.
+// The result has one entry for each module and platform,
+// in the order [Walker.Each] visits the modules
+// and then in the order of platforms.
+// See [FailedBuilds] for selecting the failures.
+//
+// The packages built in each module are the ones that [Walker.LoadEach] would load,
+// and w.BuildFlags are passed to "go build".
+// The settings in w.Env, w.GOFLAGS, and w.GOWORK,
+// and the environment in w.LoadConfig,
+// are used when running "go build".
+// Test files are not compiled.
+// Cgo is disabled when cross-compiling
+// unless a C cross-compiler is configured in the environment.
+//
+// Build failures are reported in the results,
+// not as errors.
+// An error is returned only if "go build" can't be run.
+func (w *Walker) BuildCheckEach(ctx context.Context, dir string, platforms []Platform) ([]BuildCheckResult, error) {
+	var result []BuildCheckResult
+	err := w.Each(dir, func(subdir string) error {
+		for _, p := range platforms {
+			res, err := w.buildCheck(ctx, subdir, p)
+			if err != nil {
+				return errors.Wrapf(err, "building %s for %s", subdir, p)
+			}
+			result = append(result, res)
+		}
+		return nil
+	})
+	return result, err
+}
+
+// FailedBuilds returns the results in results that are failures.
+func FailedBuilds(results []BuildCheckResult) []BuildCheckResult {
+	var failed []BuildCheckResult
+	for _, res := range results {
+		if res.Failed {
+			failed = append(failed, res)
+		}
+	}
+	return failed
+}
+
+func (w *Walker) buildCheck(ctx context.Context, dir string, p Platform) (BuildCheckResult, error) {
+	res := BuildCheckResult{Dir: dir, Platform: p}
+
+	args := []string{"build"}
+	args = append(args, w.BuildFlags...)
+	args = append(args, w.loadPatterns(dir)...)
+
+	env := w.loadEnv(w.LoadConfig.Env)
+	if env == nil {
+		env = os.Environ()
+	}
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "go", args...)
+	cmd.Dir = dir
+	cmd.Env = append(append([]string{}, env...), p.env()...)
+	cmd.Stderr = &stderr
+
+	err := cmd.Run()
+	res.Output = stderr.String()
+
+	// "go build" exits with a non-zero status when the build fails.
+	// That's reported in the result.
+	var exitErr *exec.ExitError
+	if err != nil && !errors.As(err, &exitErr) {
+		return res, errors.Wrap(err, "running go build")
+	}
+	if ctx.Err() != nil {
+		return res, ctx.Err()
+	}
+	if err == nil {
+		return res, nil
+	}
+
+	res.Failed = true
+	sc := bufio.NewScanner(strings.NewReader(res.Output))
+	for sc.Scan() {
+		if pkg, ok := strings.CutPrefix(sc.Text(), "# "); ok {
+			res.Packages = append(res.Packages, pkg)
+		}
+	}
+	return res, nil
+}
@@ -0,0 +1,88 @@
+package modules
+
+// Plan is an ordered plan for building the Go modules in a tree:
+// a sequence of steps,
+// each a group of modules that can be built in parallel
+// once the steps it depends on are done.
+// See [Walker.BuildPlan].
+type Plan struct {
+	Steps []PlanStep
+}
+
+// PlanStep is a step in a [Plan].
+type PlanStep struct {
+	// Modules are the modules to build in this step,
+	// in the order of [Graph.Nodes].
+	// None of them depends on another.
+	Modules []*ModuleNode
+
+	// DependsOn are the indexes in [Plan.Steps] of the earlier steps
+	// containing modules that this step's modules depend on,
+	// in increasing order.
+	DependsOn []int
+}
+
+// BuildPlan produces a [Plan] for building the Go modules in dir and its subdirectories.
+// This function calls Walker.BuildPlan with a default Walker.
+func BuildPlan(dir string) (*Plan, error) {
+	var w Walker
+	return w.BuildPlan(dir)
+}
+
+// BuildPlan produces a [Plan] for building the Go modules in dir and its subdirectories,
+// from the module graph produced by [Walker.BuildModuleGraph].
+// See [Graph.Plan].
+func (w *Walker) BuildPlan(dir string) (*Plan, error) {
+	g, err := w.BuildModuleGraph(dir)
+	if err != nil {
+		return nil, err
+	}
+	return g.Plan()
+}
+
+// Plan produces a [Plan] for building the modules in g.
+// Each module is placed in the earliest step possible:
+// step 0 has the modules with no dependencies in the tree,
+// and each later step has the modules whose deepest dependency is in the step before.
+// If the graph contains a cycle,
+// Plan returns a [*CycleError].
+func (g *Graph) Plan() (*Plan, error) {
+	sorted, err := g.TopoSort()
+	if err != nil {
+		return nil, err
+	}
+
+	level := make(map[*ModuleNode]int)
+	for _, node := range sorted {
+		for _, dep := range node.Deps {
+			if l := level[dep] + 1; l > level[node] {
+				level[node] = l
+			}
+		}
+	}
+
+	plan := new(Plan)
+	for _, node := range g.Nodes {
+		l := level[node]
+		for len(plan.Steps) <= l {
+			plan.Steps = append(plan.Steps, PlanStep{})
+		}
+		plan.Steps[l].Modules = append(plan.Steps[l].Modules, node)
+	}
+
+	for i := range plan.Steps {
+		deps := make(map[int]bool)
+		for _, node := range plan.Steps[i].Modules {
+			for _, dep := range node.Deps {
+				deps[level[dep]] = true
+			}
+		}
+		for j := 0; j < i; j++ {
+			if deps[j] {
+				plan.Steps[i].DependsOn = append(plan.Steps[i].DependsOn, j)
+			}
+		}
+	}
+
+	return plan, nil
+}
@@ -0,0 +1,480 @@
+package modules
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/bobg/errors"
+	"golang.org/x/exp/apidiff"
+	"golang.org/x/mod/modfile"
+	"golang.org/x/mod/module"
+	"golang.org/x/tools/go/packages"
+)
+
+// BumpLevel is the kind of semantic-version increase a module needs.
+type BumpLevel int
+
+const (
+	// BumpNone means the module has not changed since its latest release.
+	BumpNone BumpLevel = iota
+
+	// BumpPatch means the module has changed, but not its exported API.
+	BumpPatch
+
+	// BumpMinor means the module's exported API has changed in backward-compatible ways.
+	BumpMinor
+
+	// BumpMajor means the module's exported API has changed in incompatible ways.
+	BumpMajor
+)
+
+func (b BumpLevel) String() string {
+	switch b {
+	case BumpNone:
+		return "none"
+	case BumpPatch:
+		return "patch"
+	case BumpMinor:
+		return "minor"
+	case BumpMajor:
+		return "major"
+	}
+	return "unknown"
+}
+
+// BumpRecommendation is the result of comparing a module against its latest release.
+// See [Walker.RecommendBumps].
+type BumpRecommendation struct {
+	// Dir is the directory containing the module's go.mod file.
+	Dir string
+
+	// Path is the module path.
+	Path string
+
+	// Latest is the module's latest tagged version,
+	// or the empty string if it has none.
+	Latest string
+
+	// Level is the recommended version bump.
+	Level BumpLevel
+
+	// Changes are the changes to the module's exported API since Latest,
+	// with incompatible changes first.
+	Changes []apidiff.Change
+}
+
+// RecommendBumps compares each Go module in dir and its subdirectories against its latest release,
+// and recommends a semantic-version bump for each.
+// This function calls Walker.RecommendBumps with a default Walker.
+func RecommendBumps(dir string) ([]BumpRecommendation, error) {
+	var w Walker
+	return w.RecommendBumps(dir)
+}
+
+// RecommendBumps compares each Go module in dir and its subdirectories against its latest release,
+// and recommends a semantic-version bump for each.
+//
+// A module's latest release is its highest-versioned git tag reachable from HEAD,
+// following the convention that tags for a module in a subdirectory of its repository
+// are prefixed with that subdirectory,
+// as in "sub/dir/v1.2.3".
+// Only versions with the major version implied by the module path are considered.
+// The source at that tag is extracted from git into a temporary directory,
+// and the exported APIs of the two versions are compared using [apidiff.ModuleChanges].
+// Packages named main and internal packages are not part of a module's exported API.
+//
+// Any incompatible API change calls for a major bump,
+// and any compatible API change for a minor bump.
+// Otherwise, if any file in the module differs from the tagged version
+// (including uncommitted changes),
+// the recommendation is a patch bump.
+//
+// A module with no tagged versions gets a recommendation of [BumpMinor],
+// reflecting an initial release.
+func (w *Walker) RecommendBumps(dir string) ([]BumpRecommendation, error) {
+	var result []BumpRecommendation
+	err := w.EachGomod(dir, func(subdir string, mf *modfile.File) error {
+		rec, err := w.recommendBump(subdir, mf)
+		if err != nil {
+			return err
+		}
+		result = append(result, rec)
+		return nil
+	})
+	return result, err
+}
+
+func (w *Walker) recommendBump(dir string, mf *modfile.File) (BumpRecommendation, error) {
+	rec := BumpRecommendation{Dir: dir}
+	if mf.Module == nil {
+		return rec, errors.New("no module directive")
+	}
+	rec.Path = mf.Module.Mod.Path
+
+	major, err := modulePathMajor(rec.Path)
+	if err != nil {
+		return rec, err
+	}
+	rec.Latest, err = latestModuleVersion(dir, major, "HEAD")
+	if err != nil {
+		return rec, err
+	}
+	if rec.Latest == "" {
+		rec.Level = BumpMinor
+		return rec, nil
+	}
+
+	prefix, err := moduleTagPrefix(dir)
+	if err != nil {
+		return rec, errors.Wrapf(err, "getting tag prefix for %s", dir)
+	}
+	tag := prefix + rec.Latest
+
+	tmpdir, err := os.MkdirTemp("", "modules")
+	if err != nil {
+		return rec, errors.Wrap(err, "creating temp dir")
+	}
+	defer os.RemoveAll(tmpdir)
+
+	// Extract the whole repository,
+	// not just the module,
+	// so that relative replace directives still work.
+	if err := extractGitTree(dir, tag, tmpdir); err != nil {
+		return rec, errors.Wrapf(err, "extracting %s", tag)
+	}
+	oldDir := filepath.Join(tmpdir, filepath.FromSlash(prefix))
+
+	report, err := w.apiChanges(oldDir, dir)
+	if err != nil {
+		return rec, errors.Wrapf(err, "comparing %s with %s", dir, tag)
+	}
+	rec.Changes = report.Changes
+
+	switch {
+	case hasIncompatibleChange(rec.Changes):
+		rec.Level = BumpMajor
+
+	case len(rec.Changes) > 0:
+		rec.Level = BumpMinor
+
+	default:
+		changed, err := moduleChangedSince(dir, tag)
+		if err != nil {
+			return rec, err
+		}
+		if changed {
+			rec.Level = BumpPatch
+		}
+	}
+
+	return rec, nil
+}
+
+// APIDiff is the result of comparing a module's exported API against its latest published release.
+// See [Walker.APIDiffEach].
+type APIDiff struct {
+	// Path is the module path.
+	Path string
+
+	// Released is the module's latest released version,
+	// as reported by the module proxy,
+	// or the empty string if it has none.
+	Released string
+
+	// Changes are the changes to the module's exported API since Released,
+	// with incompatible changes first.
+	Changes []apidiff.Change
+}
+
+// Incompatible returns the incompatible changes in d.Changes.
+func (d APIDiff) Incompatible() []apidiff.Change {
+	for i, c := range d.Changes {
+		if c.Compatible {
+			return d.Changes[:i]
+		}
+	}
+	return d.Changes
+}
+
+// APIDiffEach compares the exported API of each Go module in dir and its subdirectories
+// against the module's latest published release.
+// This function calls Walker.APIDiffEach with a default Walker.
+func APIDiffEach(dir string, f func(string, APIDiff) error) error {
+	var w Walker
+	return w.APIDiffEach(dir, f)
+}
+
+// APIDiffEach compares the exported API of each Go module in dir and its subdirectories
+// against the module's latest published release.
+// The callback receives the module's directory
+// (which will have dir as a prefix)
+// and the result of the comparison.
+// It is called for every module,
+// including those with no release,
+// for which Released and Changes are empty.
+//
+// Unlike [Walker.RecommendBumps],
+// which uses git tags in the local repository,
+// this finds the latest release by asking the module proxy
+// (as configured by GOPROXY)
+// for the version query "latest",
+// and downloads it with "go mod download".
+// If the proxy has only pseudo-versions for the module,
+// or does not know the module at all
+// (it answers the query with 404 or 410, or with no matching version),
+// it is considered unreleased.
+// Other failures,
+// including authentication and version-control errors,
+// are errors.
+//
+// The comparison is done as in [Walker.RecommendBumps].
+func (w *Walker) APIDiffEach(dir string, f func(string, APIDiff) error) error {
+	return w.EachGomod(dir, func(subdir string, mf *modfile.File) error {
+		if mf.Module == nil {
+			return fmt.Errorf("no module directive in %s", subdir)
+		}
+		d, err := w.apiDiff(subdir, mf.Module.Mod.Path)
+		if err != nil {
+			return errors.Wrapf(err, "comparing %s with its latest release", subdir)
+		}
+		return f(subdir, d)
+	})
+}
+
+func (w *Walker) apiDiff(dir, modpath string) (APIDiff, error) {
+	d := APIDiff{Path: modpath}
+
+	tmpdir, err := os.MkdirTemp("", "modules")
+	if err != nil {
+		return d, errors.Wrap(err, "creating temp dir")
+	}
+	defer os.RemoveAll(tmpdir)
+
+	// Run outside of any module or workspace,
+	// so the go command doesn't object to querying the main module.
+	w2 := *w
+	w2.GOWORK = "off"
+
+	out, err := w2.goCmd(tmpdir, "mod", "download", "-json", modpath+"@latest")
+	mods, decodeErr := decodeListedModules(out)
+	if decodeErr != nil {
+		return d, errors.Join(err, decodeErr)
+	}
+	if len(mods) != 1 {
+		return d, errors.Join(err, fmt.Errorf("got %d results from go mod download, want 1", len(mods)))
+	}
+	if mods[0].Error != nil {
+		if isUnknownModule(mods[0].Error.Err) {
+			return d, nil
+		}
+		return d, errors.New(mods[0].Error.Err)
+	}
+	if err != nil {
+		return d, err
+	}
+	if module.IsPseudoVersion(mods[0].Version) {
+		return d, nil
+	}
+	d.Released = mods[0].Version
+
+	// Copy the release out of the read-only module cache,
+	// so the go command can update its go.sum file if needed when loading it.
+	oldDir := filepath.Join(tmpdir, "old")
+	if err := copyDir(mods[0].Dir, oldDir); err != nil {
+		return d, err
+	}
+
+	oldAPI, err := w2.loadAPI(oldDir)
+	if err != nil {
+		return d, errors.Wrapf(err, "loading API of %s", d.Released)
+	}
+	newAPI, err := w.loadAPI(dir)
+	if err != nil {
+		return d, errors.Wrapf(err, "loading API of %s", dir)
+	}
+	d.Changes = moduleChanges(oldAPI, newAPI).Changes
+	return d, nil
+}
+
+// unknownModuleRegex matches the errors from "go mod download path@latest"
+// when the module proxy says it has no versions of the module:
+// a 404 or 410 response to the query,
+// or no version matching it.
+var unknownModuleRegex = regexp.MustCompile(`reading \S+/@v/(list|latest): (404 Not Found|410 Gone)|no matching versions for query "latest"`)
+
+// isUnknownModule tells whether msg,
+// an error from "go mod download path@latest",
+// means the module proxy has no versions of the module.
+// Errors that may instead mean missing credentials for a private module,
+// which the proxy can also report as 404 or 410,
+// do not count.
+func isUnknownModule(msg string) bool {
+	if !unknownModuleRegex.MatchString(msg) {
+		return false
+	}
+	lower := strings.ToLower(msg)
+	for _, s := range []string{
+		"terminal prompts disabled",
+		"could not read username",
+		"authentication",
+		"permission denied",
+		"401 unauthorized",
+		"403 forbidden",
+	} {
+		if strings.Contains(lower, s) {
+			return false
+		}
+	}
+	return true
+}
+
+// copyDir copies the regular files in the tree at src to dest,
+// which is created if necessary.
+func copyDir(src, dest string) error {
+	return filepath.WalkDir(src, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return errors.Wrapf(err, "getting relative path of %s", path)
+		}
+		target := filepath.Join(dest, rel)
+		if entry.IsDir() {
+			return errors.Wrapf(os.MkdirAll(target, 0755), "creating %s", target)
+		}
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return errors.Wrapf(err, "reading %s", path)
+		}
+		return errors.Wrapf(os.WriteFile(target, data, 0644), "writing %s", target)
+	})
+}
+
+// apiChanges compares the exported APIs of the modules in oldDir and newDir.
+// The changes in the result are sorted with incompatible changes first.
+func (w *Walker) apiChanges(oldDir, newDir string) (apidiff.Report, error) {
+	oldAPI, err := w.loadAPI(oldDir)
+	if err != nil {
+		return apidiff.Report{}, errors.Wrapf(err, "loading API of %s", oldDir)
+	}
+	newAPI, err := w.loadAPI(newDir)
+	if err != nil {
+		return apidiff.Report{}, errors.Wrapf(err, "loading API of %s", newDir)
+	}
+
+	return moduleChanges(oldAPI, newAPI), nil
+}
+
+// moduleChanges compares two module APIs,
+// sorting the changes in the result with incompatible changes first.
+func moduleChanges(oldAPI, newAPI *apidiff.Module) apidiff.Report {
+	report := apidiff.ModuleChanges(oldAPI, newAPI)
+	sort.SliceStable(report.Changes, func(i, j int) bool {
+		ci, cj := report.Changes[i], report.Changes[j]
+		if ci.Compatible != cj.Compatible {
+			return !ci.Compatible
+		}
+		return ci.Message < cj.Message
+	})
+	return report
+}
+
+// loadAPI loads the exported API of the module in dir.
+func (w *Walker) loadAPI(dir string) (*apidiff.Module, error) {
+	_, mf, err := w.readGomod(dir)
+	if err != nil {
+		return nil, err
+	}
+	if mf.Module == nil {
+		return nil, errors.New("no module directive")
+	}
+
+	// The API is that of all the module's packages,
+	// regardless of how w is configured to choose them.
+	w2 := w.withLoadMode(packages.NeedName | packages.NeedTypes)
+	w2.LoadPatterns, w2.PatternsFor, w2.LoadTests, w2.SkipEmptyModules = nil, nil, false, false
+
+	pkgs, err := w2.load(dir, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &apidiff.Module{Path: mf.Module.Mod.Path}
+	for _, pkg := range pkgs {
+		if pkg.Types == nil || pkg.Name == "main" || isInternalPath(pkg.PkgPath) {
+			continue
+		}
+		result.Packages = append(result.Packages, pkg.Types)
+	}
+	return result, nil
+}
+
+func hasIncompatibleChange(changes []apidiff.Change) bool {
+	for _, c := range changes {
+		if !c.Compatible {
+			return true
+		}
+	}
+	return false
+}
+
+// isInternalPath tells whether the package path contains an "internal" element,
+// making it importable only from within a limited subtree.
+func isInternalPath(pkgPath string) bool {
+	return pkgPath == "internal" ||
+		strings.HasPrefix(pkgPath, "internal/") ||
+		strings.HasSuffix(pkgPath, "/internal") ||
+		strings.Contains(pkgPath, "/internal/")
+}
+
+// moduleChangedSince tells whether any file in the module in dir differs from its version at the given git ref,
+// including uncommitted changes
+// and new files not yet added to git
+// (unless git ignores them).
+// Files in nested modules don't count.
+func moduleChangedSince(dir, ref string) (bool, error) {
+	changed, err := git(dir, "diff", "--name-only", "--relative", ref, "--", ".")
+	if err != nil {
+		return false, errors.Wrapf(err, "comparing %s with %s", dir, ref)
+	}
+	untracked, err := git(dir, "ls-files", "--others", "--exclude-standard", "--", ".")
+	if err != nil {
+		return false, errors.Wrapf(err, "listing untracked files in %s", dir)
+	}
+	for _, name := range strings.Split(changed+"\n"+untracked, "\n") {
+		if name == "" {
+			continue
+		}
+		if !inNestedModule(dir, filepath.Join(dir, filepath.FromSlash(name))) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// inNestedModule tells whether path,
+// which must be inside the module in dir,
+// is inside a module nested within that one.
+func inNestedModule(dir, path string) bool {
+	dir = filepath.Clean(dir)
+	for d := filepath.Dir(path); d != dir; {
+		if _, err := os.Stat(filepath.Join(d, "go.mod")); err == nil {
+			return true
+		}
+		parent := filepath.Dir(d)
+		if parent == d {
+			break
+		}
+		d = parent
+	}
+	return false
+}
@@ -0,0 +1,327 @@
+package modules
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/bobg/errors"
+	"golang.org/x/mod/modfile"
+	"golang.org/x/tools/go/packages"
+)
+
+// LoadCache is a cache of loaded packages.
+// Set the LoadCache field of a [Walker] to one of these
+// to reuse the results of earlier loads of unchanged modules.
+//
+// Keys are computed by the Walker from the module's directory,
+// its go.mod and go.sum files,
+// the names, sizes, and modification times of the other files in the module
+// and in the directories of its local replacements
+// (replace directives with directory paths),
+// and the settings used for loading,
+// including environment variables that affect the go command
+// (those beginning with GO or CGO_, and a few others such as CC and PATH).
+// Other changes outside the module
+// (such as to the module cache, or to a go.work file)
+// are not detected.
+type LoadCache interface {
+	// Get returns the packages stored under key, if any.
+	// The boolean result is false if there is no entry for key.
+	Get(key string) ([]*packages.Package, bool, error)
+
+	// Put stores pkgs under key.
+	Put(key string, pkgs []*packages.Package) error
+}
+
+// MemoryCache is an in-memory [LoadCache].
+// The zero value is ready to use.
+// It is safe for concurrent use.
+type MemoryCache struct {
+	mu sync.Mutex
+	m  map[string][]*packages.Package
+}
+
+var _ LoadCache = &MemoryCache{}
+
+// Get implements [LoadCache.Get].
+func (c *MemoryCache) Get(key string) ([]*packages.Package, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	pkgs, ok := c.m[key]
+	return pkgs, ok, nil
+}
+
+// Put implements [LoadCache.Put].
+func (c *MemoryCache) Put(key string, pkgs []*packages.Package) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.m == nil {
+		c.m = make(map[string][]*packages.Package)
+	}
+	c.m[key] = pkgs
+	return nil
+}
+
+// DirCache is an on-disk [LoadCache],
+// storing one file per entry in the directory Dir
+// (which is created if necessary).
+//
+// Only package metadata can be stored on disk:
+// names, paths, files, errors, imports, and module information.
+// Packages with type or syntax information are not stored
+// (Put silently does nothing for them),
+// so a DirCache is useful only with a load mode that doesn't request those.
+type DirCache struct {
+	Dir string
+}
+
+var _ LoadCache = DirCache{}
+
+type dirCacheEntry struct {
+	Roots    []string // package IDs
+	Packages []dirCachePackage
+}
+
+type dirCachePackage struct {
+	Package *packages.Package
+	Module  *packages.Module `json:",omitempty"`
+}
+
+// Get implements [LoadCache.Get].
+func (c DirCache) Get(key string) ([]*packages.Package, bool, error) {
+	path := filepath.Join(c.Dir, key+".json")
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, errors.Wrapf(err, "reading %s", path)
+	}
+
+	var entry dirCacheEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, false, errors.Wrapf(err, "decoding %s", path)
+	}
+
+	byID := make(map[string]*packages.Package, len(entry.Packages))
+	for _, p := range entry.Packages {
+		p.Package.Module = p.Module
+		byID[p.Package.ID] = p.Package
+	}
+	for _, pkg := range byID {
+		for path, imp := range pkg.Imports {
+			if resolved, ok := byID[imp.ID]; ok {
+				pkg.Imports[path] = resolved
+			}
+		}
+	}
+
+	roots := make([]*packages.Package, 0, len(entry.Roots))
+	for _, id := range entry.Roots {
+		pkg, ok := byID[id]
+		if !ok {
+			return nil, false, fmt.Errorf("package %s missing from %s", id, path)
+		}
+		roots = append(roots, pkg)
+	}
+
+	return roots, true, nil
+}
+
+// Put implements [LoadCache.Put].
+func (c DirCache) Put(key string, pkgs []*packages.Package) error {
+	var (
+		entry     dirCacheEntry
+		storeable = true
+	)
+	for _, pkg := range pkgs {
+		entry.Roots = append(entry.Roots, pkg.ID)
+	}
+	packages.Visit(pkgs, nil, func(pkg *packages.Package) {
+		if pkg.Types != nil || pkg.Syntax != nil || pkg.TypesInfo != nil {
+			storeable = false
+		}
+		entry.Packages = append(entry.Packages, dirCachePackage{Package: pkg, Module: pkg.Module})
+	})
+	if !storeable {
+		return nil
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return errors.Wrap(err, "encoding cache entry")
+	}
+	if err := os.MkdirAll(c.Dir, 0755); err != nil {
+		return errors.Wrapf(err, "creating %s", c.Dir)
+	}
+
+	// Write to a temp file and rename, so concurrent readers never see a partial entry.
+	tmp, err := os.CreateTemp(c.Dir, key+".*.tmp")
+	if err != nil {
+		return errors.Wrapf(err, "creating temp file in %s", c.Dir)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return errors.Wrapf(err, "writing %s", tmp.Name())
+	}
+	if err := tmp.Close(); err != nil {
+		return errors.Wrapf(err, "closing %s", tmp.Name())
+	}
+	path := filepath.Join(c.Dir, key+".json")
+	return errors.Wrapf(os.Rename(tmp.Name(), path), "renaming %s to %s", tmp.Name(), path)
+}
+
+// cacheKey computes the key under which to cache the result of loading the module in dir
+// with the given config and patterns.
+// If gomod is non-nil,
+// it is used as the contents of the module's go.mod file
+// instead of reading it again.
+func cacheKey(dir string, gomod []byte, conf *packages.Config, patterns []string) (string, error) {
+	h := sha256.New()
+
+	// Loaded packages refer to their files by absolute path,
+	// so copies of a module in different places need different keys.
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", errors.Wrapf(err, "getting absolute path of %s", dir)
+	}
+	fmt.Fprintf(h, "dir %q\n", absDir)
+
+	fmt.Fprintf(h, "mode %d\ntests %v\n", conf.Mode, conf.Tests)
+	for _, p := range patterns {
+		fmt.Fprintf(h, "pattern %q\n", p)
+	}
+	for _, f := range conf.BuildFlags {
+		fmt.Fprintf(h, "flag %q\n", f)
+	}
+	env := conf.Env
+	if env == nil {
+		env = os.Environ()
+	}
+	for _, e := range env {
+		if isGoEnv(e) {
+			fmt.Fprintf(h, "env %q\n", e)
+		}
+	}
+	overlayPaths := make([]string, 0, len(conf.Overlay))
+	for path := range conf.Overlay {
+		overlayPaths = append(overlayPaths, path)
+	}
+	sort.Strings(overlayPaths)
+	for _, path := range overlayPaths {
+		fmt.Fprintf(h, "overlay %q %x\n", path, sha256.Sum256(conf.Overlay[path]))
+	}
+
+	gomodPath := filepath.Join(absDir, "go.mod")
+	if gomod == nil {
+		gomod, err = os.ReadFile(gomodPath)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return "", errors.Wrapf(err, "reading %s", gomodPath)
+		}
+	}
+	fmt.Fprintf(h, "file %q\n", "go.mod")
+	h.Write(gomod)
+	if err := hashFile(h, filepath.Join(absDir, "go.sum")); err != nil {
+		return "", err
+	}
+
+	if err := hashModuleFiles(h, absDir, "file"); err != nil {
+		return "", err
+	}
+
+	// Local replacements are built from source,
+	// so changes to their files change the result too.
+	// A go.mod file that doesn't parse has no usable replacements;
+	// loading will report the error.
+	if mf, err := modfile.Parse(gomodPath, gomod, nil); err == nil {
+		for _, rep := range mf.Replace {
+			if !modfile.IsDirectoryPath(rep.New.Path) {
+				continue
+			}
+			target := rep.New.Path
+			if !filepath.IsAbs(target) {
+				target = filepath.Join(absDir, target)
+			}
+			fmt.Fprintf(h, "replace %q\n", target)
+			if err := hashModuleFiles(h, target, "replacefile"); err != nil {
+				if errors.Is(err, fs.ErrNotExist) {
+					continue // Loading will report the error.
+				}
+				return "", err
+			}
+		}
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// hashModuleFiles writes the names
+// (relative to dir and labeled with label),
+// sizes, and modification times
+// of the files in the module in dir to h.
+func hashModuleFiles(h io.Writer, dir, label string) error {
+	err := walkModuleFiles(dir, func(path string, entry fs.DirEntry) error {
+		info, err := entry.Info()
+		if err != nil {
+			return errors.Wrapf(err, "getting info for %s", path)
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return errors.Wrapf(err, "getting relative path of %s", path)
+		}
+		fmt.Fprintf(h, "%s %q %d %d\n", label, filepath.ToSlash(rel), info.Size(), info.ModTime().UnixNano())
+		return nil
+	})
+	return errors.Wrapf(err, "scanning %s", dir)
+}
+
+// isGoEnv tells whether the environment setting e
+// (of the form NAME=value)
+// can affect what the go command loads.
+// Other settings,
+// such as PWD or a CI system's job ID,
+// are left out of cache keys
+// so they don't needlessly differ from run to run.
+func isGoEnv(e string) bool {
+	name, _, _ := strings.Cut(e, "=")
+	if strings.HasPrefix(name, "GO") || strings.HasPrefix(name, "CGO_") {
+		return true
+	}
+	switch name {
+	case "CC", "CXX", "FC", "AR", "PKG_CONFIG", "HOME", "PATH":
+		// HOME determines the default GOPATH,
+		// and PATH which go command runs.
+		return true
+	}
+	return false
+}
+
+// hashFile writes the contents of the file at path to h.
+// A nonexistent file is not an error.
+func hashFile(h io.Writer, path string) error {
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		fmt.Fprintf(h, "nofile %q\n", filepath.Base(path))
+		return nil
+	}
+	if err != nil {
+		return errors.Wrapf(err, "opening %s", path)
+	}
+	defer f.Close()
+
+	fmt.Fprintf(h, "file %q\n", filepath.Base(path))
+	_, err = io.Copy(h, f)
+	return errors.Wrapf(err, "reading %s", path)
+}
@@ -0,0 +1,85 @@
+package modules
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/bobg/errors"
+)
+
+// ChangedModules reports the Go modules in repoDir and its subdirectories
+// containing files that changed between two git refs.
+// This function calls Walker.ChangedModules with a default Walker.
+func ChangedModules(repoDir, baseRef, headRef string) ([]string, error) {
+	var w Walker
+	return w.ChangedModules(repoDir, baseRef, headRef)
+}
+
+// ChangedModules reports the Go modules in repoDir and its subdirectories
+// containing files that changed between two git refs.
+// The result is a list of module directories
+// (each of which will have repoDir as a prefix)
+// in the order [Walker.Each] visits them.
+//
+// The changed files are those reported by "git diff baseRef...headRef",
+// i.e. the changes on headRef since it diverged from baseRef.
+// Each file is attributed to the innermost module containing it,
+// so a change in a nested module does not mark its parent module as changed.
+// Modules are discovered in the working tree of repoDir,
+// so a module that exists only at baseRef or headRef is not reported.
+func (w *Walker) ChangedModules(repoDir, baseRef, headRef string) ([]string, error) {
+	files, err := changedFiles(repoDir, baseRef, headRef)
+	if err != nil {
+		return nil, err
+	}
+
+	absModuleDirs, err := w.absModuleDirs(repoDir)
+	if err != nil {
+		return nil, err
+	}
+
+	changed := make(map[string]bool)
+	for _, file := range files {
+		if absModuleDir, ok := containingModule(file, absModuleDirs); ok {
+			changed[absModuleDirs[absModuleDir]] = true
+		}
+	}
+
+	var result []string
+	err = w.Each(repoDir, func(subdir string) error {
+		if changed[subdir] {
+			result = append(result, subdir)
+		}
+		return nil
+	})
+	return result, err
+}
+
+// changedFiles returns the absolute paths of the files that changed between baseRef and headRef
+// in the git repository containing dir.
+func changedFiles(dir, baseRef, headRef string) ([]string, error) {
+	// Use --show-cdup rather than --show-toplevel,
+	// since the latter resolves symlinks
+	// and so might not be a prefix of the module directories we find.
+	cdup, err := git(dir, "rev-parse", "--show-cdup")
+	if err != nil {
+		return nil, errors.Wrapf(err, "finding git repository root for %s", dir)
+	}
+	toplevel, err := filepath.Abs(filepath.Join(dir, cdup))
+	if err != nil {
+		return nil, errors.Wrapf(err, "getting absolute path of %s", dir)
+	}
+	out, err := git(dir, "diff", "--name-only", "--no-renames", "-z", baseRef+"..."+headRef)
+	if err != nil {
+		return nil, errors.Wrapf(err, "listing changes between %s and %s", baseRef, headRef)
+	}
+
+	var result []string
+	for _, name := range strings.Split(out, "\x00") {
+		if name == "" {
+			continue
+		}
+		result = append(result, filepath.Join(toplevel, filepath.FromSlash(name)))
+	}
+	return result, nil
+}
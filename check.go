@@ -0,0 +1,146 @@
+package modules
+
+import (
+	"go/token"
+	"path/filepath"
+
+	"golang.org/x/mod/modfile"
+	"golang.org/x/tools/go/packages"
+)
+
+// Severity is the severity of a [Finding].
+type Severity int
+
+const (
+	// SeverityInfo is for findings that are informational only.
+	SeverityInfo Severity = iota + 1
+
+	// SeverityWarning is for findings that should be looked at
+	// but need not fail a build.
+	SeverityWarning
+
+	// SeverityError is for findings that should fail a build.
+	SeverityError
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityInfo:
+		return "info"
+	case SeverityWarning:
+		return "warning"
+	case SeverityError:
+		return "error"
+	}
+	return "unknown"
+}
+
+// Finding is a problem reported by a [Checker].
+type Finding struct {
+	// Checker is the name of the checker reporting the finding.
+	// It is set by [Walker.CheckEach].
+	Checker string
+
+	// Dir is the directory of the module the finding is about.
+	// It is set by [Walker.CheckEach].
+	Dir string
+
+	// Severity is the finding's severity.
+	Severity Severity
+
+	// Position is the location of the problem,
+	// such as a line in a go.mod file or a Go source file.
+	// Its Filename is empty if the finding is about the module as a whole.
+	Position token.Position
+
+	// Message describes the problem.
+	Message string
+}
+
+// Checker is a policy check that can be run on each module in a tree.
+// See [Walker.CheckEach].
+type Checker interface {
+	// Name is the name of the checker,
+	// used to attribute findings.
+	Name() string
+
+	// Check checks a module,
+	// given its loaded packages,
+	// and returns its findings.
+	Check(*Module, []*packages.Package) []Finding
+}
+
+// NewChecker returns a [Checker] with the given name
+// whose Check method calls f.
+func NewChecker(name string, f func(*Module, []*packages.Package) []Finding) Checker {
+	return funcChecker{name: name, f: f}
+}
+
+type funcChecker struct {
+	name string
+	f    func(*Module, []*packages.Package) []Finding
+}
+
+func (c funcChecker) Name() string { return c.name }
+
+func (c funcChecker) Check(m *Module, pkgs []*packages.Package) []Finding {
+	return c.f(m, pkgs)
+}
+
+// CheckEach runs the given checkers on each Go module in dir and its subdirectories.
+// This function calls Walker.CheckEach with a default Walker.
+func CheckEach(dir string, checkers []Checker) ([]Finding, error) {
+	var w Walker
+	return w.CheckEach(dir, checkers)
+}
+
+// CheckEach runs the given checkers on each Go module in dir and its subdirectories,
+// with the packages loaded as with [Walker.LoadEachGomod],
+// and returns all their findings,
+// in the order [Walker.Each] visits the modules
+// and then in the order of checkers.
+// The Checker and Dir fields of each finding are filled in.
+//
+// See [MaxSeverity] for deciding whether the findings should fail a build.
+func (w *Walker) CheckEach(dir string, checkers []Checker) ([]Finding, error) {
+	var result []Finding
+	err := w.LoadEachGomod(dir, func(subdir string, mf *modfile.File, pkgs []*packages.Package) error {
+		m, err := w.newModule(subdir, mf)
+		if err != nil {
+			return err
+		}
+		for _, c := range checkers {
+			for _, finding := range c.Check(m, pkgs) {
+				finding.Checker = c.Name()
+				finding.Dir = subdir
+				result = append(result, finding)
+			}
+		}
+		return nil
+	})
+	return result, err
+}
+
+// MaxSeverity returns the highest severity among findings,
+// or 0 if there are none.
+func MaxSeverity(findings []Finding) Severity {
+	var result Severity
+	for _, finding := range findings {
+		if finding.Severity > result {
+			result = finding.Severity
+		}
+	}
+	return result
+}
+
+// gomodPosition converts pos,
+// a position in the go.mod file of the module in dir,
+// to a position for a [Finding].
+func gomodPosition(dir string, pos modfile.Position) token.Position {
+	return token.Position{
+		Filename: filepath.Join(dir, "go.mod"),
+		Offset:   pos.Byte,
+		Line:     pos.Line,
+		Column:   pos.LineRune,
+	}
+}
@@ -0,0 +1,219 @@
+// Command modules operates on the Go modules in a directory tree.
+//
+// Usage:
+//
+//	modules list [-dir DIR] [-path]
+//	modules graph [-dir DIR] [-dot]
+//	modules exec [-dir DIR] [-k] -- COMMAND [ARG ...]
+//	modules tidy [-dir DIR] [-check]
+//	modules changed [-dir DIR] [-base REF] [-head REF]
+//
+// The list subcommand prints the directory of each module in the tree,
+// and with -path, its module path too.
+//
+// The graph subcommand prints the dependencies among the modules in the tree,
+// one module per line followed by the modules it depends on,
+// or with -dot, as a Graphviz DOT graph.
+//
+// The exec subcommand runs a command in each module's directory,
+// stopping at the first failure unless -k is given.
+//
+// The tidy subcommand runs "go mod tidy" in each module
+// and prints the modules it changed.
+// With -check it changes nothing,
+// prints the modules that are not tidy,
+// and exits with status 1 if there are any.
+//
+// The changed subcommand prints the modules containing files
+// that changed on the head ref since it diverged from the base ref.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+
+	"github.com/bobg/errors"
+	"golang.org/x/mod/modfile"
+
+	"github.com/bobg/modules"
+)
+
+func main() {
+	if err := run(os.Args[1:]); err != nil {
+		var exitErr exitError
+		if errors.As(err, &exitErr) {
+			os.Exit(int(exitErr))
+		}
+		fmt.Fprintf(os.Stderr, "modules: %s\n", err)
+		os.Exit(1)
+	}
+}
+
+// exitError is an error causing a silent exit with the given status.
+type exitError int
+
+func (e exitError) Error() string {
+	return fmt.Sprintf("exit status %d", int(e))
+}
+
+var subcommands = map[string]func(context.Context, []string) error{
+	"list":    doList,
+	"graph":   doGraph,
+	"exec":    doExec,
+	"tidy":    doTidy,
+	"changed": doChanged,
+}
+
+func run(args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: modules list|graph|exec|tidy|changed [flags]")
+	}
+	f, ok := subcommands[args[0]]
+	if !ok {
+		return fmt.Errorf("unknown subcommand %s", args[0])
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	return f(ctx, args[1:])
+}
+
+func doList(_ context.Context, args []string) error {
+	var (
+		fs       = flag.NewFlagSet("list", flag.ContinueOnError)
+		dir      = fs.String("dir", ".", "root of the tree")
+		showPath = fs.Bool("path", false, "also print module paths")
+	)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	return modules.EachGomod(*dir, func(subdir string, mf *modfile.File) error {
+		if !*showPath {
+			fmt.Println(subdir)
+			return nil
+		}
+		var modPath string
+		if mf.Module != nil {
+			modPath = mf.Module.Mod.Path
+		}
+		fmt.Printf("%s\t%s\n", subdir, modPath)
+		return nil
+	})
+}
+
+func doGraph(_ context.Context, args []string) error {
+	var (
+		fs  = flag.NewFlagSet("graph", flag.ContinueOnError)
+		dir = fs.String("dir", ".", "root of the tree")
+		dot = fs.Bool("dot", false, "print in Graphviz DOT format")
+	)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	g, err := modules.BuildModuleGraph(*dir)
+	if err != nil {
+		return err
+	}
+	if *dot {
+		return g.DOT(os.Stdout)
+	}
+	for _, node := range g.Nodes {
+		deps := make([]string, 0, len(node.Deps))
+		for _, dep := range node.Deps {
+			deps = append(deps, dep.Path)
+		}
+		fmt.Printf("%s: %s\n", node.Path, strings.Join(deps, " "))
+	}
+	return nil
+}
+
+func doExec(ctx context.Context, args []string) error {
+	var (
+		fs   = flag.NewFlagSet("exec", flag.ContinueOnError)
+		dir  = fs.String("dir", ".", "root of the tree")
+		keep = fs.Bool("k", false, "keep going after a failure")
+	)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		return errors.New("usage: modules exec [-dir DIR] [-k] -- COMMAND [ARG ...]")
+	}
+
+	var failed bool
+	err := modules.Each(*dir, func(subdir string) error {
+		fmt.Fprintf(os.Stderr, "== %s\n", subdir)
+		cmd := exec.CommandContext(ctx, fs.Arg(0), fs.Args()[1:]...)
+		cmd.Dir = subdir
+		cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+		err := cmd.Run()
+		if err == nil {
+			return nil
+		}
+		if *keep {
+			fmt.Fprintf(os.Stderr, "modules: in %s: %s\n", subdir, err)
+			failed = true
+			return nil
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if failed {
+		return exitError(1)
+	}
+	return nil
+}
+
+func doTidy(ctx context.Context, args []string) error {
+	var (
+		fs    = flag.NewFlagSet("tidy", flag.ContinueOnError)
+		dir   = fs.String("dir", ".", "root of the tree")
+		check = fs.Bool("check", false, "report untidy modules without changing them")
+	)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	dirs, err := modules.TidyEach(ctx, *dir, *check)
+	if err != nil {
+		return err
+	}
+	for _, d := range dirs {
+		fmt.Println(d)
+	}
+	if *check && len(dirs) > 0 {
+		return exitError(1)
+	}
+	return nil
+}
+
+func doChanged(_ context.Context, args []string) error {
+	var (
+		fs   = flag.NewFlagSet("changed", flag.ContinueOnError)
+		dir  = fs.String("dir", ".", "root of the tree")
+		base = fs.String("base", "origin/main", "base git ref")
+		head = fs.String("head", "HEAD", "head git ref")
+	)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	dirs, err := modules.ChangedModules(*dir, *base, *head)
+	if err != nil {
+		return err
+	}
+	for _, d := range dirs {
+		fmt.Println(d)
+	}
+	return nil
+}
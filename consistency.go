@@ -0,0 +1,242 @@
+package modules
+
+import (
+	"path/filepath"
+	"sort"
+
+	"github.com/bobg/errors"
+	"golang.org/x/mod/modfile"
+	"golang.org/x/mod/semver"
+)
+
+// RequireMismatchKind is the kind of a [RequireMismatch].
+type RequireMismatchKind int
+
+const (
+	// RequireMissing means the importing module neither requires nor replaces the imported module.
+	RequireMissing RequireMismatchKind = iota + 1
+
+	// RequireStale means the importing module requires a version of the imported module
+	// older than its latest tagged version,
+	// with no local replace directive pointing to it.
+	RequireStale
+
+	// RequireReplacedElsewhere means the importing module replaces the imported module
+	// with something other than the imported module's directory in the tree.
+	RequireReplacedElsewhere
+)
+
+func (k RequireMismatchKind) String() string {
+	switch k {
+	case RequireMissing:
+		return "missing"
+	case RequireStale:
+		return "stale"
+	case RequireReplacedElsewhere:
+		return "replaced elsewhere"
+	}
+	return "unknown"
+}
+
+// RequireMismatch is a module in a tree that imports packages from another module in the tree
+// without a go.mod file that properly accounts for it.
+// See [Walker.RequireMismatches].
+type RequireMismatch struct {
+	// Dir is the directory of the importing module.
+	Dir string
+
+	// ImportDir and ImportPath are the directory and module path of the imported module.
+	ImportDir, ImportPath string
+
+	// Kind is the kind of mismatch.
+	Kind RequireMismatchKind
+
+	// Required is the version of the imported module required by the importing one,
+	// or the empty string if there is no require directive for it.
+	Required string
+
+	// Latest is the imported module's latest tagged version,
+	// or the empty string if it has none
+	// or is not in a git repository.
+	Latest string
+
+	// Packages are the imported module's packages that the importing module imports,
+	// sorted.
+	Packages []string
+}
+
+// RequireMismatches finds Go modules in dir and its subdirectories
+// that import packages from other modules in the tree
+// without requiring them properly.
+// This function calls Walker.RequireMismatches with a default Walker.
+func RequireMismatches(dir string) ([]RequireMismatch, error) {
+	var w Walker
+	return w.RequireMismatches(dir)
+}
+
+// RequireMismatches finds Go modules in dir and its subdirectories
+// that import packages from other modules in the tree
+// without requiring them properly.
+//
+// When module A imports packages from module B,
+// A's go.mod file should have a local replace directive pointing to B's directory,
+// or else require a published version of B no older than B's latest tagged version
+// (as in [Walker.RecommendBumps]).
+// Otherwise A may build in a workspace,
+// or against stale code,
+// and fail or misbehave once released.
+//
+// The imports are found with [Walker.BuildImportGraph],
+// so an import that can't be resolved at all
+// (as when A neither requires B nor is in a workspace with it)
+// is reported as a load error rather than as a mismatch.
+//
+// The result is sorted by Dir and then by ImportDir.
+func (w *Walker) RequireMismatches(dir string) ([]RequireMismatch, error) {
+	gomods := make(map[string]*modfile.File)
+	err := w.EachGomod(dir, func(subdir string, mf *modfile.File) error {
+		gomods[subdir] = mf
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	g, err := w.BuildImportGraph(dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "building import graph")
+	}
+
+	imported := make(map[[2]string]map[string]bool) // [importer dir, imported dir] -> imported packages
+	for _, n := range g.Nodes {
+		for _, imp := range n.Imports {
+			if imp.ModuleDir == n.ModuleDir {
+				continue
+			}
+			key := [2]string{n.ModuleDir, imp.ModuleDir}
+			if imported[key] == nil {
+				imported[key] = make(map[string]bool)
+			}
+			imported[key][imp.PkgPath] = true
+		}
+	}
+
+	var (
+		result []RequireMismatch
+		latest = make(map[string]string) // module dir -> latest tagged version
+	)
+	for key, pkgs := range imported {
+		importer, importee := gomods[key[0]], gomods[key[1]]
+		if importer == nil || importee == nil || importee.Module == nil {
+			continue
+		}
+		m := RequireMismatch{
+			Dir:        key[0],
+			ImportDir:  key[1],
+			ImportPath: importee.Module.Mod.Path,
+		}
+
+		for _, req := range importer.Require {
+			if req.Mod.Path == m.ImportPath {
+				m.Required = req.Mod.Version
+				break
+			}
+		}
+
+		if rep := findReplace(importer, m.ImportPath, m.Required); rep != nil {
+			ok, err := replacesWithDir(m.Dir, rep, m.ImportDir)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				continue
+			}
+			m.Kind = RequireReplacedElsewhere
+		} else if m.Required == "" {
+			m.Kind = RequireMissing
+		}
+
+		v, ok := latest[m.ImportDir]
+		if !ok {
+			v, err = latestTaggedVersion(m.ImportDir, m.ImportPath)
+			if err != nil {
+				return nil, err
+			}
+			latest[m.ImportDir] = v
+		}
+		m.Latest = v
+
+		if m.Kind == 0 {
+			if m.Latest == "" || semver.Compare(m.Required, m.Latest) >= 0 {
+				continue
+			}
+			m.Kind = RequireStale
+		}
+
+		for pkg := range pkgs {
+			m.Packages = append(m.Packages, pkg)
+		}
+		sort.Strings(m.Packages)
+		result = append(result, m)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Dir != result[j].Dir {
+			return result[i].Dir < result[j].Dir
+		}
+		return result[i].ImportDir < result[j].ImportDir
+	})
+	return result, nil
+}
+
+// findReplace finds the replace directive in mf that applies to the module with the given path and version.
+func findReplace(mf *modfile.File, path, version string) *modfile.Replace {
+	var result *modfile.Replace
+	for _, rep := range mf.Replace {
+		if rep.Old.Path != path {
+			continue
+		}
+		if rep.Old.Version == version {
+			return rep // A version-specific replacement takes precedence.
+		}
+		if rep.Old.Version == "" {
+			result = rep
+		}
+	}
+	return result
+}
+
+// replacesWithDir tells whether rep,
+// from the go.mod file in the directory modDir,
+// points to the directory target.
+func replacesWithDir(modDir string, rep *modfile.Replace, target string) (bool, error) {
+	if !modfile.IsDirectoryPath(rep.New.Path) {
+		return false, nil
+	}
+	newDir := rep.New.Path
+	if !filepath.IsAbs(newDir) {
+		newDir = filepath.Join(modDir, newDir)
+	}
+	newDir, err := filepath.Abs(newDir)
+	if err != nil {
+		return false, errors.Wrapf(err, "getting absolute path of %s", rep.New.Path)
+	}
+	target, err = filepath.Abs(target)
+	if err != nil {
+		return false, errors.Wrapf(err, "getting absolute path of %s", target)
+	}
+	return newDir == target, nil
+}
+
+// latestTaggedVersion returns the latest tagged version of the module in dir with the given module path,
+// or the empty string if it has none or is not in a git repository.
+func latestTaggedVersion(dir, modpath string) (string, error) {
+	if _, err := git(dir, "rev-parse", "--git-dir"); err != nil {
+		return "", nil
+	}
+	major, err := modulePathMajor(modpath)
+	if err != nil {
+		return "", err
+	}
+	return latestModuleVersion(dir, major, "HEAD")
+}
@@ -0,0 +1,128 @@
+package modules
+
+// CycleCheck finds cycles of dependencies among the Go modules in dir and its subdirectories.
+// This function calls Walker.CycleCheck with a default Walker.
+func CycleCheck(dir string) ([]*CycleError, error) {
+	var w Walker
+	return w.CycleCheck(dir)
+}
+
+// CycleCheck finds cycles of dependencies among the Go modules in dir and its subdirectories,
+// as reported by [Graph.Cycles].
+// The graph is built as with [Walker.BuildModuleGraph],
+// but dependencies from package imports are always included,
+// regardless of w.GraphImports,
+// since those are the ones go.mod files most often miss.
+//
+// Modules in a cycle cannot be tagged and released independently of one another.
+// The result is empty if there are no cycles.
+func (w *Walker) CycleCheck(dir string) ([]*CycleError, error) {
+	ww := *w
+	ww.GraphImports = true
+	g, err := ww.BuildModuleGraph(dir)
+	if err != nil {
+		return nil, err
+	}
+	return g.Cycles(), nil
+}
+
+// Cycles finds the cycles in g.
+// There is one result for each set of modules that all (transitively) depend on one another
+// (a strongly connected component of the graph),
+// showing a shortest cycle through the first of those modules in the order of g.Nodes.
+// Other cycles among the same modules are not reported separately.
+// The results are in the order of g.Nodes of their first modules.
+func (g *Graph) Cycles() []*CycleError {
+	var (
+		index   = make(map[*ModuleNode]int)
+		lowlink = make(map[*ModuleNode]int)
+		onStack = make(map[*ModuleNode]bool)
+		stack   []*ModuleNode
+		comp    = make(map[*ModuleNode]int)
+		ncomps  int
+		visit   func(*ModuleNode)
+	)
+
+	// Tarjan's algorithm for strongly connected components.
+	visit = func(node *ModuleNode) {
+		index[node] = len(index)
+		lowlink[node] = index[node]
+		stack = append(stack, node)
+		onStack[node] = true
+
+		for _, dep := range node.Deps {
+			if _, ok := index[dep]; !ok {
+				visit(dep)
+				if lowlink[dep] < lowlink[node] {
+					lowlink[node] = lowlink[dep]
+				}
+			} else if onStack[dep] && index[dep] < lowlink[node] {
+				lowlink[node] = index[dep]
+			}
+		}
+
+		if lowlink[node] != index[node] {
+			return
+		}
+		for {
+			n := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			onStack[n] = false
+			comp[n] = ncomps
+			if n == node {
+				break
+			}
+		}
+		ncomps++
+	}
+	for _, node := range g.Nodes {
+		if _, ok := index[node]; !ok {
+			visit(node)
+		}
+	}
+
+	var (
+		result []*CycleError
+		seen   = make(map[int]bool)
+	)
+	for _, node := range g.Nodes {
+		c := comp[node]
+		if seen[c] {
+			continue
+		}
+		seen[c] = true
+		if cycle := shortestCycle(node, func(n *ModuleNode) bool { return comp[n] == c }); cycle != nil {
+			result = append(result, &CycleError{Cycle: cycle})
+		}
+	}
+	return result
+}
+
+// shortestCycle finds a shortest cycle from start back to itself,
+// following Deps edges through nodes satisfying within,
+// returning nil if there is none.
+func shortestCycle(start *ModuleNode, within func(*ModuleNode) bool) []*ModuleNode {
+	var (
+		prev  = map[*ModuleNode]*ModuleNode{start: nil}
+		queue = []*ModuleNode{start}
+	)
+	for len(queue) > 0 {
+		node := queue[0]
+		queue = queue[1:]
+		for _, dep := range node.Deps {
+			if dep == start {
+				var cycle []*ModuleNode
+				for n := node; n != nil; n = prev[n] {
+					cycle = append([]*ModuleNode{n}, cycle...)
+				}
+				return cycle
+			}
+			if _, ok := prev[dep]; ok || !within(dep) {
+				continue
+			}
+			prev[dep] = node
+			queue = append(queue, dep)
+		}
+	}
+	return nil
+}
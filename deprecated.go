@@ -0,0 +1,194 @@
+package modules
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/bobg/errors"
+	"golang.org/x/mod/modfile"
+	"golang.org/x/mod/module"
+	"golang.org/x/tools/go/packages"
+)
+
+// DeprecatedDependency is a deprecated module
+// that modules in a tree require.
+// See [Walker.DeprecatedEach].
+type DeprecatedDependency struct {
+	// Path is the deprecated module's path.
+	Path string
+
+	// Message is the text of the deprecation notice,
+	// from the "// Deprecated:" comment in the module's latest go.mod file.
+	Message string
+
+	// Suggestion is the module path that Message appears to recommend instead,
+	// or the empty string if it names none.
+	Suggestion string
+
+	// Requires are the require directives for the module,
+	// in the order [Walker.Each] visits the requiring modules.
+	Requires []DeprecatedRequire
+}
+
+// DeprecatedRequire is a require directive for a deprecated module.
+// See [DeprecatedDependency].
+type DeprecatedRequire struct {
+	// Dir is the directory of the requiring module.
+	Dir string
+
+	// Version is the required version.
+	Version string
+
+	// Indirect tells whether the require directive is marked "// indirect".
+	Indirect bool
+
+	// Pos is the position of the require directive in the go.mod file.
+	Pos modfile.Position
+}
+
+// DeprecatedEach finds deprecated modules required by the Go modules in dir and its subdirectories.
+// This function calls Walker.DeprecatedEach with a default Walker.
+func DeprecatedEach(ctx context.Context, dir string) ([]DeprecatedDependency, error) {
+	var w Walker
+	return w.DeprecatedEach(ctx, dir)
+}
+
+// DeprecatedEach finds deprecated modules required by the Go modules in dir and its subdirectories,
+// sorted by module path.
+//
+// Deprecations are found with "go list -m -u",
+// which queries the module proxy given by GOPROXY
+// (see [Walker.Env])
+// for the latest go.mod file of each required module.
+// Requires that are replaced with a local directory are skipped.
+// Each module is queried outside of any workspace.
+func (w *Walker) DeprecatedEach(ctx context.Context, dir string) ([]DeprecatedDependency, error) {
+	w2 := *w
+	w2.GOWORK = "off"
+
+	byPath := make(map[string]*DeprecatedDependency)
+	err := w.EachGomod(dir, func(subdir string, mf *modfile.File) error {
+		deps, err := w2.deprecatedRequires(ctx, subdir, mf)
+		if err != nil {
+			return errors.Wrapf(err, "checking %s", subdir)
+		}
+		for _, dep := range deps {
+			if d, ok := byPath[dep.Path]; ok {
+				d.Requires = append(d.Requires, dep.Requires...)
+			} else {
+				dep := dep
+				byPath[dep.Path] = &dep
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]DeprecatedDependency, 0, len(byPath))
+	for _, d := range byPath {
+		result = append(result, *d)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Path < result[j].Path })
+	return result, nil
+}
+
+// DeprecatedChecker returns a [Checker] reporting the requires of deprecated modules found by [Walker.DeprecatedEach]
+// as warnings,
+// positioned at the require directives.
+// The context is used when querying the module proxy.
+func (w *Walker) DeprecatedChecker(ctx context.Context) Checker {
+	w2 := *w
+	w2.GOWORK = "off"
+
+	return NewChecker("deprecated", func(m *Module, _ []*packages.Package) []Finding {
+		deps, err := w2.deprecatedRequires(ctx, m.Dir, m.Gomod)
+		if err != nil {
+			return []Finding{{Severity: SeverityError, Message: err.Error()}}
+		}
+		var result []Finding
+		for _, d := range deps {
+			for _, r := range d.Requires {
+				result = append(result, Finding{
+					Severity: SeverityWarning,
+					Position: gomodPosition(m.Dir, r.Pos),
+					Message:  d.Path + " is deprecated: " + d.Message,
+				})
+			}
+		}
+		return result
+	})
+}
+
+// deprecatedRequires finds the deprecated modules required by go.mod file mf of the module in dir,
+// each with a single entry in Requires.
+func (w *Walker) deprecatedRequires(ctx context.Context, dir string, mf *modfile.File) ([]DeprecatedDependency, error) {
+	var (
+		reqs []*modfile.Require
+		args = []string{"list", "-m", "-e", "-u", "-json"}
+	)
+	for _, req := range mf.Require {
+		if rep := findReplace(mf, req.Mod.Path, req.Mod.Version); rep != nil && modfile.IsDirectoryPath(rep.New.Path) {
+			continue
+		}
+		reqs = append(reqs, req)
+		args = append(args, req.Mod.Path)
+	}
+	if len(reqs) == 0 {
+		return nil, nil
+	}
+
+	out, err := w.goCmdContext(ctx, dir, args...)
+	if err != nil {
+		return nil, err
+	}
+	listed, err := decodeListedModules(out)
+	if err != nil {
+		return nil, err
+	}
+	deprecated := make(map[string]string)
+	for _, m := range listed {
+		if m.Deprecated != "" {
+			deprecated[m.Path] = m.Deprecated
+		}
+	}
+
+	var result []DeprecatedDependency
+	for _, req := range reqs {
+		msg, ok := deprecated[req.Mod.Path]
+		if !ok {
+			continue
+		}
+		r := DeprecatedRequire{Dir: dir, Version: req.Mod.Version, Indirect: req.Indirect}
+		if req.Syntax != nil {
+			r.Pos = req.Syntax.Start
+		}
+		result = append(result, DeprecatedDependency{
+			Path:       req.Mod.Path,
+			Message:    msg,
+			Suggestion: deprecationSuggestion(msg, req.Mod.Path),
+			Requires:   []DeprecatedRequire{r},
+		})
+	}
+	return result, nil
+}
+
+// deprecationSuggestion finds the first word in the deprecation message msg
+// that is a valid module path other than modpath,
+// returning the empty string if there is none.
+// This is often the recommended replacement,
+// as in `Use "google.golang.org/protobuf" instead.`
+func deprecationSuggestion(msg, modpath string) string {
+	for _, word := range strings.Fields(msg) {
+		word = strings.Trim(word, "\"'`()[]{}<>,.;:!?")
+		if word == modpath || !strings.Contains(word, "/") {
+			continue
+		}
+		if err := module.CheckPath(word); err == nil {
+			return word
+		}
+	}
+	return ""
+}
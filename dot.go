@@ -0,0 +1,52 @@
+package modules
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/bobg/errors"
+)
+
+// DOT writes the graph to w in the DOT language of Graphviz.
+// Nodes are labeled using g.Label,
+// or with their module paths if that is nil.
+func (g *Graph) DOT(w io.Writer) error {
+	label := g.Label
+	if label == nil {
+		label = ModulePathLabel
+	}
+
+	ids := make(map[*ModuleNode]string, len(g.Nodes))
+	for i, node := range g.Nodes {
+		ids[node] = fmt.Sprintf("n%d", i)
+	}
+
+	buf := new(bytes.Buffer)
+	fmt.Fprintln(buf, "digraph modules {")
+	for _, node := range g.Nodes {
+		fmt.Fprintf(buf, "  %s [label=%s];\n", ids[node], strconv.Quote(label(node)))
+	}
+	for _, node := range g.Nodes {
+		for _, dep := range node.Deps {
+			fmt.Fprintf(buf, "  %s -> %s;\n", ids[node], ids[dep])
+		}
+	}
+	fmt.Fprintln(buf, "}")
+
+	_, err := w.Write(buf.Bytes())
+	return errors.Wrap(err, "writing DOT output")
+}
+
+// ModulePathLabel labels a graph node with its module path.
+// It is suitable for use as [Graph.Label].
+func ModulePathLabel(node *ModuleNode) string {
+	return node.Path
+}
+
+// ModuleDirLabel labels a graph node with its directory.
+// It is suitable for use as [Graph.Label].
+func ModuleDirLabel(node *ModuleNode) string {
+	return node.Dir
+}
@@ -2,11 +2,13 @@ package modules
 
 import (
 	"fmt"
-	"io/fs"
+	"log/slog"
 	"os"
 	"path/filepath"
 	"reflect"
+	"slices"
 	"strings"
+	"time"
 
 	"github.com/bobg/errors"
 	"golang.org/x/mod/modfile"
@@ -33,6 +35,7 @@ type Walker struct {
 	IncludeTestdata bool
 
 	// The following fields are used by [EachGomod] and [LoadEachGomod].
+	// VersionFixer is also used by [EachGowork].
 
 	// ParseLax controls whether to use [modfile.ParseLax] instead of [modfile.Parse].
 	ParseLax bool // Use [modfile.ParseLax] to parse go.mod files instead of [modfile.Parse].
@@ -40,6 +43,11 @@ type Walker struct {
 	// VersionFixer is a function that can be used to fix version strings in go.mod files.
 	VersionFixer modfile.VersionFixer // Use this version-string fixing function when parsing go.mod files.
 
+	// GraphImports controls whether [Walker.BuildModuleGraph] also adds edges
+	// for imports between packages in different modules,
+	// in addition to edges derived from go.mod files.
+	GraphImports bool
+
 	// The following fields are used by [LoadEach] and [LoadEachGomod].
 
 	// This is the config to pass to [packages.Load]
@@ -48,13 +56,213 @@ type Walker struct {
 	// a default value of [DefaultLoadConfig] is used.
 	// If this is not the zero config but LoadConfig.Mode is zero,
 	// a default value of [DefaultLoadMode] is used.
-	// The Dir field of the config is set to the directory passed to [Walker.LoadEach] or [Walker.LoadEachGomod].
+	// The Dir field of the config is set to the directory of each module as it is loaded.
 	LoadConfig packages.Config
 
 	// FailOnPackageErrors controls whether to return an error if any package fails to load.
 	FailOnPackageErrors bool
+
+	// FailOn, if non-empty,
+	// is used instead of FailOnPackageErrors
+	// to decide whether to return an error when packages fail to load.
+	// Only package errors of the listed kinds cause a failure.
+	// For example, to tolerate type errors but not errors from go list or the parser,
+	// set this to []packages.ErrorKind{packages.ListError, packages.ParseError}.
+	FailOn []packages.ErrorKind
+
+	// LoadTests controls whether to include test packages when loading.
+	// If true, the Tests field of the [packages.Config] is set to true,
+	// so that _test.go files and external test packages are loaded too.
+	LoadTests bool
+
+	// BuildFlags is a list of build flags,
+	// such as "-tags=integration",
+	// to add to the BuildFlags field of the [packages.Config] used when loading.
+	BuildFlags []string
+
+	// Overlay maps absolute file paths to file contents
+	// that are used in place of what is on disk when loading packages.
+	// This lets callers analyze modules with in-memory modifications,
+	// such as unsaved editor buffers.
+	// See the Overlay field of [packages.Config].
+	// Entries here take precedence over those in LoadConfig.Overlay.
+	Overlay map[string][]byte
+
+	// SkipEmptyModules controls whether to skip loading modules that contain no buildable Go files.
+	// Such modules (placeholders, modules containing only protobuf definitions, etc.)
+	// are still passed to the callback,
+	// but with no packages,
+	// and without the cost of a call to [packages.Load].
+	// Test files count as buildable only if LoadTests is true.
+	SkipEmptyModules bool
+
+	// FastTypes controls whether to type-check only the packages in each module from source,
+	// getting type information for their dependencies from compiler export data instead.
+	// This can make type-based analyses much faster
+	// when they need syntax trees only for the module's own packages.
+	// It works by removing [packages.NeedDeps] from the load mode,
+	// so the Imports of loaded packages are only partially populated:
+	// they have types but no syntax.
+	FastTypes bool
+
+	// LoadCache, if non-nil,
+	// is used to reuse the results of earlier package loads
+	// for modules that have not changed.
+	// See [MemoryCache] and [DirCache].
+	LoadCache LoadCache
+
+	// LoadPatterns is the list of patterns to pass to [packages.Load]
+	// when loading each module.
+	// Patterns are interpreted relative to the module's directory.
+	// If this is empty,
+	// a default of "./..." is used.
+	LoadPatterns []string
+
+	// PatternsFor, if non-nil,
+	// is called with the directory of each module to get the patterns to load for that module.
+	// If it returns an empty list,
+	// LoadPatterns (or its default) is used instead.
+	PatternsFor func(dir string) []string
+
+	// Env is a list of environment variable settings, in "KEY=value" form,
+	// to add to the environment used when loading packages.
+	// These are appended to LoadConfig.Env
+	// (or to the current process's environment, if LoadConfig.Env is nil),
+	// so they take precedence over settings there.
+	Env []string
+
+	// GOFLAGS, if non-empty, is the value of the GOFLAGS environment variable to use when loading packages.
+	// It takes precedence over any GOFLAGS setting in Env.
+	GOFLAGS string
+
+	// GOWORK, if non-empty, is the value of the GOWORK environment variable to use when loading packages.
+	// Set it to "off" to disable workspace mode.
+	// It takes precedence over any GOWORK setting in Env.
+	GOWORK string
+
+	// RequireModules controls whether walking a tree that contains no Go modules is an error.
+	// If true,
+	// [Walker.Each] and the methods that use it
+	// return an error wrapping [ErrNoModules]
+	// when they find no go.mod file.
+	RequireModules bool
+
+	// Links controls whether to walk into symbolic links to directories,
+	// and on Windows,
+	// junctions and other reparse points.
+	// The zero value means [LinkSkip].
+	// This does not affect [Walker.Watch].
+	Links LinkPolicy
+
+	// NoIgnoreFiles controls whether to disregard [IgnoreFileName] files,
+	// which otherwise list directories for the walk to skip.
+	NoIgnoreFiles bool
+
+	// GomodCache, if non-nil,
+	// is used to reuse parsed go.mod files
+	// from earlier walks by this or other Walkers
+	// when the files have not changed.
+	// Parsed files from the cache are shared,
+	// so callbacks receiving them,
+	// such as those of [Walker.EachGomod],
+	// must not modify them.
+	// Methods that rewrite go.mod files do not use the cache.
+	GomodCache *GomodCache
+
+	// GomodEdits controls how methods that rewrite go.mod files,
+	// such as [Walker.RenameModule] and [Walker.ApplyUpdates],
+	// lay out their changes.
+	GomodEdits GomodEditOptions
+
+	// Limit, if positive,
+	// is the maximum number of modules [Walker.Each] and the methods that use it visit.
+	// The walk stops once that many have been found.
+	Limit int
+
+	// Logger, if non-nil,
+	// receives messages about what the Walker does:
+	// at [LevelTrace], each directory visited;
+	// at [slog.LevelDebug], each directory skipped and why,
+	// each module found,
+	// each go.mod file parsed and how long it took,
+	// and each call to [packages.Load] or the go command and how long it took.
+	Logger *slog.Logger
+
+	// Tracer, if non-nil,
+	// receives a span for each directory read,
+	// each go.mod file parsed,
+	// and each module's packages loaded.
+	Tracer Tracer
+
+	// Metrics, if non-nil,
+	// is told how long each walk,
+	// go.mod parse,
+	// and package load takes.
+	Metrics Metrics
+
+	// ScanConcurrency, if greater than 1,
+	// is the number of directories to scan at once when walking a tree.
+	// This can speed up walks on slow filesystems,
+	// such as network filesystems.
+	// Callbacks are still called one at a time
+	// and in the same order,
+	// but directories may be scanned ahead of the callbacks,
+	// including some that a callback's [filepath.SkipDir] or [filepath.SkipAll] then skips.
+	// When following links (see [Walker.Links]),
+	// which of several paths to the same directory is visited may vary.
+	ScanConcurrency int
+
+	// Concurrency is the number of modules to work on at once
+	// in methods that can handle several modules in parallel,
+	// such as [Walker.VendorEach] and [MapEach].
+	// If it is zero or negative,
+	// one module is handled at a time.
+	Concurrency int
+
+	// Submodules says whether to walk into git submodule checkouts
+	// (below the root of the walk).
+	// The default is [SubmoduleEnter].
+	// Modules found in submodules are marked as such in [Visit] and [IndexModule].
+	Submodules SubmodulePolicy
+
+	// GitMetadata, if true,
+	// adds information about the last git commit affecting each module
+	// to the [Module] values produced by
+	// [Walker.CollectGomods], [Walker.BuildModuleGraph], and [Walker.CheckEach].
+	// This runs git several times per module.
+	GitMetadata bool
+
+	// SkipNonGoDirs, if true,
+	// skips directories named in [NonGoDirs],
+	// which are unlikely to contain Go modules
+	// and may be large.
+	SkipNonGoDirs bool
+
+	// PruneLeaves, if true,
+	// avoids reading directories that have no subdirectories,
+	// where the filesystem makes that cheap to tell,
+	// checking them only for a go.mod file.
+	// This can speed up walks of trees with many large leaf directories.
+	// It relies on the link counts of directories,
+	// which some filesystems,
+	// and some platforms,
+	// do not report in the usual Unix way;
+	// then it has no effect.
+	// It also has no effect when Links is LinkFollow,
+	// since a directory whose only subdirectories are symlinks
+	// looks like a leaf.
+	PruneLeaves bool
+
+	// Pipeline controls whether and how [Walker.LoadEach] and [Walker.LoadEachGomod]
+	// overlap finding modules with loading their packages.
+	// By default they do not.
+	Pipeline PipelineOptions
 }
 
+// NonGoDirs are the names of directories skipped by a [Walker] whose SkipNonGoDirs field is true.
+// They hold the dependencies and outputs of other languages' build tools.
+var NonGoDirs = []string{"node_modules", ".terraform", "target"}
+
 var zeroLoadConfig packages.Config
 
 // DefaultLoadMode is the default value for the Mode field of the [packages.Config] used by [Walker.LoadEach] and [Walker.LoadEachGomod].
@@ -67,57 +275,151 @@ var DefaultLoadConfig = packages.Config{Mode: DefaultLoadMode}
 // A Go module is identified by the presence of a go.mod file.
 // The arguments to f is the directory containing the go.mod file,
 // which will have dir as a prefix.
+//
+// An error from f is returned as a [WalkError]
+// whose Dir is the module directory.
+// If w.Limit is positive,
+// the walk stops after that many modules.
+// If w.RequireModules is true
+// and the walk finds no go.mod file,
+// the result is an error wrapping [ErrNoModules].
 func (w *Walker) Each(dir string, f func(string) error) error {
-	err := w.each(dir, f)
+	if !w.RequireModules && w.Limit <= 0 {
+		return w.eachFile(dir, "go.mod", f)
+	}
+
+	var found int
+	err := w.eachFile(dir, "go.mod", func(subdir string) error {
+		found++
+		if err := f(subdir); err != nil {
+			return err
+		}
+		if w.Limit > 0 && found >= w.Limit {
+			return filepath.SkipAll
+		}
+		return nil
+	})
+	if err == nil && found == 0 && w.RequireModules {
+		return WalkError{Dir: dir, Op: "walking", Err: ErrNoModules}
+	}
+	return err
+}
+
+// ErrNoModules is the error wrapped by [Walker.Each] and the methods that use it
+// when [Walker.RequireModules] is true
+// and no Go module is found.
+var ErrNoModules = errors.New("no Go modules found")
+
+// eachFile calls f for each directory in dir and its subdirectories
+// containing a file with the given name.
+func (w *Walker) eachFile(dir, name string, f func(string) error) (err error) {
+	if w.Metrics != nil {
+		start := time.Now()
+		defer func() { w.Metrics.ObserveWalk(dir, time.Since(start), err) }()
+	}
+
+	ws := w.newWalkState(dir)
+	if w.ScanConcurrency > 1 {
+		err = w.eachParallel(ws, dir, name, f)
+	} else {
+		err = w.each(ws, dir, name, f)
+	}
 	if errors.Is(err, filepath.SkipAll) {
 		return nil
 	}
 	return err
 }
 
-func (w *Walker) each(dir string, f func(string) error) error {
-	gomodPath := filepath.Join(dir, "go.mod")
-	_, err := os.Stat(gomodPath)
-	switch {
-	case errors.Is(err, fs.ErrNotExist):
-		// no go.mod, skip
-	case err != nil:
-		return errors.Wrapf(err, "statting %s", gomodPath)
-	default:
+func (w *Walker) each(ws *walkState, dir, filename string, f func(string) error) error {
+	if first, err := ws.firstVisit(dir); err != nil {
+		return WalkError{Dir: dir, Op: "visiting", Err: err}
+	} else if !first {
+		w.logRevisit(dir)
+		return nil
+	}
+	w.log(LevelTrace, "visiting directory", "dir", dir)
+
+	found, entries, readErr := w.subdirs(ws, dir, filename)
+	if readErr != nil {
+		// Still call f if dir contains filename.
+		var err error
+		if found, err = hasFile(dir, filename); err != nil {
+			return err
+		}
+	}
+	if found {
+		w.log(slog.LevelDebug, "found "+filename, "dir", dir)
 		err := f(dir)
 		switch {
 		case errors.Is(err, filepath.SkipDir):
 			return nil
-		case err != nil: // including filepath.SkipAll, which gets filtered out in Walker.Each.
-			return errors.Wrapf(err, "in %s", dir)
+		case errors.Is(err, filepath.SkipAll):
+			return err // Filtered out in Walker.eachFile.
+		case err != nil:
+			return visitError(dir, err)
 		}
 	}
 
-	entries, err := os.ReadDir(dir)
-	if err != nil {
-		return errors.Wrapf(err, "reading directory %s", dir)
+	if readErr != nil {
+		return WalkError{Dir: dir, Op: "reading directory", Err: readErr}
 	}
 
 	for _, entry := range entries {
-		if !entry.IsDir() {
-			continue
+		if err := w.each(ws, filepath.Join(dir, entry.Name()), filename, f); err != nil {
+			return err
 		}
-		name := entry.Name()
-		if strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_") {
-			continue
+	}
+
+	return nil
+}
+
+// skipDir tells whether w skips the subdirectory dir when walking a tree,
+// given the tree's ignorer
+// (see [IgnoreFileName]),
+// logging the reason if so.
+func (w *Walker) skipDir(ig *ignorer, dir string) (bool, error) {
+	reason := w.skipReason(filepath.Base(dir))
+	if reason == "" {
+		ignored, err := ig.ignored(dir)
+		if err != nil {
+			return false, err
 		}
-		if !w.IncludeVendor && name == "vendor" { // TODO: also check for vendor/modules.txt?
-			continue
+		if ignored {
+			reason = IgnoreFileName
 		}
-		if !w.IncludeTestdata && name == "testdata" {
-			continue
+	}
+	if reason == "" && w.Submodules == SubmoduleSkip {
+		sub, err := isSubmodule(dir)
+		if err != nil {
+			return false, err
 		}
-		if err := w.each(filepath.Join(dir, entry.Name()), f); err != nil {
-			return err
+		if sub {
+			reason = "git submodule"
 		}
 	}
+	if reason == "" {
+		return false, nil
+	}
+	w.log(slog.LevelDebug, "skipping directory", "dir", dir, "reason", reason)
+	return true, nil
+}
 
-	return nil
+// skipReason tells why w skips subdirectories with the given name when walking a tree,
+// or returns the empty string if it doesn't.
+func (w *Walker) skipReason(name string) string {
+	switch {
+	case strings.HasPrefix(name, "."):
+		return "hidden"
+	case strings.HasPrefix(name, "_"):
+		return "underscore prefix"
+	case !w.IncludeVendor && name == "vendor": // TODO: also check for vendor/modules.txt?
+		return "vendor directory"
+	case !w.IncludeTestdata && name == "testdata":
+		return "testdata directory"
+	case w.SkipNonGoDirs && slices.Contains(NonGoDirs, name):
+		return "non-Go directory"
+	}
+	return ""
 }
 
 // EachGomod calls f for each Go module in dir and its subdirectories.
@@ -143,23 +445,73 @@ func (w *Walker) EachGomod(dir string, f func(string, *modfile.File) error) erro
 }
 
 func (w *Walker) withGomod(dir, subdir string, f func(string, *modfile.File) error) error {
-	gomodPath := filepath.Join(subdir, "go.mod")
-	data, err := os.ReadFile(gomodPath)
+	_, mf, err := w.readGomod(subdir)
+	if err != nil {
+		return err
+	}
+	return f(subdir, mf)
+}
+
+// readGomod reads and parses the go.mod file in dir,
+// returning both its contents and the parsed result.
+func (w *Walker) readGomod(dir string) (data []byte, mf *modfile.File, err error) {
+	end := w.startSpan(SpanParse, slog.String("dir", dir))
+	defer func() { end(err) }()
+
+	gomodPath := filepath.Join(dir, "go.mod")
+
+	var info os.FileInfo
+	if w.GomodCache != nil {
+		info, err = os.Stat(gomodPath)
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "statting %s", gomodPath)
+		}
+		if data, mf, ok := w.GomodCache.get(gomodPath, w.ParseLax, info); ok {
+			w.log(LevelTrace, "using cached go.mod", "dir", dir)
+			return data, mf, nil
+		}
+	}
+
+	data, err = os.ReadFile(gomodPath)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "reading %s", gomodPath)
+	}
+
+	start := time.Now()
+	mf, err = w.parseGomod(gomodPath, data)
+	elapsed := time.Since(start)
+	if w.Metrics != nil {
+		w.Metrics.ObserveParse(dir, elapsed, err)
+	}
 	if err != nil {
-		return errors.Wrapf(err, "reading %s", gomodPath)
+		return nil, nil, err
+	}
+	w.log(slog.LevelDebug, "parsed go.mod", "dir", dir, "duration", elapsed)
+
+	if w.GomodCache != nil {
+		w.GomodCache.put(gomodPath, w.ParseLax, info, data, mf)
 	}
 
-	var mf *modfile.File
+	return data, mf, nil
+}
+
+// parseGomod parses data,
+// the contents of the go.mod file at gomodPath,
+// according to w.ParseLax and w.VersionFixer.
+func (w *Walker) parseGomod(gomodPath string, data []byte) (*modfile.File, error) {
+	var (
+		mf  *modfile.File
+		err error
+	)
 	if w.ParseLax {
 		mf, err = modfile.ParseLax(gomodPath, data, w.VersionFixer)
 	} else {
 		mf, err = modfile.Parse(gomodPath, data, w.VersionFixer)
 	}
 	if err != nil {
-		return errors.Wrapf(err, "parsing %s", gomodPath)
+		return nil, ParseError{GomodPath: gomodPath, Err: err}
 	}
-
-	return f(subdir, mf)
+	return mf, nil
 }
 
 // LoadEach calls f once for each Go module in dir and its subdirectories,
@@ -177,11 +529,162 @@ func LoadEach(dir string, f func(string, []*packages.Package) error) error {
 // (which will have dir as a prefix)
 // and a slice of [packages.Package] values loaded from that directory
 // using the [packages.Load] function.
+// By default the packages loaded are those matching "./...";
+// you can change this with w.LoadPatterns and w.PatternsFor.
 // You can specify how loading is done by modifying w.LoadConfig.
 // If w.LoadConfig is the zero value, a default value of [DefaultLoadConfig] is used.
 // If w.LoadConfig is not the zero value but LoadConfig.Mode is zero,
 // a default value of [DefaultLoadMode] is used.
+// See w.Pipeline for loading several modules at once.
 func (w *Walker) LoadEach(dir string, f func(string, []*packages.Package) error) error {
+	return w.loadEach(dir, 0, f)
+}
+
+// loadEach is the implementation of LoadEach.
+// The load mode used is the one LoadEach would use,
+// plus any bits in mode.
+// Analyses in this package use this to ensure they get the information they need
+// regardless of how w.LoadConfig is set.
+func (w *Walker) loadEach(dir string, mode packages.LoadMode, f func(string, []*packages.Package) error) error {
+	if w.Pipeline.enabled() {
+		return w.pipeline(dir, mode, false, func(subdir string, _ *modfile.File, pkgs []*packages.Package) error {
+			return f(subdir, pkgs)
+		})
+	}
+	return w.Each(dir, func(subdir string) error {
+		pkgs, err := w.load(subdir, mode)
+		if err != nil {
+			return err
+		}
+		return f(subdir, pkgs)
+	})
+}
+
+// load loads the packages of the module in dir.
+// The load mode is the one LoadEach would use,
+// plus any bits in mode.
+// Any extraEnv settings are added to the environment last,
+// taking precedence over all others.
+func (w *Walker) load(dir string, mode packages.LoadMode, extraEnv ...string) ([]*packages.Package, error) {
+	return w.loadWithGomod(dir, nil, mode, extraEnv...)
+}
+
+// loadWithGomod is like load,
+// but takes the contents of the module's go.mod file,
+// if the caller has already read it,
+// so it is not read again.
+func (w *Walker) loadWithGomod(dir string, gomod []byte, mode packages.LoadMode, extraEnv ...string) (pkgs []*packages.Package, err error) {
+	end := w.startSpan(SpanLoad, slog.String("dir", dir))
+	defer func() { end(err) }()
+
+	if w.SkipEmptyModules {
+		ok, err := hasGoFiles(dir, w.LoadTests)
+		if err != nil {
+			return nil, WalkError{Dir: dir, Op: "checking for Go files in", Err: err}
+		}
+		if !ok {
+			return nil, nil
+		}
+	}
+
+	var (
+		conf     = w.loadConfig(dir, mode)
+		patterns = w.loadPatterns(dir)
+		key      string
+	)
+	if len(extraEnv) > 0 {
+		env := conf.Env
+		if env == nil {
+			env = os.Environ()
+		}
+		conf.Env = append(append([]string{}, env...), extraEnv...)
+	}
+
+	if w.LoadCache != nil {
+		key, err = cacheKey(dir, gomod, &conf, patterns)
+		if err != nil {
+			return nil, WalkError{Dir: dir, Op: "computing cache key for", Err: err}
+		}
+		pkgs, ok, err := w.LoadCache.Get(key)
+		if err != nil {
+			return nil, WalkError{Dir: dir, Op: "getting cached packages for", Err: err}
+		}
+		if ok {
+			w.log(slog.LevelDebug, "using cached packages", "dir", dir, "packages", len(pkgs))
+			if err := w.checkPackageErrors(pkgs); err != nil {
+				return nil, WalkError{Dir: dir, Op: "loading packages in", Err: err}
+			}
+			return pkgs, nil
+		}
+	}
+
+	w.log(slog.LevelDebug, "loading packages", "dir", dir, "patterns", patterns, "mode", conf.Mode)
+	start := time.Now()
+	pkgs, err = packages.Load(&conf, patterns...)
+	elapsed := time.Since(start)
+	if w.Metrics != nil {
+		w.Metrics.ObserveLoad(dir, elapsed, err)
+	}
+	if err != nil {
+		return nil, WalkError{Dir: dir, Op: "loading packages in", Err: err}
+	}
+	w.log(slog.LevelDebug, "loaded packages", "dir", dir, "packages", len(pkgs), "duration", elapsed)
+
+	if w.LoadCache != nil {
+		if err := w.LoadCache.Put(key, pkgs); err != nil {
+			return nil, WalkError{Dir: dir, Op: "caching packages for", Err: err}
+		}
+	}
+
+	if err := w.checkPackageErrors(pkgs); err != nil {
+		return nil, WalkError{Dir: dir, Op: "loading packages in", Err: err}
+	}
+	return pkgs, nil
+}
+
+// checkPackageErrors returns the errors in pkgs,
+// joined together,
+// if w.FailOnPackageErrors is true.
+// If w.FailOn is non-empty,
+// only errors of the kinds it lists are returned.
+func (w *Walker) checkPackageErrors(pkgs []*packages.Package) error {
+	if !w.FailOnPackageErrors && len(w.FailOn) == 0 {
+		return nil
+	}
+	var err error
+	for _, pkg := range pkgs {
+		for _, pkgErr := range pkg.Errors {
+			if len(w.FailOn) > 0 && !w.failsOn(pkgErr.Kind) {
+				continue
+			}
+			err = errors.Join(err, PackageLoadError{PkgPath: pkg.PkgPath, Kind: pkgErr.Kind, Err: pkgErr})
+		}
+	}
+	return err
+}
+
+func (w *Walker) failsOn(kind packages.ErrorKind) bool {
+	for _, k := range w.FailOn {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// metadataLoadMode is the load mode used by analyses that need only package metadata,
+// not types or syntax.
+const metadataLoadMode = packages.NeedName | packages.NeedFiles | packages.NeedImports | packages.NeedDeps | packages.NeedModule
+
+// withLoadMode returns a copy of w that loads packages using exactly the given mode.
+func (w *Walker) withLoadMode(mode packages.LoadMode) *Walker {
+	w2 := *w
+	w2.LoadConfig.Mode = mode
+	return &w2
+}
+
+// loadConfig produces the [packages.Config] for loading the module in dir.
+func (w *Walker) loadConfig(dir string, mode packages.LoadMode) packages.Config {
 	conf := w.LoadConfig
 	if isZeroConfig(conf) {
 		conf = DefaultLoadConfig
@@ -189,28 +692,62 @@ func (w *Walker) LoadEach(dir string, f func(string, []*packages.Package) error)
 	if conf.Mode == 0 {
 		conf.Mode = DefaultLoadMode
 	}
+	if w.FastTypes {
+		conf.Mode &^= packages.NeedDeps
+	}
+	conf.Mode |= mode
 	conf.Dir = dir
-
-	return w.Each(dir, func(subdir string) error {
-		pkgs, err := packages.Load(&conf, "./...")
-		if err != nil {
-			return errors.Wrapf(err, "loading packages in %s", subdir)
+	conf.Env = w.loadEnv(conf.Env)
+	if w.LoadTests {
+		conf.Tests = true
+	}
+	if len(w.BuildFlags) > 0 {
+		conf.BuildFlags = append(append([]string{}, conf.BuildFlags...), w.BuildFlags...)
+	}
+	if len(w.Overlay) > 0 {
+		overlay := make(map[string][]byte, len(conf.Overlay)+len(w.Overlay))
+		for k, v := range conf.Overlay {
+			overlay[k] = v
+		}
+		for k, v := range w.Overlay {
+			overlay[k] = v
 		}
+		conf.Overlay = overlay
+	}
+	return conf
+}
 
-		if w.FailOnPackageErrors {
-			var err error
-			for _, pkg := range pkgs {
-				for _, pkgErr := range pkg.Errors {
-					err = errors.Join(err, PackageLoadError{PkgPath: pkg.PkgPath, Err: pkgErr})
-				}
-			}
-			if err != nil {
-				return err
-			}
+// loadPatterns returns the patterns to load for the module in dir.
+func (w *Walker) loadPatterns(dir string) []string {
+	if w.PatternsFor != nil {
+		if patterns := w.PatternsFor(dir); len(patterns) > 0 {
+			return patterns
 		}
+	}
+	if len(w.LoadPatterns) > 0 {
+		return w.LoadPatterns
+	}
+	return []string{"./..."}
+}
 
-		return f(subdir, pkgs)
-	})
+// loadEnv adds the settings in w.Env, w.GOFLAGS, and w.GOWORK to env.
+// If there are none, env is returned unchanged.
+func (w *Walker) loadEnv(env []string) []string {
+	if len(w.Env) == 0 && w.GOFLAGS == "" && w.GOWORK == "" {
+		return env
+	}
+	if env == nil {
+		env = os.Environ()
+	}
+	result := append([]string{}, env...)
+	result = append(result, w.Env...)
+	if w.GOFLAGS != "" {
+		result = append(result, "GOFLAGS="+w.GOFLAGS)
+	}
+	if w.GOWORK != "" {
+		result = append(result, "GOWORK="+w.GOWORK)
+	}
+	return result
 }
 
 func isZeroConfig(conf packages.Config) bool {
@@ -220,7 +757,13 @@ func isZeroConfig(conf packages.Config) bool {
 // PackageLoadError is an error type that wraps an error that occurred while loading a package.
 type PackageLoadError struct {
 	PkgPath string
-	Err     error
+
+	// Kind is the kind of error:
+	// one of [packages.ListError], [packages.ParseError], [packages.TypeError],
+	// or [packages.UnknownError].
+	Kind packages.ErrorKind
+
+	Err error
 }
 
 func (e PackageLoadError) Error() string {
@@ -239,9 +782,22 @@ func LoadEachGomod(dir string, f func(string, *modfile.File, []*packages.Package
 
 // LoadEachGomod combines LoadEach and EachGomod.
 func (w *Walker) LoadEachGomod(dir string, f func(string, *modfile.File, []*packages.Package) error) error {
-	return w.LoadEach(dir, func(subdir string, pkgs []*packages.Package) error {
-		return w.withGomod(dir, subdir, func(subdir string, mf *modfile.File) error {
-			return f(subdir, mf, pkgs)
-		})
+	return w.loadEachGomod(dir, 0, f)
+}
+
+func (w *Walker) loadEachGomod(dir string, mode packages.LoadMode, f func(string, *modfile.File, []*packages.Package) error) error {
+	if w.Pipeline.enabled() {
+		return w.pipeline(dir, mode, true, f)
+	}
+	return w.Each(dir, func(subdir string) error {
+		data, mf, err := w.readGomod(subdir)
+		if err != nil {
+			return err
+		}
+		pkgs, err := w.loadWithGomod(subdir, data, mode)
+		if err != nil {
+			return err
+		}
+		return f(subdir, mf, pkgs)
 	})
 }
@@ -0,0 +1,141 @@
+package modules
+
+import (
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"path"
+	"path/filepath"
+
+	"github.com/bobg/errors"
+	"golang.org/x/mod/modfile"
+)
+
+// EachFS calls f for each Go module in the directory root of fsys and its subdirectories,
+// passing it the module's directory in fsys
+// and its parsed go.mod file.
+// This function calls Walker.EachFS with a default Walker.
+func EachFS(fsys fs.FS, root string, f func(string, *modfile.File) error) error {
+	var w Walker
+	return w.EachFS(fsys, root, f)
+}
+
+// EachFS calls f for each Go module in the directory root of fsys and its subdirectories,
+// passing it the module's directory in fsys
+// (a slash-separated path that will have root as a prefix,
+// unless root is ".")
+// and its go.mod file,
+// read from fsys and parsed as [Walker.EachGomod] would.
+//
+// Modules are visited in the order [Walker.EachGomod] would visit them,
+// skipping the same directories
+// (including according to [IgnoreFileName] files in fsys),
+// and f may return [filepath.SkipDir] or [filepath.SkipAll] in the same way.
+// Links are not followed,
+// and w.Submodules, w.ScanConcurrency, and w.PruneLeaves have no effect.
+func (w *Walker) EachFS(fsys fs.FS, root string, f func(string, *modfile.File) error) error {
+	if !fs.ValidPath(root) {
+		return fmt.Errorf("invalid root %q", root)
+	}
+
+	ig := w.newIgnorer(filepath.FromSlash(root))
+	if ig != nil {
+		ig.readFile = func(filename string) ([]byte, error) {
+			return fs.ReadFile(fsys, filepath.ToSlash(filename))
+		}
+	}
+
+	var found int
+	err := w.eachFS(fsys, ig, root, func(dir string) error {
+		gomodPath := path.Join(dir, "go.mod")
+		data, err := fs.ReadFile(fsys, gomodPath)
+		if err != nil {
+			return errors.Wrapf(err, "reading %s", gomodPath)
+		}
+		mf, err := w.parseGomod(gomodPath, data)
+		if err != nil {
+			return err
+		}
+
+		found++
+		if err := f(dir, mf); err != nil {
+			return err
+		}
+		if w.Limit > 0 && found >= w.Limit {
+			return filepath.SkipAll
+		}
+		return nil
+	})
+	if errors.Is(err, filepath.SkipAll) {
+		return nil
+	}
+	if err == nil && found == 0 && w.RequireModules {
+		return WalkError{Dir: root, Op: "walking", Err: ErrNoModules}
+	}
+	return err
+}
+
+// eachFS is like [Walker.each] for a directory tree in fsys.
+func (w *Walker) eachFS(fsys fs.FS, ig *ignorer, dir string, f func(string) error) error {
+	w.log(LevelTrace, "visiting directory", "dir", dir)
+
+	var (
+		found            bool
+		entries, readErr = fs.ReadDir(fsys, dir)
+	)
+	if readErr != nil {
+		info, err := fs.Stat(fsys, path.Join(dir, "go.mod"))
+		found = err == nil && info.Mode().IsRegular()
+	}
+	for _, entry := range entries {
+		if entry.Name() == "go.mod" && entry.Type().IsRegular() {
+			found = true
+			break
+		}
+	}
+
+	if found {
+		w.log(slog.LevelDebug, "found go.mod", "dir", dir)
+		err := f(dir)
+		switch {
+		case errors.Is(err, filepath.SkipDir):
+			return nil
+		case errors.Is(err, filepath.SkipAll):
+			return err // Filtered out in Walker.EachFS.
+		case err != nil:
+			return WalkError{Dir: dir, Op: "visiting", Err: err}
+		}
+	}
+
+	if readErr != nil {
+		return WalkError{Dir: dir, Op: "reading directory", Err: readErr}
+	}
+
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		subdir := path.Join(dir, entry.Name())
+
+		reason := w.skipReason(entry.Name())
+		if reason == "" {
+			ignored, err := ig.ignored(filepath.FromSlash(subdir))
+			if err != nil {
+				return err
+			}
+			if ignored {
+				reason = IgnoreFileName
+			}
+		}
+		if reason != "" {
+			w.log(slog.LevelDebug, "skipping directory", "dir", subdir, "reason", reason)
+			continue
+		}
+
+		if err := w.eachFS(fsys, ig, subdir, f); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
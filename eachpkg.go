@@ -0,0 +1,56 @@
+package modules
+
+import "golang.org/x/tools/go/packages"
+
+// EachPackage calls f once for each package in each Go module in dir and its subdirectories,
+// including the packages those depend on.
+// This function calls Walker.EachPackage with a default Walker.
+func EachPackage(dir string, f func(string, *packages.Package) error) error {
+	var w Walker
+	return w.EachPackage(dir, f)
+}
+
+// EachPackage calls f once for each package in each Go module in dir and its subdirectories,
+// including the packages those depend on.
+// The arguments to f are the directory of the module whose load first produced the package
+// (which will have dir as a prefix)
+// and the package itself.
+//
+// Packages are loaded as with [Walker.LoadEach],
+// then visited with [packages.Visit] in dependency order
+// (each package after the packages it imports).
+// A dependency shared by several modules is visited only once,
+// the first time it is encountered.
+// Two packages are considered the same if they have the same ID
+// and come from the same module directory,
+// so different versions of a dependency required by different modules are visited separately.
+func (w *Walker) EachPackage(dir string, f func(string, *packages.Package) error) error {
+	seen := make(map[string]bool)
+
+	return w.loadEach(dir, packages.NeedImports|packages.NeedDeps|packages.NeedModule, func(subdir string, pkgs []*packages.Package) error {
+		var err error
+
+		pre := func(pkg *packages.Package) bool {
+			if err != nil {
+				return false
+			}
+			key := pkg.ID
+			if pkg.Module != nil {
+				key += "\x00" + pkg.Module.Dir
+			}
+			if seen[key] {
+				return false
+			}
+			seen[key] = true
+			return true
+		}
+		post := func(pkg *packages.Package) {
+			if err == nil {
+				err = f(subdir, pkg)
+			}
+		}
+		packages.Visit(pkgs, pre, post)
+
+		return err
+	})
+}
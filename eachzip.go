@@ -0,0 +1,94 @@
+package modules
+
+import (
+	"archive/zip"
+	"io/fs"
+	"strings"
+
+	"github.com/bobg/errors"
+	"golang.org/x/mod/modfile"
+	"golang.org/x/mod/module"
+	modzip "golang.org/x/mod/zip"
+)
+
+// EachInZip calls f for each Go module in the zip file zipPath,
+// passing it the module's directory in the zip file
+// and its parsed go.mod file.
+// This function calls Walker.EachInZip with a default Walker.
+func EachInZip(zipPath string, f func(string, *modfile.File) error) error {
+	var w Walker
+	return w.EachInZip(zipPath, f)
+}
+
+// EachInZip calls f for each Go module in the zip file zipPath,
+// passing it the module's directory in the zip file
+// (a slash-separated path)
+// and its parsed go.mod file,
+// as [Walker.EachFS] does.
+//
+// The zip file may be a module zip file,
+// as served by a module proxy,
+// or a source archive of some other kind.
+// It is taken to be a module zip file
+// if every file in it is under a single path@version directory,
+// and in that case it is first checked with [modzip.CheckZip],
+// and EachInZip fails if it is not valid.
+// Otherwise,
+// if every file in the archive is under a single top-level directory,
+// the walk starts there;
+// if not,
+// it starts at the top of the archive.
+func (w *Walker) EachInZip(zipPath string, f func(string, *modfile.File) error) error {
+	r, err := zip.OpenReader(zipPath)
+	if err != nil {
+		return errors.Wrapf(err, "opening %s", zipPath)
+	}
+	defer r.Close()
+
+	root := zipRoot(r.File)
+	if modpath, version, ok := strings.Cut(root, "@"); ok && module.Check(modpath, version) == nil {
+		if _, err := modzip.CheckZip(module.Version{Path: modpath, Version: version}, zipPath); err != nil {
+			return errors.Wrapf(err, "checking module zip %s", zipPath)
+		}
+	}
+
+	return w.EachFS(r, root, f)
+}
+
+// zipRoot returns the directory in a zip file where a walk should start:
+// the path@version directory containing all its files,
+// if there is one;
+// otherwise the top-level directory containing all its files,
+// if there is one;
+// otherwise ".".
+func zipRoot(files []*zip.File) string {
+	if len(files) == 0 {
+		return "."
+	}
+
+	// A module path may contain slashes,
+	// so the path@version directory may be several levels deep.
+	first := files[0].Name
+	if at := strings.Index(first, "@"); at >= 0 {
+		if slash := strings.Index(first[at:], "/"); slash >= 0 {
+			prefix := first[:at+slash+1]
+			if allHavePrefix(files, prefix) {
+				return strings.TrimSuffix(prefix, "/")
+			}
+		}
+	}
+
+	if top, _, ok := strings.Cut(first, "/"); ok && fs.ValidPath(top) && allHavePrefix(files, top+"/") {
+		return top
+	}
+	return "."
+}
+
+func allHavePrefix(files []*zip.File, prefix string) bool {
+	for _, f := range files {
+		if !strings.HasPrefix(f.Name, prefix) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,92 @@
+package modules
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/bobg/errors"
+	"golang.org/x/tools/go/packages"
+)
+
+// PackageEmbeds describes the files embedded in a package with //go:embed directives.
+type PackageEmbeds struct {
+	// ModuleDir is the directory of the module containing the package.
+	ModuleDir string
+
+	// PkgPath is the import path of the package.
+	PkgPath string
+
+	// Patterns are the patterns from the package's //go:embed directives.
+	Patterns []string
+
+	// Files are the absolute paths of the files matched by Patterns.
+	Files []string
+
+	// Unmatched are the members of Patterns that match no existing files.
+	// A package with unmatched patterns fails to build.
+	Unmatched []string
+}
+
+// EmbedInventory reports the embedded files of each package that has any
+// in the Go modules in dir and its subdirectories.
+// This function calls Walker.EmbedInventory with a default Walker.
+func EmbedInventory(dir string) ([]PackageEmbeds, error) {
+	var w Walker
+	return w.EmbedInventory(dir)
+}
+
+// EmbedInventory reports the embedded files of each package that has any
+// in the Go modules in dir and its subdirectories.
+// Packages without //go:embed directives are omitted from the result.
+//
+// Each pattern is also checked against the package's directory,
+// so that patterns matching nothing
+// (which cause a build failure, but only when building that specific package)
+// can be found tree-wide.
+// See the Unmatched field of [PackageEmbeds].
+//
+// Packages are loaded as with [Walker.LoadEach],
+// except that only the package metadata needed for this check is requested.
+func (w *Walker) EmbedInventory(dir string) ([]PackageEmbeds, error) {
+	var result []PackageEmbeds
+
+	const mode = packages.NeedName | packages.NeedFiles | packages.NeedEmbedFiles | packages.NeedEmbedPatterns
+
+	err := w.withLoadMode(mode).LoadEach(dir, func(subdir string, pkgs []*packages.Package) error {
+		for _, pkg := range pkgs {
+			if isTestVariant(pkg) || len(pkg.EmbedPatterns) == 0 {
+				continue
+			}
+			embeds := PackageEmbeds{
+				ModuleDir: subdir,
+				PkgPath:   pkg.PkgPath,
+				Patterns:  pkg.EmbedPatterns,
+				Files:     pkg.EmbedFiles,
+			}
+			pkgdir := pkgDir(pkg)
+			for _, pattern := range pkg.EmbedPatterns {
+				ok, err := embedPatternMatches(pkgdir, pattern)
+				if err != nil {
+					return errors.Wrapf(err, "checking embed pattern %s in %s", pattern, pkg.PkgPath)
+				}
+				if !ok {
+					embeds.Unmatched = append(embeds.Unmatched, pattern)
+				}
+			}
+			result = append(result, embeds)
+		}
+		return nil
+	})
+
+	return result, err
+}
+
+// embedPatternMatches tells whether the //go:embed pattern matches any file or directory in dir.
+func embedPatternMatches(dir, pattern string) (bool, error) {
+	pattern = strings.TrimPrefix(pattern, "all:")
+	matches, err := filepath.Glob(filepath.Join(dir, filepath.FromSlash(pattern)))
+	if err != nil {
+		return false, err
+	}
+	return len(matches) > 0, nil
+}
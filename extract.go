@@ -0,0 +1,246 @@
+package modules
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bobg/errors"
+	"golang.org/x/mod/modfile"
+	"golang.org/x/mod/module"
+)
+
+// ExtractModule turns a subdirectory of a Go module into a module of its own.
+// This function calls Walker.ExtractModule with a default Walker.
+func ExtractModule(treeDir, subdir, newModulePath string) error {
+	var w Walker
+	return w.ExtractModule(treeDir, subdir, newModulePath)
+}
+
+// ExtractModule turns subdir,
+// a directory relative to treeDir inside one of the Go modules in the tree rooted there,
+// into a module of its own,
+// with the module path newModulePath.
+// If newModulePath is empty,
+// the new module's path is the import path that subdir had in its parent module,
+// so no imports need to change.
+// Otherwise imports of the extracted packages throughout the tree are rewritten.
+//
+// The new module's go.mod file gets the parent's go directive,
+// plus requires
+// (and matching replace directives)
+// copied from the parent for the modules its packages import.
+// Direct requires that the parent no longer needs are removed from it,
+// along with their replace directives.
+// Every module in the tree that imports the extracted packages,
+// including the parent,
+// gets a require and local replace directive for the new module,
+// and the new module gets the same for any modules in the tree that it imports.
+// If treeDir contains a go.work file,
+// a use directive for the new module is added to it.
+// Running "go mod tidy" afterwards is advisable.
+func (w *Walker) ExtractModule(treeDir, subdir, newModulePath string) error {
+	w = w.forEdit()
+
+	if !filepath.IsLocal(subdir) {
+		return fmt.Errorf("directory %s is not within %s", subdir, treeDir)
+	}
+	newDir := filepath.Join(treeDir, subdir)
+	if _, err := os.Stat(filepath.Join(newDir, "go.mod")); err == nil {
+		return fmt.Errorf("%s is already a module", newDir)
+	}
+
+	var (
+		gomods   = make(map[string]*modfile.File) // module dir -> go.mod
+		byPath   = make(map[string]string)        // module path -> module dir
+		dirs     []string
+		modPaths []string
+	)
+	err := w.EachGomod(treeDir, func(d string, mf *modfile.File) error {
+		dirs = append(dirs, d)
+		gomods[d] = mf
+		if mf.Module != nil {
+			byPath[mf.Module.Mod.Path] = d
+			modPaths = append(modPaths, mf.Module.Mod.Path)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// The parent is the innermost module containing newDir.
+	var parentDir string
+	for _, d := range dirs {
+		if r, err := filepath.Rel(d, newDir); err == nil && r != "." && filepath.IsLocal(r) && (parentDir == "" || len(d) > len(parentDir)) {
+			parentDir = d
+		}
+	}
+	parentMF := gomods[parentDir]
+	if parentMF == nil || parentMF.Module == nil {
+		return fmt.Errorf("%s is not inside a module in %s", newDir, treeDir)
+	}
+	parentPath := parentMF.Module.Mod.Path
+
+	rel, err := filepath.Rel(parentDir, newDir)
+	if err != nil {
+		return errors.Wrapf(err, "getting relative path of %s", newDir)
+	}
+	oldPrefix := parentPath + "/" + filepath.ToSlash(rel)
+	if newModulePath == "" {
+		newModulePath = oldPrefix
+	}
+	if err := module.CheckPath(newModulePath); err != nil {
+		return errors.Wrapf(err, "checking module path %s", newModulePath)
+	}
+	if d, ok := byPath[newModulePath]; ok {
+		return fmt.Errorf("module path %s is already used by %s", newModulePath, d)
+	}
+
+	// Rewrite imports before creating the new go.mod,
+	// while the extracted packages still belong to the parent.
+	if newModulePath != oldPrefix {
+		rewrite := func(importPath string) (string, bool) {
+			if importPath != oldPrefix && !strings.HasPrefix(importPath, oldPrefix+"/") {
+				return "", false
+			}
+			if owningModule(importPath, modPaths) != parentPath {
+				return "", false
+			}
+			return newModulePath + strings.TrimPrefix(importPath, oldPrefix), true
+		}
+		for _, d := range dirs {
+			if _, err := rewriteModuleImports(d, rewrite); err != nil {
+				return err
+			}
+		}
+	}
+
+	newMF := new(modfile.File)
+	if err := newMF.AddModuleStmt(newModulePath); err != nil {
+		return errors.Wrap(err, "adding module directive")
+	}
+	if parentMF.Go != nil {
+		if err := newMF.AddGoStmt(parentMF.Go.Version); err != nil {
+			return errors.Wrap(err, "adding go directive")
+		}
+	}
+	if err := w.writeGomod(newDir, newMF); err != nil {
+		return err
+	}
+	dirs = append(dirs, newDir)
+	gomods[newDir] = newMF
+	byPath[newModulePath] = newDir
+	modPaths = append(modPaths, newModulePath)
+
+	// Wire up the new module's dependencies.
+	newImports, err := moduleImports(newDir)
+	if err != nil {
+		return err
+	}
+	moved := make(map[string]bool) // module paths of requires copied from the parent
+	for _, imp := range newImports {
+		if owner := owningModule(imp, modPaths); owner != "" {
+			if owner != newModulePath {
+				if err := addLocalRequire(newMF, newDir, owner, byPath[owner]); err != nil {
+					return errors.Wrapf(err, "updating %s", newDir)
+				}
+			}
+			continue
+		}
+		req := requireFor(parentMF, imp)
+		if req == nil || moved[req.Mod.Path] {
+			continue
+		}
+		moved[req.Mod.Path] = true
+		w.setRequire(newMF, req.Mod.Path, req.Mod.Version, req.Indirect)
+		if err := copyReplaces(parentMF, parentDir, newMF, newDir, req.Mod.Path); err != nil {
+			return errors.Wrapf(err, "updating %s", newDir)
+		}
+	}
+	if err := w.writeGomod(newDir, newMF); err != nil {
+		return err
+	}
+
+	// Wire up the modules that depend on the new one.
+	for _, d := range dirs {
+		if d == newDir {
+			continue
+		}
+		imports, err := moduleImports(d)
+		if err != nil {
+			return err
+		}
+		mf := gomods[d]
+		var (
+			needsNew bool
+			used     = make(map[string]bool) // module paths of requires still needed
+		)
+		for _, imp := range imports {
+			if owningModule(imp, modPaths) == newModulePath {
+				needsNew = true
+			}
+			if req := requireFor(mf, imp); req != nil {
+				used[req.Mod.Path] = true
+			}
+		}
+		changed := needsNew
+		if needsNew {
+			if err := addLocalRequire(mf, d, newModulePath, newDir); err != nil {
+				return errors.Wrapf(err, "updating %s", d)
+			}
+		}
+		if d == parentDir {
+			for _, req := range append([]*modfile.Require{}, mf.Require...) {
+				if p := req.Mod.Path; moved[p] && !used[p] && !req.Indirect {
+					if err := mf.DropRequire(p); err != nil {
+						return errors.Wrapf(err, "updating %s", d)
+					}
+					for _, rep := range append([]*modfile.Replace{}, mf.Replace...) {
+						if rep.Old.Path == p {
+							if err := mf.DropReplace(p, rep.Old.Version); err != nil {
+								return errors.Wrapf(err, "updating %s", d)
+							}
+						}
+					}
+					changed = true
+				}
+			}
+		}
+		if changed {
+			if err := w.writeGomod(d, mf); err != nil {
+				return err
+			}
+		}
+	}
+
+	wf, err := w.readGowork(treeDir)
+	if err != nil || wf == nil {
+		return err
+	}
+	if err := wf.AddUse(relativeModPath(treeDir, newDir), ""); err != nil {
+		return errors.Wrap(err, "adding use directive")
+	}
+	return writeGowork(treeDir, wf)
+}
+
+// copyReplaces copies the replace directives for the module with path modPath
+// from the go.mod file from (in fromDir)
+// to the go.mod file to (in toDir),
+// adjusting relative directory paths.
+func copyReplaces(from *modfile.File, fromDir string, to *modfile.File, toDir, modPath string) error {
+	for _, rep := range from.Replace {
+		if rep.Old.Path != modPath {
+			continue
+		}
+		newPath := rep.New.Path
+		if modfile.IsDirectoryPath(newPath) && !filepath.IsAbs(newPath) {
+			newPath = relativeModPath(toDir, filepath.Join(fromDir, filepath.FromSlash(newPath)))
+		}
+		if err := to.AddReplace(rep.Old.Path, rep.Old.Version, newPath, rep.New.Version); err != nil {
+			return err
+		}
+	}
+	return nil
+}
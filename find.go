@@ -0,0 +1,71 @@
+package modules
+
+import (
+	"golang.org/x/mod/modfile"
+)
+
+// Find returns the directories of the Go modules in dir and its subdirectories.
+// This function calls Walker.Find with a default Walker.
+func Find(dir string) ([]string, error) {
+	var w Walker
+	return w.Find(dir)
+}
+
+// Find returns the directories of the Go modules in dir and its subdirectories,
+// in the order [Walker.Each] visits them.
+func (w *Walker) Find(dir string) ([]string, error) {
+	var result []string
+	err := w.Each(dir, func(subdir string) error {
+		result = append(result, subdir)
+		return nil
+	})
+	return result, err
+}
+
+// ModuleEntry is a Go module found by [Walker.CollectGomods].
+type ModuleEntry = Module
+
+// CollectGomods returns the Go modules in dir and its subdirectories,
+// with their parsed go.mod files.
+// This function calls Walker.CollectGomods with a default Walker.
+func CollectGomods(dir string) ([]ModuleEntry, error) {
+	var w Walker
+	return w.CollectGomods(dir)
+}
+
+// CollectGomods returns the Go modules in dir and its subdirectories,
+// with their parsed go.mod files,
+// in the order [Walker.EachGomod] visits them.
+func (w *Walker) CollectGomods(dir string) ([]ModuleEntry, error) {
+	var result []ModuleEntry
+	err := w.EachGomod(dir, func(subdir string, mf *modfile.File) error {
+		entry, err := w.newModule(subdir, mf)
+		if err != nil {
+			return err
+		}
+		result = append(result, *entry)
+		return nil
+	})
+	return result, err
+}
+
+// Count returns the number of Go modules in dir and its subdirectories.
+// This function calls Walker.Count with a default Walker.
+func Count(dir string) (int, error) {
+	var w Walker
+	return w.Count(dir)
+}
+
+// Count returns the number of Go modules in dir and its subdirectories.
+// No go.mod file is read.
+// If w.Limit is positive,
+// counting stops at that many,
+// which is a cheap way to ask whether a tree has at least (or more than) some number of modules.
+func (w *Walker) Count(dir string) (int, error) {
+	var n int
+	err := w.Each(dir, func(string) error {
+		n++
+		return nil
+	})
+	return n, err
+}
@@ -0,0 +1,66 @@
+package modules
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+
+	"github.com/bobg/errors"
+)
+
+// FormatEachGomod puts each go.mod file in dir and its subdirectories into canonical form.
+// It returns the paths of the go.mod files that changed.
+// If checkOnly is true,
+// no files are written,
+// and the result is the list of go.mod files that would change.
+// This function calls Walker.FormatEachGomod with a default Walker.
+func FormatEachGomod(dir string, checkOnly bool) ([]string, error) {
+	var w Walker
+	return w.FormatEachGomod(dir, checkOnly)
+}
+
+// FormatEachGomod puts each go.mod file in dir and its subdirectories into canonical form.
+// It returns the paths of the go.mod files that changed.
+// If checkOnly is true,
+// no files are written,
+// and the result is the list of go.mod files that would change.
+//
+// Canonical form is what [modfile.Format] produces
+// after a call to [modfile.File.Cleanup].
+// This is a sort of "gofmt for go.mod files."
+func (w *Walker) FormatEachGomod(dir string, checkOnly bool) ([]string, error) {
+	w = w.forEdit()
+
+	var changed []string
+
+	err := w.Each(dir, func(subdir string) error {
+		data, mf, err := w.readGomod(subdir)
+		if err != nil {
+			return err
+		}
+
+		gomodPath := filepath.Join(subdir, "go.mod")
+
+		mf.Cleanup()
+		formatted, err := mf.Format()
+		if err != nil {
+			return errors.Wrapf(err, "formatting %s", gomodPath)
+		}
+		if bytes.Equal(data, formatted) {
+			return nil
+		}
+
+		changed = append(changed, gomodPath)
+		if checkOnly {
+			return nil
+		}
+
+		info, err := os.Stat(gomodPath)
+		if err != nil {
+			return errors.Wrapf(err, "statting %s", gomodPath)
+		}
+		return errors.Wrapf(os.WriteFile(gomodPath, formatted, info.Mode().Perm()), "writing %s", gomodPath)
+	})
+
+	return changed, err
+}
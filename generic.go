@@ -0,0 +1,101 @@
+package modules
+
+import (
+	"context"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// MapEach calls f for each Go module in dir and its subdirectories,
+// passing it the directory containing the go.mod file,
+// and returns the results,
+// in the order [Walker.Each] visits the modules.
+// If w is nil,
+// a default Walker is used.
+//
+// If w.Concurrency is greater than 1,
+// up to that many calls to f run at once,
+// after the walk has found all the modules.
+// Otherwise f is called as the walk proceeds.
+// Either way,
+// the first error from f stops further calls
+// (though calls already running finish)
+// and is returned.
+func MapEach[T any](w *Walker, dir string, f func(string) (T, error)) ([]T, error) {
+	if w == nil {
+		w = new(Walker)
+	}
+
+	if w.Concurrency <= 1 {
+		var result []T
+		err := w.Each(dir, func(subdir string) error {
+			val, err := f(subdir)
+			if err != nil {
+				return err
+			}
+			result = append(result, val)
+			return nil
+		})
+		return result, err
+	}
+
+	dirs, err := w.Find(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		result = make([]T, len(dirs))
+		g, ctx = errgroup.WithContext(context.Background())
+	)
+	g.SetLimit(w.Concurrency)
+	for i, subdir := range dirs {
+		i, subdir := i, subdir
+		g.Go(func() error {
+			if ctx.Err() != nil {
+				return nil // Another call to f has failed.
+			}
+			val, err := f(subdir)
+			if err != nil {
+				return WalkError{Dir: subdir, Op: "visiting", Err: err}
+			}
+			result[i] = val
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// FoldEach calls f for each Go module in dir and its subdirectories,
+// in the order [Walker.Each] visits them,
+// passing it an accumulated value and the directory containing the go.mod file.
+// The accumulated value starts as init
+// and is replaced by the result of each call to f.
+// FoldEach returns the final accumulated value.
+// If w is nil,
+// a default Walker is used.
+//
+// Calls to f are never concurrent,
+// so f needs no locking to update the accumulated value.
+// If f returns an error,
+// FoldEach stops and returns the value accumulated so far,
+// together with the error.
+func FoldEach[A any](w *Walker, dir string, init A, f func(A, string) (A, error)) (A, error) {
+	if w == nil {
+		w = new(Walker)
+	}
+
+	acc := init
+	err := w.Each(dir, func(subdir string) error {
+		next, err := f(acc, subdir)
+		if err != nil {
+			return err
+		}
+		acc = next
+		return nil
+	})
+	return acc, err
+}
@@ -0,0 +1,197 @@
+package modules
+
+import (
+	"archive/tar"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/bobg/errors"
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/semver"
+)
+
+// git runs a git command in dir and returns its output,
+// with surrounding whitespace trimmed.
+func git(dir string, args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	out, err := cmd.Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && len(exitErr.Stderr) > 0 {
+			return "", errors.Wrapf(err, "running git %s: %s", strings.Join(args, " "), bytes.TrimSpace(exitErr.Stderr))
+		}
+		return "", errors.Wrapf(err, "running git %s", strings.Join(args, " "))
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// moduleTagPrefix returns the prefix that tags for the Go module in dir must have.
+// This is the module's directory relative to the root of its git repository,
+// with a trailing slash,
+// or the empty string if the module is at the root of the repository.
+func moduleTagPrefix(dir string) (string, error) {
+	return git(dir, "rev-parse", "--show-prefix")
+}
+
+// moduleVersions returns the semantic versions of the Go module in dir
+// for which there are tags reachable from the given git ref.
+// If ref is empty,
+// all tags are considered.
+// The result is sorted in increasing semver order.
+func moduleVersions(dir, ref string) ([]string, error) {
+	prefix, err := moduleTagPrefix(dir)
+	if err != nil {
+		return nil, errors.Wrapf(err, "getting tag prefix for %s", dir)
+	}
+
+	args := []string{"tag", "--list", prefix + "v*"}
+	if ref != "" {
+		args = append(args, "--merged", ref)
+	}
+	out, err := git(dir, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []string
+	for _, tag := range strings.Fields(out) {
+		v := strings.TrimPrefix(tag, prefix)
+		if !semver.IsValid(v) || semver.Canonical(v) != v {
+			continue
+		}
+		result = append(result, v)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return semver.Compare(result[i], result[j]) < 0
+	})
+
+	return result, nil
+}
+
+// latestModuleVersion returns the highest tagged version of the Go module in dir
+// reachable from the given git ref
+// (or among all tags, if ref is empty)
+// that has the given major-version prefix
+// (as returned by [module.PathMajorPrefix]).
+// An empty major matches versions v0 and v1.
+// It returns the empty string if there is no such version.
+func latestModuleVersion(dir, major, ref string) (string, error) {
+	versions, err := moduleVersions(dir, ref)
+	if err != nil {
+		return "", errors.Wrapf(err, "getting tagged versions in %s", dir)
+	}
+	return latestVersion(versions, major), nil
+}
+
+// latestVersion returns the highest of versions,
+// which must be sorted in increasing semver order,
+// with the given major-version prefix,
+// as in [latestModuleVersion].
+func latestVersion(versions []string, major string) string {
+	var result string
+	for _, v := range versions {
+		if major == "" {
+			if m := semver.Major(v); m != "v0" && m != "v1" {
+				continue
+			}
+		} else if semver.Major(v) != major {
+			continue
+		}
+		result = v // versions is sorted, so the last match is the highest
+	}
+	return result
+}
+
+// modulePathMajor returns the major-version prefix implied by a module path
+// (as returned by [module.PathMajorPrefix]):
+// for example "v2" for example.com/foo/v2,
+// and "" for example.com/foo.
+func modulePathMajor(modpath string) (string, error) {
+	_, pathMajor, ok := module.SplitPathVersion(modpath)
+	if !ok {
+		return "", fmt.Errorf("invalid module path %s", modpath)
+	}
+	return module.PathMajorPrefix(pathMajor), nil
+}
+
+// extractGitTree writes the files of the git tree at ref,
+// in the repository containing dir,
+// into the directory dest.
+func extractGitTree(dir, ref, dest string) error {
+	// Run git archive at the top of the repository;
+	// in a subdirectory it archives only that subdirectory.
+	cdup, err := git(dir, "rev-parse", "--show-cdup")
+	if err != nil {
+		return errors.Wrapf(err, "finding git repository root for %s", dir)
+	}
+
+	cmd := exec.Command("git", "archive", "--format=tar", ref)
+	cmd.Dir = filepath.Join(dir, cdup)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return errors.Wrap(err, "creating pipe for git archive")
+	}
+	stderr := new(bytes.Buffer)
+	cmd.Stderr = stderr
+	if err := cmd.Start(); err != nil {
+		return errors.Wrap(err, "starting git archive")
+	}
+
+	extractErr := extractTar(stdout, dest)
+	io.Copy(io.Discard, stdout) // let git finish even if extraction failed
+
+	if err := cmd.Wait(); err != nil {
+		return errors.Wrapf(err, "running git archive %s: %s", ref, bytes.TrimSpace(stderr.Bytes()))
+	}
+	return extractErr
+}
+
+// extractTar writes the regular files and directories in the tar stream r into dest.
+// Other entry types (such as symlinks) are skipped.
+func extractTar(r io.Reader, dest string) error {
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return errors.Wrap(err, "reading tar stream")
+		}
+		name := filepath.FromSlash(hdr.Name)
+		if !filepath.IsLocal(name) {
+			return fmt.Errorf("unsafe path %s in tar stream", hdr.Name)
+		}
+		path := filepath.Join(dest, name)
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(path, 0755); err != nil {
+				return errors.Wrapf(err, "creating %s", path)
+			}
+
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				return errors.Wrapf(err, "creating %s", filepath.Dir(path))
+			}
+			f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, hdr.FileInfo().Mode().Perm())
+			if err != nil {
+				return errors.Wrapf(err, "creating %s", path)
+			}
+			_, err = io.Copy(f, tr)
+			if closeErr := f.Close(); err == nil {
+				err = closeErr
+			}
+			if err != nil {
+				return errors.Wrapf(err, "writing %s", path)
+			}
+		}
+	}
+}
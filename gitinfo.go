@@ -0,0 +1,79 @@
+package modules
+
+import (
+	"path"
+	"strings"
+	"time"
+
+	"github.com/bobg/errors"
+	"golang.org/x/mod/modfile"
+)
+
+// GitInfo describes the last git commit affecting a module.
+// See [Walker.GitMetadata].
+type GitInfo struct {
+	// Hash is the full hash of the commit.
+	Hash string
+
+	// Author and AuthorEmail identify the commit's author.
+	Author, AuthorEmail string
+
+	// Date is the commit's author date.
+	Date time.Time
+}
+
+// newModule returns a [Module] for the module in dir with the given go.mod file,
+// with git metadata if w.GitMetadata is true.
+func (w *Walker) newModule(dir string, mf *modfile.File) (*Module, error) {
+	m := &Module{Dir: dir, Gomod: mf}
+	if mf.Module != nil {
+		m.Path = mf.Module.Mod.Path
+	}
+	if w.GitMetadata {
+		var err error
+		if m.Git, err = lastModuleCommit(dir); err != nil {
+			return nil, errors.Wrapf(err, "getting git metadata for %s", dir)
+		}
+	}
+	return m, nil
+}
+
+// lastModuleCommit returns the last commit affecting the files of the module in dir,
+// not counting those of nested modules,
+// or nil if dir is not in a git work tree
+// or no commit affects the module.
+func lastModuleCommit(dir string) (*GitInfo, error) {
+	if _, err := git(dir, "rev-parse", "--is-inside-work-tree"); err != nil {
+		return nil, nil // Not in a git work tree, or no git.
+	}
+
+	// Find nested modules, to exclude them.
+	out, err := git(dir, "ls-files", "-z", "--", ":(glob)**/go.mod")
+	if err != nil {
+		return nil, err
+	}
+	args := []string{"log", "-1", "--format=%H%x00%an%x00%ae%x00%aI", "--", "."}
+	for _, name := range strings.Split(out, "\x00") {
+		if name == "" || name == "go.mod" {
+			continue
+		}
+		args = append(args, ":(exclude)"+path.Dir(name))
+	}
+
+	out, err = git(dir, args...)
+	if err != nil {
+		return nil, err
+	}
+	if out == "" {
+		return nil, nil
+	}
+	fields := strings.Split(out, "\x00")
+	if len(fields) != 4 {
+		return nil, errors.New("unexpected git log output " + out)
+	}
+	date, err := time.Parse(time.RFC3339, fields[3])
+	if err != nil {
+		return nil, errors.Wrapf(err, "parsing commit date %s", fields[3])
+	}
+	return &GitInfo{Hash: fields[0], Author: fields[1], AuthorEmail: fields[2], Date: date}, nil
+}
@@ -1,11 +1,15 @@
 module github.com/bobg/modules
 
-go 1.20
+go 1.21
 
 require (
 	github.com/bobg/errors v0.10.0
+	github.com/fsnotify/fsnotify v1.7.0
+	golang.org/x/exp v0.0.0-20231110203233-9a3e6036ecaa
 	golang.org/x/mod v0.14.0
+	golang.org/x/sync v0.5.0
 	golang.org/x/tools v0.15.0
+	golang.org/x/vuln v1.0.1
 )
 
 require golang.org/x/sys v0.14.0 // indirect
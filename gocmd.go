@@ -0,0 +1,103 @@
+package modules
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/bobg/errors"
+)
+
+// goCmd runs a go command in dir and returns its output.
+// The output is returned even if the command fails.
+// The command's environment includes the settings in w.Env, w.GOFLAGS, and w.GOWORK,
+// and the environment in w.LoadConfig.
+func (w *Walker) goCmd(dir string, args ...string) ([]byte, error) {
+	return w.goCmdContext(context.Background(), dir, args...)
+}
+
+// goCmdContext is like goCmd but takes a context for canceling the command.
+func (w *Walker) goCmdContext(ctx context.Context, dir string, args ...string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, "go", args...)
+	cmd.Dir = dir
+	cmd.Env = w.loadEnv(w.LoadConfig.Env)
+	start := time.Now()
+	out, err := cmd.Output()
+	w.log(slog.LevelDebug, "ran go command", "dir", dir, "args", args, "duration", time.Since(start), "err", err)
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && len(exitErr.Stderr) > 0 {
+			return out, errors.Wrapf(err, "running go %s: %s", strings.Join(args, " "), bytes.TrimSpace(exitErr.Stderr))
+		}
+		return out, errors.Wrapf(err, "running go %s", strings.Join(args, " "))
+	}
+	return out, nil
+}
+
+// listedModule is a module as described by "go list -m -json" and "go mod download -json".
+type listedModule struct {
+	Path     string
+	Version  string
+	Main     bool
+	Indirect bool
+	Dir      string
+	Replace  *listedModule
+	Error    *listedModuleError
+
+	// These are populated by "go list -m -u" and "go list -m -retracted".
+	Update     *listedModule
+	Retracted  []string
+	Deprecated string
+}
+
+type listedModuleError struct {
+	Err string
+}
+
+// listModules runs "go list -m -json" in dir with the given additional arguments
+// and decodes the result.
+func (w *Walker) listModules(dir string, args ...string) ([]listedModule, error) {
+	out, err := w.goCmd(dir, append([]string{"list", "-m", "-json"}, args...)...)
+	if err != nil {
+		return nil, err
+	}
+	return decodeListedModules(out)
+}
+
+// decodeListedModules decodes a stream of JSON-encoded listedModules.
+func decodeListedModules(data []byte) ([]listedModule, error) {
+	var (
+		result []listedModule
+		dec    = json.NewDecoder(bytes.NewReader(data))
+	)
+	for {
+		var m listedModule
+		err := dec.Decode(&m)
+		if errors.Is(err, io.EOF) {
+			return result, nil
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "decoding module list")
+		}
+		result = append(result, m)
+	}
+}
+
+// goEnv returns the values of the given go environment variables,
+// as reported by "go env" in dir.
+func (w *Walker) goEnv(dir string, vars ...string) (map[string]string, error) {
+	out, err := w.goCmd(dir, append([]string{"env", "-json"}, vars...)...)
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[string]string)
+	if err := json.Unmarshal(out, &result); err != nil {
+		return nil, errors.Wrap(err, "decoding go env output")
+	}
+	return result, nil
+}
@@ -0,0 +1,75 @@
+package modules
+
+import (
+	"go/build"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bobg/errors"
+)
+
+// hasGoFiles tells whether the module in dir contains any buildable Go files,
+// according to the build constraints of [build.Default].
+// Test files count only if tests is true.
+// Directories that the go command ignores
+// (testdata, vendor, and those beginning with . or _)
+// are skipped,
+// as are nested modules.
+func hasGoFiles(dir string, tests bool) (bool, error) {
+	var found bool
+	err := walkModuleFiles(dir, func(path string, entry fs.DirEntry) error {
+		name := entry.Name()
+		if !strings.HasSuffix(name, ".go") {
+			return nil
+		}
+		if !tests && strings.HasSuffix(name, "_test.go") {
+			return nil
+		}
+		ok, err := build.Default.MatchFile(filepath.Dir(path), name)
+		if err != nil {
+			return errors.Wrapf(err, "checking build constraints of %s", path)
+		}
+		if ok {
+			found = true
+			return filepath.SkipAll
+		}
+		return nil
+	})
+	return found, err
+}
+
+// walkModuleFiles calls f for each regular file in the module in dir,
+// skipping nested modules and directories ignored by the go command.
+// If f returns [filepath.SkipAll],
+// the walk stops early with no error.
+func walkModuleFiles(dir string, f func(string, fs.DirEntry) error) error {
+	return filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			if path == dir {
+				return nil
+			}
+			if ignoredDir(entry.Name()) {
+				return filepath.SkipDir
+			}
+			if _, err := os.Stat(filepath.Join(path, "go.mod")); err == nil {
+				return filepath.SkipDir // nested module
+			}
+			return nil
+		}
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+		return f(path, entry)
+	})
+}
+
+// ignoredDir tells whether the go command ignores directories with the given name
+// when matching package patterns.
+func ignoredDir(name string) bool {
+	return name == "testdata" || name == "vendor" || strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_")
+}
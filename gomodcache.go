@@ -0,0 +1,74 @@
+package modules
+
+import (
+	"os"
+	"sync"
+	"time"
+
+	"golang.org/x/mod/modfile"
+)
+
+// GomodCache is a cache of parsed go.mod files,
+// for reuse across walks by a [Walker] whose GomodCache field points to it.
+// Create one with [NewGomodCache].
+// It is safe for concurrent use.
+//
+// A go.mod file is reparsed if its modification time or size has changed since it was cached.
+// Walkers sharing a cache should use the same [Walker.VersionFixer].
+type GomodCache struct {
+	mu      sync.Mutex
+	entries map[gomodCacheKey]gomodCacheEntry
+}
+
+type gomodCacheKey struct {
+	path string
+	lax  bool
+}
+
+type gomodCacheEntry struct {
+	modTime time.Time
+	size    int64
+	data    []byte
+	mf      *modfile.File
+}
+
+// NewGomodCache returns a new, empty [GomodCache].
+func NewGomodCache() *GomodCache {
+	return &GomodCache{entries: make(map[gomodCacheKey]gomodCacheEntry)}
+}
+
+// get returns the cached contents and parsed form of the go.mod file at path,
+// if they are still current for info.
+func (c *GomodCache) get(path string, lax bool, info os.FileInfo) ([]byte, *modfile.File, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[gomodCacheKey{path: path, lax: lax}]
+	if !ok || !e.modTime.Equal(info.ModTime()) || e.size != info.Size() {
+		return nil, nil, false
+	}
+	return e.data, e.mf, true
+}
+
+func (c *GomodCache) put(path string, lax bool, info os.FileInfo, data []byte, mf *modfile.File) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries[gomodCacheKey{path: path, lax: lax}] = gomodCacheEntry{
+		modTime: info.ModTime(),
+		size:    info.Size(),
+		data:    data,
+		mf:      mf,
+	}
+}
+
+// forEdit returns a copy of w that does not use w.GomodCache,
+// for methods that modify the parsed go.mod files they read.
+func (w *Walker) forEdit() *Walker {
+	if w.GomodCache == nil {
+		return w
+	}
+	w2 := *w
+	w2.GomodCache = nil
+	return &w2
+}
@@ -0,0 +1,198 @@
+package modules
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bobg/errors"
+	"golang.org/x/mod/modfile"
+)
+
+// GomodEditOptions control how a [Walker] lays out the changes it makes to go.mod files.
+// See [Walker.GomodEdits].
+//
+// Regardless of these options,
+// comments on existing require directives,
+// such as justifications for a version
+// or text following "// indirect",
+// are kept when a require's version or indirect marking changes
+// or its module path is renamed.
+type GomodEditOptions struct {
+	// SortBlocks, if true,
+	// sorts the lines within require, exclude, and replace blocks,
+	// as [modfile.File.SortBlocks] does.
+	// Otherwise existing lines keep their order,
+	// and changed requires stay where they are.
+	SortBlocks bool
+
+	// SeparateIndirect, if true,
+	// adds new requires the way the go command does for go 1.17 and later modules,
+	// with direct and indirect requires in separate blocks:
+	// each goes at the end of the last require block containing only requires of its kind,
+	// or in a new block if there is none.
+	// Otherwise new requires are added to the last require block.
+	// Either way,
+	// existing requires are not moved.
+	SeparateIndirect bool
+
+	// NoCleanup, if true,
+	// skips the call to [modfile.File.Cleanup] before writing,
+	// leaving in place any empty blocks
+	// left by removed directives.
+	NoCleanup bool
+}
+
+// writeGomod writes mf to the go.mod file in dir,
+// laid out according to w.GomodEdits,
+// preserving the file's permissions if it already exists.
+func (w *Walker) writeGomod(dir string, mf *modfile.File) error {
+	gomodPath := filepath.Join(dir, "go.mod")
+
+	if !w.GomodEdits.NoCleanup {
+		mf.Cleanup()
+	}
+	if w.GomodEdits.SortBlocks {
+		mf.SortBlocks()
+	}
+	data, err := mf.Format()
+	if err != nil {
+		return errors.Wrapf(err, "formatting %s", gomodPath)
+	}
+
+	perm := fs.FileMode(0644)
+	if info, err := os.Stat(gomodPath); err == nil {
+		perm = info.Mode().Perm()
+	}
+	return errors.Wrapf(os.WriteFile(gomodPath, data, perm), "writing %s", gomodPath)
+}
+
+// setRequire makes mf require modPath at version,
+// marked "// indirect" or not according to indirect,
+// adding a require directive if there isn't one.
+// An existing directive is updated in place,
+// keeping its position and comments.
+// A new one is placed according to w.GomodEdits.SeparateIndirect.
+func (w *Walker) setRequire(mf *modfile.File, modPath, version string, indirect bool) {
+	for _, req := range mf.Require {
+		if req.Mod.Path == modPath {
+			_ = mf.AddRequire(modPath, version) // Updates req, removing any duplicates. It never fails.
+			setIndirect(req, indirect)
+			return
+		}
+	}
+	if w.GomodEdits.SeparateIndirect {
+		addRequireSeparate(mf, modPath, version, indirect)
+		return
+	}
+	mf.AddNewRequire(modPath, version, indirect)
+}
+
+// addRequireSeparate adds a require of modPath at version to mf,
+// in the last require block whose requires are all indirect (if indirect is true)
+// or all direct (if it is false),
+// or in a new block if there is no such block.
+// Unlike [modfile.File.SetRequireSeparateIndirect],
+// it does not reorder other lines.
+func addRequireSeparate(mf *modfile.File, modPath, version string, indirect bool) {
+	if mf.Syntax == nil {
+		mf.Syntax = new(modfile.FileSyntax)
+	}
+
+	var block *modfile.LineBlock
+	for _, stmt := range mf.Syntax.Stmt {
+		b, ok := stmt.(*modfile.LineBlock)
+		if !ok || len(b.Token) != 1 || b.Token[0] != "require" || len(b.Line) == 0 {
+			continue
+		}
+		matches := true
+		for _, line := range b.Line {
+			if hasIndirectComment(line) != indirect {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			block = b
+		}
+	}
+
+	line := &modfile.Line{Token: []string{modfile.AutoQuote(modPath), version}, InBlock: true}
+	if block == nil {
+		block = &modfile.LineBlock{Token: []string{"require"}}
+		mf.Syntax.Stmt = append(mf.Syntax.Stmt, block)
+	}
+	block.Line = append(block.Line, line)
+
+	r := &modfile.Require{Syntax: line}
+	r.Mod.Path, r.Mod.Version = modPath, version
+	setIndirect(r, indirect)
+	mf.Require = append(mf.Require, r)
+}
+
+// setIndirect adds or removes the "// indirect" comment on r's line,
+// as the unexported method of the same name in [modfile] does.
+func setIndirect(r *modfile.Require, indirect bool) {
+	r.Indirect = indirect
+	line := r.Syntax
+	if line == nil || hasIndirectComment(line) == indirect {
+		return
+	}
+
+	if indirect {
+		if len(line.Suffix) == 0 {
+			line.Suffix = []modfile.Comment{{Token: "// indirect", Suffix: true}}
+			return
+		}
+		com := &line.Suffix[0]
+		text := strings.TrimSpace(strings.TrimPrefix(com.Token, "//"))
+		if text == "" {
+			com.Token = "// indirect"
+		} else {
+			com.Token = "// indirect; " + text
+		}
+		return
+	}
+
+	text := strings.TrimSpace(strings.TrimPrefix(line.Suffix[0].Token, "//"))
+	if text == "indirect" {
+		line.Suffix = nil
+		return
+	}
+	com := &line.Suffix[0]
+	i := strings.Index(com.Token, "indirect;")
+	com.Token = "//" + com.Token[i+len("indirect;"):]
+}
+
+// hasIndirectComment tells whether line has a "// indirect" comment,
+// possibly followed by "; " and other text.
+func hasIndirectComment(line *modfile.Line) bool {
+	if len(line.Suffix) == 0 {
+		return false
+	}
+	f := strings.Fields(strings.TrimPrefix(line.Suffix[0].Token, "//"))
+	return len(f) == 1 && f[0] == "indirect" || len(f) > 1 && f[0] == "indirect;"
+}
+
+// renameRequire changes the require of oldPath in mf to one of newPath,
+// in place,
+// keeping its version, indirect marking, and comments.
+func renameRequire(mf *modfile.File, oldPath, newPath string) error {
+	for _, req := range mf.Require {
+		if req.Mod.Path != oldPath {
+			continue
+		}
+		req.Mod.Path = newPath
+		if line := req.Syntax; line != nil {
+			switch {
+			case line.InBlock && len(line.Token) >= 1: // example.com v1.2.3
+				line.Token[0] = modfile.AutoQuote(newPath)
+			case !line.InBlock && len(line.Token) >= 2: // require example.com v1.2.3
+				line.Token[1] = modfile.AutoQuote(newPath)
+			}
+		}
+		return nil
+	}
+	return nil
+}
@@ -0,0 +1,263 @@
+package modules
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/bobg/errors"
+)
+
+// TestOptions are options for [Walker.TestEach].
+type TestOptions struct {
+	// Args are additional arguments for "go test",
+	// such as "-race" or "-run=TestFoo".
+	Args []string
+
+	// Output, if true, keeps the output of passing and skipped tests,
+	// not just failing ones.
+	Output bool
+}
+
+// TestOutcome is the outcome of a test,
+// a package's tests,
+// or a module's tests.
+type TestOutcome int
+
+const (
+	// TestPassed means the tests passed.
+	TestPassed TestOutcome = iota
+
+	// TestFailed means a test failed,
+	// or a package failed to build.
+	TestFailed
+
+	// TestSkipped means the test was skipped,
+	// or the package or module has no tests.
+	TestSkipped
+)
+
+func (o TestOutcome) String() string {
+	switch o {
+	case TestPassed:
+		return "pass"
+	case TestFailed:
+		return "fail"
+	case TestSkipped:
+		return "skip"
+	}
+	return "unknown"
+}
+
+// TestResult is the result of a single test,
+// or of all the tests in a package.
+type TestResult struct {
+	// Package is the import path of the package.
+	Package string
+
+	// Test is the name of the test,
+	// or the empty string for a package's result.
+	// Subtests have names like "TestFoo/bar".
+	Test string
+
+	// Outcome is the test's outcome.
+	Outcome TestOutcome
+
+	// Elapsed is the time the test took.
+	Elapsed time.Duration
+
+	// Output is the output of the test.
+	// It is kept only for failures,
+	// unless the Output field of [TestOptions] is true.
+	Output string
+}
+
+// ModuleTestResults are the test results for one module.
+// See [Walker.TestEach].
+type ModuleTestResults struct {
+	// Dir is the directory containing the module's go.mod file.
+	Dir string
+
+	// Outcome is [TestFailed] if any package failed,
+	// [TestSkipped] if no package has tests,
+	// and [TestPassed] otherwise.
+	Outcome TestOutcome
+
+	// Elapsed is the time taken to run "go test" in the module.
+	Elapsed time.Duration
+
+	// Packages are the package-level results,
+	// in the order reported by "go test".
+	Packages []TestResult
+
+	// Tests are the results of individual tests,
+	// in the order they finished.
+	Tests []TestResult
+
+	// Stderr is the standard error of "go test",
+	// which includes build errors.
+	Stderr string
+}
+
+// TestEach runs the tests in each Go module in dir and its subdirectories.
+// This function calls Walker.TestEach with a default Walker.
+func TestEach(ctx context.Context, dir string, opts TestOptions) ([]ModuleTestResults, error) {
+	var w Walker
+	return w.TestEach(ctx, dir, opts)
+}
+
+// TestEach runs the tests in each Go module in dir and its subdirectories,
+// using "go test -json",
+// and returns the results in the order [Walker.Each] visits the modules.
+//
+// The packages tested in each module are the ones that [Walker.LoadEach] would load,
+// and w.BuildFlags are passed to "go test" along with opts.Args.
+// The settings in w.Env, w.GOFLAGS, and w.GOWORK,
+// and the environment in w.LoadConfig,
+// are used when running "go test".
+//
+// Test failures and build failures are reported in the results,
+// not as errors.
+// An error is returned only if "go test" can't be run
+// or its output can't be parsed.
+func (w *Walker) TestEach(ctx context.Context, dir string, opts TestOptions) ([]ModuleTestResults, error) {
+	var result []ModuleTestResults
+	err := w.Each(dir, func(subdir string) error {
+		res, err := w.testModule(ctx, subdir, opts)
+		if err != nil {
+			return errors.Wrapf(err, "testing %s", subdir)
+		}
+		result = append(result, res)
+		return nil
+	})
+	return result, err
+}
+
+func (w *Walker) testModule(ctx context.Context, dir string, opts TestOptions) (ModuleTestResults, error) {
+	res := ModuleTestResults{Dir: dir}
+
+	args := []string{"test", "-json"}
+	args = append(args, w.BuildFlags...)
+	args = append(args, opts.Args...)
+	args = append(args, w.loadPatterns(dir)...)
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "go", args...)
+	cmd.Dir = dir
+	cmd.Env = w.loadEnv(w.LoadConfig.Env)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	start := time.Now()
+	err := cmd.Run()
+	res.Elapsed = time.Since(start)
+	res.Stderr = stderr.String()
+
+	// "go test" exits with a non-zero status when tests fail or don't build.
+	// That's reported in the results.
+	var exitErr *exec.ExitError
+	if err != nil && !errors.As(err, &exitErr) {
+		return res, errors.Wrap(err, "running go test")
+	}
+	if ctx.Err() != nil {
+		return res, ctx.Err()
+	}
+
+	if err := decodeTestEvents(&stdout, opts.Output, &res); err != nil {
+		return res, err
+	}
+
+	switch {
+	case err != nil:
+		res.Outcome = TestFailed
+	case len(res.Packages) == 0:
+		res.Outcome = TestSkipped
+	default:
+		res.Outcome = TestSkipped
+		for _, p := range res.Packages {
+			if p.Outcome == TestFailed {
+				res.Outcome = TestFailed
+				break
+			}
+			if p.Outcome == TestPassed {
+				res.Outcome = TestPassed
+			}
+		}
+	}
+
+	return res, nil
+}
+
+// testEvent is an event in the output of "go test -json".
+// See "go doc test2json".
+type testEvent struct {
+	Action  string
+	Package string
+	Test    string
+	Elapsed float64 // seconds
+	Output  string
+}
+
+// decodeTestEvents reads the output of "go test -json" from r into res.
+func decodeTestEvents(r io.Reader, keepOutput bool, res *ModuleTestResults) error {
+	var (
+		dec    = json.NewDecoder(r)
+		output = make(map[[2]string]*strings.Builder) // [package, test] -> output
+	)
+	for {
+		var ev testEvent
+		err := dec.Decode(&ev)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return errors.Wrap(err, "decoding go test output")
+		}
+
+		key := [2]string{ev.Package, ev.Test}
+
+		var outcome TestOutcome
+		switch ev.Action {
+		case "output":
+			buf, ok := output[key]
+			if !ok {
+				buf = new(strings.Builder)
+				output[key] = buf
+			}
+			buf.WriteString(ev.Output)
+			continue
+
+		case "pass":
+			outcome = TestPassed
+		case "fail":
+			outcome = TestFailed
+		case "skip":
+			outcome = TestSkipped
+
+		default:
+			continue
+		}
+
+		tr := TestResult{
+			Package: ev.Package,
+			Test:    ev.Test,
+			Outcome: outcome,
+			Elapsed: time.Duration(ev.Elapsed * float64(time.Second)),
+		}
+		if buf, ok := output[key]; ok {
+			if keepOutput || outcome == TestFailed {
+				tr.Output = buf.String()
+			}
+			delete(output, key)
+		}
+		if ev.Test == "" {
+			res.Packages = append(res.Packages, tr)
+		} else {
+			res.Tests = append(res.Tests, tr)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package modules
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/bobg/errors"
+	"golang.org/x/mod/modfile"
+)
+
+// EachGowork calls f for each Go workspace in dir and its subdirectories.
+// A Go workspace is identified by the presence of a go.work file.
+// The arguments to f are the directory containing the go.work file
+// (which will have dir as a prefix)
+// and the parsed go.work file.
+// This function calls Walker.EachGowork with a default Walker.
+func EachGowork(dir string, f func(string, *modfile.WorkFile) error) error {
+	var w Walker
+	return w.EachGowork(dir, f)
+}
+
+// EachGowork calls f for each Go workspace in dir and its subdirectories.
+// A Go workspace is identified by the presence of a go.work file.
+// The arguments to f are the directory containing the go.work file
+// (which will have dir as a prefix)
+// and the parsed go.work file.
+//
+// The go.work file is parsed with [modfile.ParseWork],
+// using w.VersionFixer.
+func (w *Walker) EachGowork(dir string, f func(string, *modfile.WorkFile) error) error {
+	return w.eachFile(dir, "go.work", func(subdir string) error {
+		goworkPath := filepath.Join(subdir, "go.work")
+		data, err := os.ReadFile(goworkPath)
+		if err != nil {
+			return errors.Wrapf(err, "reading %s", goworkPath)
+		}
+
+		wf, err := modfile.ParseWork(goworkPath, data, w.VersionFixer)
+		if err != nil {
+			return ParseError{GomodPath: goworkPath, Err: err}
+		}
+
+		return f(subdir, wf)
+	})
+}
+
+// readGowork reads and parses the go.work file in dir.
+// If there is none,
+// it returns nil and no error.
+func (w *Walker) readGowork(dir string) (*modfile.WorkFile, error) {
+	goworkPath := filepath.Join(dir, "go.work")
+	data, err := os.ReadFile(goworkPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "reading %s", goworkPath)
+	}
+	wf, err := modfile.ParseWork(goworkPath, data, w.VersionFixer)
+	if err != nil {
+		return nil, ParseError{GomodPath: goworkPath, Err: err}
+	}
+	return wf, nil
+}
+
+// writeGowork writes wf to the go.work file in dir in canonical form,
+// preserving the file's permissions.
+func writeGowork(dir string, wf *modfile.WorkFile) error {
+	goworkPath := filepath.Join(dir, "go.work")
+
+	wf.Cleanup()
+	data := modfile.Format(wf.Syntax)
+
+	perm := fs.FileMode(0644)
+	if info, err := os.Stat(goworkPath); err == nil {
+		perm = info.Mode().Perm()
+	}
+	return errors.Wrapf(os.WriteFile(goworkPath, data, perm), "writing %s", goworkPath)
+}
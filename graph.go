@@ -0,0 +1,273 @@
+package modules
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/bobg/errors"
+	"golang.org/x/mod/modfile"
+)
+
+// Module describes a Go module found in a directory tree.
+type Module struct {
+	// Dir is the directory containing the module's go.mod file,
+	// as passed to the callback of [Walker.Each].
+	Dir string
+
+	// Path is the module path, from the go.mod file's module directive.
+	Path string
+
+	// Gomod is the parsed go.mod file.
+	Gomod *modfile.File
+
+	// Git is the last git commit affecting the module's files
+	// (not counting those of modules nested within it).
+	// It is set only if [Walker.GitMetadata] is true,
+	// and then only if the module is in a git work tree
+	// and has committed files.
+	Git *GitInfo
+}
+
+// Graph is the graph of dependencies among the Go modules in a directory tree.
+// Dependencies on modules outside the tree are not included.
+type Graph struct {
+	// Nodes are the modules in the tree,
+	// in the order [Walker.Each] visits them.
+	Nodes []*ModuleNode
+
+	// Label, if non-nil, produces the label for a node when rendering the graph with [Graph.DOT].
+	// The default is [ModulePathLabel].
+	Label func(*ModuleNode) string
+}
+
+// ModuleNode is a node in a [Graph].
+type ModuleNode struct {
+	*Module
+
+	// Deps are the modules in the tree that this one depends on,
+	// in the order of Graph.Nodes.
+	Deps []*ModuleNode
+
+	// Dependents are the modules in the tree that depend on this one,
+	// in the order of Graph.Nodes.
+	Dependents []*ModuleNode
+}
+
+// BuildModuleGraph builds the [Graph] of the Go modules in dir and its subdirectories.
+// This function calls Walker.BuildModuleGraph with a default Walker.
+func BuildModuleGraph(dir string) (*Graph, error) {
+	var w Walker
+	return w.BuildModuleGraph(dir)
+}
+
+// BuildModuleGraph builds the [Graph] of the Go modules in dir and its subdirectories.
+//
+// Module A depends on module B if A's go.mod file requires B's module path,
+// or has a replace directive pointing to B's directory.
+// If w.GraphImports is true,
+// A also depends on B if any package in A imports a package in B;
+// this requires loading packages
+// (see [Walker.BuildImportGraph])
+// but catches dependencies that go.mod files don't mention,
+// as can happen in workspace mode.
+//
+// If more than one module in the tree has the same module path,
+// requires of that path are attributed to the first one found.
+func (w *Walker) BuildModuleGraph(dir string) (*Graph, error) {
+	var (
+		g         = new(Graph)
+		byPath    = make(map[string]*ModuleNode)
+		byAbsDir  = make(map[string]*ModuleNode)
+		byDir     = make(map[string]*ModuleNode)
+		nodeIndex = make(map[*ModuleNode]int)
+	)
+
+	err := w.EachGomod(dir, func(subdir string, mf *modfile.File) error {
+		absDir, err := filepath.Abs(subdir)
+		if err != nil {
+			return errors.Wrapf(err, "getting absolute path of %s", subdir)
+		}
+		m, err := w.newModule(subdir, mf)
+		if err != nil {
+			return err
+		}
+		node := &ModuleNode{Module: m}
+		nodeIndex[node] = len(g.Nodes)
+		g.Nodes = append(g.Nodes, node)
+		if _, ok := byPath[node.Path]; !ok && node.Path != "" {
+			byPath[node.Path] = node
+		}
+		byAbsDir[absDir] = node
+		byDir[subdir] = node
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	edges := make(map[[2]*ModuleNode]bool)
+	addEdge := func(from, to *ModuleNode) {
+		if from == to || edges[[2]*ModuleNode{from, to}] {
+			return
+		}
+		edges[[2]*ModuleNode{from, to}] = true
+		from.Deps = append(from.Deps, to)
+		to.Dependents = append(to.Dependents, from)
+	}
+
+	for _, node := range g.Nodes {
+		for _, req := range node.Gomod.Require {
+			if dep, ok := byPath[req.Mod.Path]; ok {
+				addEdge(node, dep)
+			}
+		}
+		for _, rep := range node.Gomod.Replace {
+			if !modfile.IsDirectoryPath(rep.New.Path) {
+				continue
+			}
+			target := rep.New.Path
+			if !filepath.IsAbs(target) {
+				target = filepath.Join(node.Dir, target)
+			}
+			target, err := filepath.Abs(target)
+			if err != nil {
+				return nil, errors.Wrapf(err, "getting absolute path of %s", rep.New.Path)
+			}
+			if dep, ok := byAbsDir[target]; ok {
+				addEdge(node, dep)
+			}
+		}
+	}
+
+	if w.GraphImports {
+		ig, err := w.BuildImportGraph(dir)
+		if err != nil {
+			return nil, errors.Wrap(err, "building import graph")
+		}
+		for _, n := range ig.Nodes {
+			from := byDir[n.ModuleDir]
+			for _, imp := range n.Imports {
+				if to := byDir[imp.ModuleDir]; from != nil && to != nil {
+					addEdge(from, to)
+				}
+			}
+		}
+	}
+
+	for _, node := range g.Nodes {
+		sortModuleNodes(node.Deps, nodeIndex)
+		sortModuleNodes(node.Dependents, nodeIndex)
+	}
+
+	return g, nil
+}
+
+func sortModuleNodes(nodes []*ModuleNode, index map[*ModuleNode]int) {
+	sort.Slice(nodes, func(i, j int) bool {
+		return index[nodes[i]] < index[nodes[j]]
+	})
+}
+
+// TopoSort returns the nodes of the graph in topological order:
+// each module appears after all the modules it depends on.
+// Among modules whose relative order is not constrained,
+// the order of g.Nodes is preserved.
+// If the graph contains a cycle,
+// TopoSort returns a [*CycleError].
+func (g *Graph) TopoSort() ([]*ModuleNode, error) {
+	var (
+		result  []*ModuleNode
+		pending = make(map[*ModuleNode]int) // number of deps not yet in result
+		done    = make(map[*ModuleNode]bool)
+	)
+	for _, node := range g.Nodes {
+		pending[node] = len(node.Deps)
+	}
+
+	for len(result) < len(g.Nodes) {
+		progress := false
+		for _, node := range g.Nodes {
+			if done[node] || pending[node] > 0 {
+				continue
+			}
+			done[node] = true
+			result = append(result, node)
+			for _, dependent := range node.Dependents {
+				pending[dependent]--
+			}
+			progress = true
+			break // rescan from the start, so earlier nodes take priority
+		}
+		if !progress {
+			return nil, &CycleError{Cycle: g.findCycle(done)}
+		}
+	}
+
+	return result, nil
+}
+
+// findCycle finds a cycle among the nodes not in done.
+func (g *Graph) findCycle(done map[*ModuleNode]bool) []*ModuleNode {
+	for _, start := range g.Nodes {
+		if done[start] {
+			continue
+		}
+		if cycle := findCycleFrom(start, done); cycle != nil {
+			return cycle
+		}
+	}
+	return nil
+}
+
+// findCycleFrom finds a cycle reachable from start,
+// following Deps edges and ignoring nodes in done.
+func findCycleFrom(start *ModuleNode, done map[*ModuleNode]bool) []*ModuleNode {
+	var (
+		stack   []*ModuleNode
+		onStack = make(map[*ModuleNode]int)
+		visited = make(map[*ModuleNode]bool)
+		visit   func(*ModuleNode) []*ModuleNode
+	)
+	visit = func(node *ModuleNode) []*ModuleNode {
+		if i, ok := onStack[node]; ok {
+			return append([]*ModuleNode{}, stack[i:]...)
+		}
+		if visited[node] || done[node] {
+			return nil
+		}
+		visited[node] = true
+		onStack[node] = len(stack)
+		stack = append(stack, node)
+		for _, dep := range node.Deps {
+			if cycle := visit(dep); cycle != nil {
+				return cycle
+			}
+		}
+		stack = stack[:len(stack)-1]
+		delete(onStack, node)
+		return nil
+	}
+	return visit(start)
+}
+
+// CycleError is the error returned by [Graph.TopoSort] when the graph contains a cycle.
+// It also describes each cycle found by [Graph.Cycles].
+type CycleError struct {
+	// Cycle is a list of modules,
+	// each of which depends on the next,
+	// with the last depending on the first.
+	Cycle []*ModuleNode
+}
+
+func (e *CycleError) Error() string {
+	names := make([]string, 0, len(e.Cycle)+1)
+	for _, node := range e.Cycle {
+		names = append(names, node.Dir)
+	}
+	if len(e.Cycle) > 0 {
+		names = append(names, e.Cycle[0].Dir)
+	}
+	return fmt.Sprintf("module dependency cycle: %s", strings.Join(names, " -> "))
+}
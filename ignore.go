@@ -0,0 +1,186 @@
+package modules
+
+import (
+	"bufio"
+	"bytes"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/bobg/errors"
+)
+
+// IgnoreFileName is the name of the file listing directories for a [Walker] to skip.
+// It may appear in the root of a walk and in any of its subdirectories.
+//
+// Its syntax is like that of .gitignore files.
+// Each line is a pattern,
+// in the syntax of [path.Match] plus "**" for any number of directory levels,
+// matching directories relative to the directory containing the file.
+// Blank lines and lines beginning with "#" are ignored.
+// A pattern containing no "/" except at the end matches directories of that name at any depth;
+// other patterns are anchored to the directory containing the file.
+// A pattern beginning with "!" re-includes directories matched by earlier patterns,
+// including those in ignore files in parent directories.
+// As with .gitignore,
+// a directory cannot be re-included if a parent of it is skipped.
+const IgnoreFileName = ".modulesignore"
+
+type ignoreRule struct {
+	pattern  string
+	negate   bool
+	anchored bool
+}
+
+// ignorer decides which directories in a tree are excluded by [IgnoreFileName] files.
+// A nil *ignorer excludes nothing.
+type ignorer struct {
+	root string
+
+	// readFile reads ignore files.
+	// If it is nil, os.ReadFile is used.
+	readFile func(string) ([]byte, error)
+
+	mu    sync.Mutex
+	rules map[string][]ignoreRule // by directory; cached
+}
+
+// newIgnorer returns an ignorer for the tree rooted at root,
+// or nil if w.NoIgnoreFiles is true.
+func (w *Walker) newIgnorer(root string) *ignorer {
+	if w.NoIgnoreFiles {
+		return nil
+	}
+	return &ignorer{root: root, rules: make(map[string][]ignoreRule)}
+}
+
+// ignored tells whether dir,
+// a subdirectory of ig's root,
+// is excluded by the ignore files in its parent directories
+// up to the root.
+// It does not check whether any of those parent directories is excluded.
+func (ig *ignorer) ignored(dir string) (bool, error) {
+	if ig == nil {
+		return false, nil
+	}
+	rel, err := filepath.Rel(ig.root, dir)
+	if err != nil || rel == "." || !filepath.IsLocal(rel) {
+		return false, nil
+	}
+	rel = filepath.ToSlash(rel)
+
+	var (
+		result bool
+		base   = ig.root
+		parts  = strings.Split(rel, "/")
+	)
+	for i := range parts {
+		rules, err := ig.rulesIn(base)
+		if err != nil {
+			return false, err
+		}
+		sub := strings.Join(parts[i:], "/")
+		for _, rule := range rules {
+			if rule.matches(sub) {
+				result = !rule.negate
+			}
+		}
+		base = filepath.Join(base, parts[i])
+	}
+	return result, nil
+}
+
+// rulesIn returns the rules in the ignore file in dir.
+func (ig *ignorer) rulesIn(dir string) ([]ignoreRule, error) {
+	ig.mu.Lock()
+	defer ig.mu.Unlock()
+
+	if rules, ok := ig.rules[dir]; ok {
+		return rules, nil
+	}
+	rules, err := ig.readIgnoreFile(filepath.Join(dir, IgnoreFileName))
+	if err != nil {
+		return nil, err
+	}
+	ig.rules[dir] = rules
+	return rules, nil
+}
+
+func (ig *ignorer) readIgnoreFile(filename string) ([]ignoreRule, error) {
+	readFile := ig.readFile
+	if readFile == nil {
+		readFile = os.ReadFile
+	}
+	data, err := readFile(filename)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "reading %s", filename)
+	}
+
+	var (
+		rules []ignoreRule
+		sc    = bufio.NewScanner(bytes.NewReader(data))
+	)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		var rule ignoreRule
+		if strings.HasPrefix(line, "!") {
+			rule.negate = true
+			line = line[1:]
+		}
+		line = strings.TrimSuffix(line, "/") // Only directories are matched anyway.
+		if strings.Contains(line, "/") {
+			rule.anchored = true
+			line = strings.TrimPrefix(line, "/")
+		}
+		if line == "" {
+			continue
+		}
+		if _, err := path.Match(line, ""); err != nil {
+			return nil, errors.Wrapf(err, "in pattern %q in %s", line, filename)
+		}
+		rule.pattern = line
+		rules = append(rules, rule)
+	}
+	return rules, errors.Wrapf(sc.Err(), "reading %s", filename)
+}
+
+// matches tells whether the rule matches rel,
+// the slash-separated path of a directory relative to the ignore file's directory.
+func (r ignoreRule) matches(rel string) bool {
+	if !r.anchored {
+		return matchSegments([]string{r.pattern}, []string{path.Base(rel)})
+	}
+	return matchSegments(strings.Split(r.pattern, "/"), strings.Split(rel, "/"))
+}
+
+// matchSegments matches path segments against pattern segments,
+// where a "**" pattern segment matches any number of path segments.
+func matchSegments(pattern, segments []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(segments); i++ {
+				if matchSegments(pattern[1:], segments[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(segments) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], segments[0]); !ok {
+			return false
+		}
+		pattern, segments = pattern[1:], segments[1:]
+	}
+	return len(segments) == 0
+}
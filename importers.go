@@ -0,0 +1,85 @@
+package modules
+
+import (
+	"sort"
+	"strings"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// Importer describes a package that imports some target module or package.
+// See [Walker.ImportersOf].
+type Importer struct {
+	// ModuleDir is the directory of the module containing the importing package.
+	ModuleDir string
+
+	// PkgPath is the import path of the importing package.
+	PkgPath string
+
+	// Imports are the matching import paths, sorted.
+	Imports []string
+}
+
+// ImportersOf reports the packages in the Go modules in dir and its subdirectories
+// that directly import target,
+// which may be a module path or a package path.
+// This function calls Walker.ImportersOf with a default Walker.
+func ImportersOf(dir, target string) ([]Importer, error) {
+	var w Walker
+	return w.ImportersOf(dir, target)
+}
+
+// ImportersOf reports the packages in the Go modules in dir and its subdirectories
+// that directly import target,
+// which may be a module path or a package path.
+// An import matches if it is target itself or any path beneath it,
+// so when target is a module path,
+// imports of any package in that module match.
+//
+// Packages are loaded as with [Walker.LoadEach],
+// except that only package metadata is requested,
+// not types or syntax.
+// If w.LoadTests is true,
+// imports in test files are included too.
+// The result is in the order the modules were visited,
+// and sorted by package path within each module.
+func (w *Walker) ImportersOf(dir, target string) ([]Importer, error) {
+	var result []Importer
+
+	err := w.withLoadMode(metadataLoadMode).LoadEach(dir, func(subdir string, pkgs []*packages.Package) error {
+		byPkgPath := make(map[string]map[string]bool)
+		for _, pkg := range pkgs {
+			if strings.HasSuffix(pkg.PkgPath, ".test") {
+				continue // synthesized test main
+			}
+			for path := range pkg.Imports {
+				if path != target && !strings.HasPrefix(path, target+"/") {
+					continue
+				}
+				if byPkgPath[pkg.PkgPath] == nil {
+					byPkgPath[pkg.PkgPath] = make(map[string]bool)
+				}
+				byPkgPath[pkg.PkgPath][path] = true
+			}
+		}
+
+		pkgPaths := make([]string, 0, len(byPkgPath))
+		for pkgPath := range byPkgPath {
+			pkgPaths = append(pkgPaths, pkgPath)
+		}
+		sort.Strings(pkgPaths)
+
+		for _, pkgPath := range pkgPaths {
+			imp := Importer{ModuleDir: subdir, PkgPath: pkgPath}
+			for path := range byPkgPath[pkgPath] {
+				imp.Imports = append(imp.Imports, path)
+			}
+			sort.Strings(imp.Imports)
+			result = append(result, imp)
+		}
+
+		return nil
+	})
+
+	return result, err
+}
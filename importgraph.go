@@ -0,0 +1,218 @@
+package modules
+
+import (
+	"path/filepath"
+	"sort"
+
+	"github.com/bobg/errors"
+	"golang.org/x/tools/go/packages"
+)
+
+// ImportGraph is a graph of the packages in a tree of Go modules,
+// with edges for the imports among them,
+// including imports that cross module boundaries.
+// Packages from outside the tree
+// (such as the standard library and third-party dependencies)
+// are not included.
+type ImportGraph struct {
+	// Nodes maps package paths to nodes.
+	Nodes map[string]*ImportNode
+}
+
+// ImportNode is a node in an [ImportGraph].
+type ImportNode struct {
+	// PkgPath is the import path of the package.
+	PkgPath string
+
+	// ModuleDir is the directory of the module containing the package,
+	// as passed to the callback of [Walker.Each].
+	ModuleDir string
+
+	// ModulePath is the module path of the module containing the package.
+	ModulePath string
+
+	// Dir is the directory containing the package's files.
+	Dir string
+
+	// Imports are the nodes for the packages in the graph that this one imports,
+	// sorted by PkgPath.
+	Imports []*ImportNode
+
+	// ImportedBy are the nodes for the packages in the graph that import this one,
+	// sorted by PkgPath.
+	ImportedBy []*ImportNode
+}
+
+// BuildImportGraph builds the [ImportGraph] for the Go modules in dir and its subdirectories.
+// This function calls Walker.BuildImportGraph with a default Walker.
+func BuildImportGraph(dir string) (*ImportGraph, error) {
+	var w Walker
+	return w.BuildImportGraph(dir)
+}
+
+// BuildImportGraph builds the [ImportGraph] for the Go modules in dir and its subdirectories.
+// Packages are loaded as with [Walker.LoadEach],
+// except that only the package metadata needed for the graph is requested,
+// not types or syntax.
+func (w *Walker) BuildImportGraph(dir string) (*ImportGraph, error) {
+	moduleDirs, err := w.absModuleDirs(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	g := &ImportGraph{Nodes: make(map[string]*ImportNode)}
+
+	node := func(pkg *packages.Package) *ImportNode {
+		if pkg.Module == nil {
+			return nil
+		}
+		moduleDir, ok := moduleDirs[filepath.Clean(pkg.Module.Dir)]
+		if !ok {
+			return nil
+		}
+		n, ok := g.Nodes[pkg.PkgPath]
+		if !ok {
+			n = &ImportNode{
+				PkgPath:    pkg.PkgPath,
+				ModuleDir:  moduleDir,
+				ModulePath: pkg.Module.Path,
+				Dir:        pkgDir(pkg),
+			}
+			g.Nodes[pkg.PkgPath] = n
+		}
+		return n
+	}
+
+	edges := make(map[[2]string]bool)
+
+	err = w.withLoadMode(metadataLoadMode).LoadEach(dir, func(subdir string, pkgs []*packages.Package) error {
+		packages.Visit(pkgs, nil, func(pkg *packages.Package) {
+			if isTestVariant(pkg) {
+				return
+			}
+			from := node(pkg)
+			if from == nil {
+				return
+			}
+			for _, imp := range pkg.Imports {
+				to := node(imp)
+				if to == nil {
+					continue
+				}
+				edge := [2]string{from.PkgPath, to.PkgPath}
+				if edges[edge] {
+					continue
+				}
+				edges[edge] = true
+				from.Imports = append(from.Imports, to)
+				to.ImportedBy = append(to.ImportedBy, from)
+			}
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, n := range g.Nodes {
+		sortImportNodes(n.Imports)
+		sortImportNodes(n.ImportedBy)
+	}
+
+	return g, nil
+}
+
+// pkgDir returns the directory containing pkg's files,
+// or the empty string if that can't be determined.
+func pkgDir(pkg *packages.Package) string {
+	for _, files := range [][]string{pkg.GoFiles, pkg.OtherFiles, pkg.IgnoredFiles} {
+		if len(files) > 0 {
+			return filepath.Dir(files[0])
+		}
+	}
+	return ""
+}
+
+// absModuleDirs returns a map from the absolute paths of the Go modules in dir and its subdirectories
+// to their paths as passed to the callback of [Walker.Each].
+func (w *Walker) absModuleDirs(dir string) (map[string]string, error) {
+	result := make(map[string]string)
+	err := w.Each(dir, func(subdir string) error {
+		abs, err := filepath.Abs(subdir)
+		if err != nil {
+			return errors.Wrapf(err, "getting absolute path of %s", subdir)
+		}
+		result[abs] = subdir
+		return nil
+	})
+	return result, err
+}
+
+// Roots returns the nodes in the graph that no other node imports,
+// sorted by PkgPath.
+func (g *ImportGraph) Roots() []*ImportNode {
+	var result []*ImportNode
+	for _, n := range g.Nodes {
+		if len(n.ImportedBy) == 0 {
+			result = append(result, n)
+		}
+	}
+	sortImportNodes(result)
+	return result
+}
+
+// Leaves returns the nodes in the graph that import no other node,
+// sorted by PkgPath.
+func (g *ImportGraph) Leaves() []*ImportNode {
+	var result []*ImportNode
+	for _, n := range g.Nodes {
+		if len(n.Imports) == 0 {
+			result = append(result, n)
+		}
+	}
+	sortImportNodes(result)
+	return result
+}
+
+// Path returns a shortest chain of imports leading from the package from to the package to,
+// as a list of package paths beginning with from and ending with to.
+// It returns nil if there is no such chain,
+// or if either package is not in the graph.
+func (g *ImportGraph) Path(from, to string) []string {
+	start, ok := g.Nodes[from]
+	if !ok {
+		return nil
+	}
+	if _, ok := g.Nodes[to]; !ok {
+		return nil
+	}
+
+	prev := map[string]string{from: ""}
+	queue := []*ImportNode{start}
+	for len(queue) > 0 {
+		n := queue[0]
+		queue = queue[1:]
+		if n.PkgPath == to {
+			var result []string
+			for p := to; p != ""; p = prev[p] {
+				result = append([]string{p}, result...)
+			}
+			return result
+		}
+		for _, imp := range n.Imports {
+			if _, ok := prev[imp.PkgPath]; ok {
+				continue
+			}
+			prev[imp.PkgPath] = n.PkgPath
+			queue = append(queue, imp)
+		}
+	}
+
+	return nil
+}
+
+func sortImportNodes(nodes []*ImportNode) {
+	sort.Slice(nodes, func(i, j int) bool {
+		return nodes[i].PkgPath < nodes[j].PkgPath
+	})
+}
@@ -0,0 +1,494 @@
+package modules
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/bobg/errors"
+)
+
+const (
+	// IndexDir is the subdirectory,
+	// in the root of a tree,
+	// where [Walker.OpenIndex] keeps the tree's [Index].
+	// Being hidden,
+	// it is not itself walked.
+	IndexDir = ".modules-cache"
+
+	// IndexFileName is the name of the file in [IndexDir] holding the [Index].
+	IndexFileName = "index.json"
+)
+
+// indexVersion is the version of the on-disk index format.
+// Index files with a different version are rebuilt.
+const indexVersion = 1
+
+// Index records the Go modules in a directory tree and what they require,
+// so that later questions about the tree can be answered without walking it again.
+// Create one with [Walker.BuildIndex] or [Walker.OpenIndex].
+//
+// An Index also records the modification times of the directories in the tree
+// and of their go.mod and [IgnoreFileName] files,
+// so that [Walker.RevalidateIndex] can cheaply tell whether it is out of date
+// and update only what changed.
+type Index struct {
+	// Root is the root of the indexed tree,
+	// as passed to [Walker.BuildIndex].
+	Root string
+
+	// Modules are the modules in the tree,
+	// in the order [Walker.Each] visits them.
+	Modules []IndexModule
+
+	settings string
+	dirs     map[string]dirStamp // keyed by slash-separated path relative to Root
+}
+
+// IndexModule describes one module in an [Index].
+type IndexModule struct {
+	// Dir is the directory containing the module's go.mod file,
+	// as passed to the callback of [Walker.Each].
+	Dir string `json:"dir"`
+
+	// Path is the module path,
+	// or the empty string if the go.mod file has no module directive.
+	Path string `json:"path"`
+
+	GoVersion string             `json:"goVersion,omitempty"`
+	Requires  []InventoryRequire `json:"requires,omitempty"`
+	Replaces  []InventoryReplace `json:"replaces,omitempty"`
+
+	// Submodule is the top directory of the git submodule checkout containing Dir,
+	// or the empty string if there is none,
+	// as in [Visit].
+	Submodule string `json:"submodule,omitempty"`
+
+	gomod fileStamp
+}
+
+// fileStamp identifies a version of a file by its modification time and size.
+// The zero value means the file does not exist.
+type fileStamp struct {
+	ModTime time.Time `json:"modTime"`
+	Size    int64     `json:"size"`
+}
+
+// dirStamp identifies a version of a directory's entries,
+// and of the ignore file in it.
+type dirStamp struct {
+	ModTime time.Time `json:"modTime"`
+	Ignore  fileStamp `json:"ignore"`
+}
+
+// Module returns the module in idx with the given module path.
+// The boolean result is false if there is none.
+func (idx *Index) Module(modpath string) (IndexModule, bool) {
+	for _, m := range idx.Modules {
+		if m.Path == modpath {
+			return m, true
+		}
+	}
+	return IndexModule{}, false
+}
+
+// Dependents returns the modules in idx that require the module with the given module path,
+// in index order.
+func (idx *Index) Dependents(modpath string) []IndexModule {
+	var result []IndexModule
+	for _, m := range idx.Modules {
+		for _, req := range m.Requires {
+			if req.Path == modpath {
+				result = append(result, m)
+				break
+			}
+		}
+	}
+	return result
+}
+
+// BuildIndex walks dir and its subdirectories and returns an [Index] of the Go modules found.
+// This function calls Walker.BuildIndex with a default Walker.
+func BuildIndex(dir string) (*Index, error) {
+	var w Walker
+	return w.BuildIndex(dir)
+}
+
+// BuildIndex walks dir and its subdirectories and returns an [Index] of the Go modules found,
+// parsing each go.mod file as [Walker.EachGomod] does.
+// The walk is not stopped early by w.Limit.
+//
+// An Index depends on the settings of w that affect which directories are walked
+// and how go.mod files are parsed.
+// Using an Index with a Walker whose settings differ causes it to be rebuilt.
+// (Only w.VersionFixer is not checked.)
+func (w *Walker) BuildIndex(dir string) (*Index, error) {
+	return w.buildIndex(dir, nil)
+}
+
+// buildIndex walks dir to build an index,
+// reusing the entries in prev for go.mod files that have not changed.
+// The prev argument may be nil.
+func (w *Walker) buildIndex(dir string, prev *Index) (*Index, error) {
+	idx := &Index{
+		Root:     dir,
+		settings: w.indexSettings(),
+		dirs:     make(map[string]dirStamp),
+	}
+
+	var reuse map[string]IndexModule
+	if prev != nil && prev.settings == idx.settings {
+		reuse = make(map[string]IndexModule, len(prev.Modules))
+		for _, m := range prev.Modules {
+			reuse[m.Dir] = m
+		}
+	}
+
+	var (
+		stampErr   error
+		submodules = make(map[string]bool)
+	)
+
+	ws := w.newWalkState(dir)
+	ws.onVisit = func(subdir string) {
+		stamp, err := statDir(subdir)
+		if err != nil {
+			stampErr = errors.Join(stampErr, err)
+			return
+		}
+		idx.dirs[idx.rel(subdir)] = stamp
+	}
+
+	err := w.each(ws, dir, "go.mod", func(subdir string) error {
+		gomodPath := filepath.Join(subdir, "go.mod")
+		stamp, err := statFile(gomodPath)
+		if err != nil {
+			return err
+		}
+		m, ok := reuse[subdir]
+		if !ok || !m.gomod.equal(stamp) {
+			if m, err = w.indexModule(subdir, stamp); err != nil {
+				return err
+			}
+		}
+		// Recomputed even for reused entries,
+		// since a .git file may have been added or removed above subdir.
+		if m.Submodule, err = submoduleOf(dir, subdir, submodules); err != nil {
+			return err
+		}
+		idx.Modules = append(idx.Modules, m)
+		return nil
+	})
+	if errors.Is(err, filepath.SkipAll) {
+		err = nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if stampErr != nil {
+		return nil, stampErr
+	}
+
+	w.log(slog.LevelDebug, "built index", "dir", dir, "modules", len(idx.Modules), "dirs", len(idx.dirs))
+
+	return idx, nil
+}
+
+// indexModule parses the go.mod file in dir,
+// whose stamp is given,
+// and returns its index entry.
+func (w *Walker) indexModule(dir string, stamp fileStamp) (IndexModule, error) {
+	_, mf, err := w.readGomod(dir)
+	if err != nil {
+		return IndexModule{}, err
+	}
+	m := IndexModule{Dir: dir, gomod: stamp}
+	if mf.Module != nil {
+		m.Path = mf.Module.Mod.Path
+	}
+	if mf.Go != nil {
+		m.GoVersion = mf.Go.Version
+	}
+	for _, req := range mf.Require {
+		m.Requires = append(m.Requires, InventoryRequire{
+			Path:     req.Mod.Path,
+			Version:  req.Mod.Version,
+			Indirect: req.Indirect,
+		})
+	}
+	for _, rep := range mf.Replace {
+		m.Replaces = append(m.Replaces, InventoryReplace{
+			OldPath:    rep.Old.Path,
+			OldVersion: rep.Old.Version,
+			NewPath:    rep.New.Path,
+			NewVersion: rep.New.Version,
+		})
+	}
+	return m, nil
+}
+
+// indexSettings summarizes the settings of w that affect the contents of an [Index].
+func (w *Walker) indexSettings() string {
+	links := w.Links
+	if links == 0 {
+		links = LinkSkip
+	}
+	submodules := w.Submodules
+	if submodules == 0 {
+		submodules = SubmoduleEnter
+	}
+	return fmt.Sprintf("vendor=%t testdata=%t noignore=%t nongo=%t links=%s submodules=%s lax=%t", w.IncludeVendor, w.IncludeTestdata, w.NoIgnoreFiles, w.SkipNonGoDirs, links, submodules, w.ParseLax)
+}
+
+// RevalidateIndex brings idx up to date with the tree it describes.
+// This function calls Walker.RevalidateIndex with a default Walker.
+func RevalidateIndex(idx *Index) (*Index, bool, error) {
+	var w Walker
+	return w.RevalidateIndex(idx)
+}
+
+// RevalidateIndex brings idx up to date with the tree it describes,
+// returning the updated index
+// and a boolean telling whether anything changed.
+// If nothing changed,
+// the result is idx itself.
+//
+// If no directory in the tree has changed
+// (judging by modification times,
+// which change when entries are added, removed, or renamed),
+// and no [IgnoreFileName] file has changed,
+// the tree is not walked again;
+// only the go.mod files that have changed are reparsed.
+// Otherwise the tree is walked again,
+// but go.mod files that have not changed are still not reparsed.
+// If idx was built with different settings from those of w,
+// it is rebuilt from scratch.
+func (w *Walker) RevalidateIndex(idx *Index) (*Index, bool, error) {
+	if idx.settings != w.indexSettings() {
+		w.log(slog.LevelDebug, "rebuilding index", "dir", idx.Root, "reason", "settings changed")
+		result, err := w.BuildIndex(idx.Root)
+		return result, err == nil, err
+	}
+
+	for rel, stamp := range idx.dirs {
+		dir := filepath.Join(idx.Root, filepath.FromSlash(rel))
+		current, err := statDir(dir)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, false, err
+		}
+		if err != nil || !current.ModTime.Equal(stamp.ModTime) || !current.Ignore.equal(stamp.Ignore) {
+			w.log(slog.LevelDebug, "rebuilding index", "dir", idx.Root, "reason", "directory changed", "changed", dir)
+			result, err := w.buildIndex(idx.Root, idx)
+			return result, err == nil, err
+		}
+	}
+
+	var result *Index
+	for i, m := range idx.Modules {
+		stamp, err := statFile(filepath.Join(m.Dir, "go.mod"))
+		if err != nil {
+			return nil, false, err
+		}
+		if stamp.equal(m.gomod) {
+			continue
+		}
+		if result == nil {
+			cp := *idx
+			cp.Modules = append([]IndexModule(nil), idx.Modules...)
+			result = &cp
+		}
+		w.log(slog.LevelDebug, "reindexing module", "dir", m.Dir)
+		sub := m.Submodule
+		if result.Modules[i], err = w.indexModule(m.Dir, stamp); err != nil {
+			return nil, false, err
+		}
+		result.Modules[i].Submodule = sub
+	}
+	if result == nil {
+		return idx, false, nil
+	}
+	return result, true, nil
+}
+
+// OpenIndex returns an up-to-date [Index] of the Go modules in dir and its subdirectories,
+// using and maintaining the one stored in dir.
+// This function calls Walker.OpenIndex with a default Walker.
+func OpenIndex(dir string) (*Index, error) {
+	var w Walker
+	return w.OpenIndex(dir)
+}
+
+// OpenIndex returns an up-to-date [Index] of the Go modules in dir and its subdirectories.
+//
+// The index is read from the file [IndexFileName] in the subdirectory [IndexDir] of dir,
+// and revalidated with [Walker.RevalidateIndex].
+// If the file does not exist,
+// cannot be decoded,
+// or is for a different root
+// (as spelled in dir),
+// a new index is built with [Walker.BuildIndex].
+// If the index is new or has changed,
+// it is written back to the file,
+// creating [IndexDir] if necessary.
+func (w *Walker) OpenIndex(dir string) (*Index, error) {
+	var (
+		indexDir  = filepath.Join(dir, IndexDir)
+		indexFile = filepath.Join(indexDir, IndexFileName)
+	)
+
+	idx, err := ReadIndex(indexFile)
+	if err == nil && idx.Root != dir {
+		err = fmt.Errorf("index is for %s", idx.Root)
+	}
+	if err == nil {
+		result, changed, err := w.RevalidateIndex(idx)
+		if err != nil {
+			return nil, err
+		}
+		if !changed {
+			return result, nil
+		}
+		return result, result.WriteFile(indexFile)
+	}
+	w.log(slog.LevelDebug, "building index", "dir", dir, "reason", err)
+
+	// Create indexDir before walking,
+	// so that doing so does not change the stamp of dir.
+	if err := os.MkdirAll(indexDir, 0755); err != nil {
+		return nil, errors.Wrapf(err, "creating %s", indexDir)
+	}
+	if idx, err = w.BuildIndex(dir); err != nil {
+		return nil, err
+	}
+	return idx, idx.WriteFile(indexFile)
+}
+
+// indexFile is the on-disk form of an [Index].
+// Directories other than Root are relative to Root.
+type indexFile struct {
+	Version  int                 `json:"version"`
+	Root     string              `json:"root"`
+	Settings string              `json:"settings"`
+	Modules  []indexFileModule   `json:"modules"`
+	Dirs     map[string]dirStamp `json:"dirs"`
+}
+
+type indexFileModule struct {
+	IndexModule
+	Gomod fileStamp `json:"gomod"`
+}
+
+// ReadIndex reads an [Index] from a file written by [Index.WriteFile].
+// It is not revalidated;
+// see [Walker.RevalidateIndex].
+func ReadIndex(filename string) (*Index, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, errors.Wrapf(err, "reading %s", filename)
+	}
+
+	var f indexFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, errors.Wrapf(err, "decoding %s", filename)
+	}
+	if f.Version != indexVersion {
+		return nil, fmt.Errorf("index %s has version %d, want %d", filename, f.Version, indexVersion)
+	}
+
+	idx := &Index{
+		Root:     f.Root,
+		settings: f.Settings,
+		dirs:     f.Dirs,
+	}
+	if idx.dirs == nil {
+		idx.dirs = make(map[string]dirStamp)
+	}
+	for _, m := range f.Modules {
+		m.IndexModule.gomod = m.Gomod
+		m.IndexModule.Dir = filepath.Join(f.Root, filepath.FromSlash(m.IndexModule.Dir))
+		idx.Modules = append(idx.Modules, m.IndexModule)
+	}
+	return idx, nil
+}
+
+// WriteFile writes idx to filename,
+// for reading with [ReadIndex].
+// The file is replaced atomically,
+// so concurrent readers see either the old or the new index.
+func (idx *Index) WriteFile(filename string) error {
+	f := indexFile{
+		Version:  indexVersion,
+		Root:     idx.Root,
+		Settings: idx.settings,
+		Modules:  make([]indexFileModule, 0, len(idx.Modules)),
+		Dirs:     idx.dirs,
+	}
+	for _, m := range idx.Modules {
+		fm := indexFileModule{IndexModule: m, Gomod: m.gomod}
+		fm.IndexModule.Dir = idx.rel(m.Dir)
+		f.Modules = append(f.Modules, fm)
+	}
+	data, err := json.Marshal(f)
+	if err != nil {
+		return errors.Wrap(err, "encoding index")
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(filename), filepath.Base(filename)+".*")
+	if err != nil {
+		return errors.Wrapf(err, "creating temporary file for %s", filename)
+	}
+	defer os.Remove(tmp.Name()) // Fails harmlessly after the rename.
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return errors.Wrapf(err, "writing %s", tmp.Name())
+	}
+	if err := tmp.Close(); err != nil {
+		return errors.Wrapf(err, "closing %s", tmp.Name())
+	}
+	return errors.Wrapf(os.Rename(tmp.Name(), filename), "renaming %s to %s", tmp.Name(), filename)
+}
+
+// rel returns dir relative to idx.Root,
+// slash-separated.
+func (idx *Index) rel(dir string) string {
+	rel, err := filepath.Rel(idx.Root, dir)
+	if err != nil {
+		return filepath.ToSlash(dir)
+	}
+	return filepath.ToSlash(rel)
+}
+
+func (s fileStamp) equal(other fileStamp) bool {
+	return s.ModTime.Equal(other.ModTime) && s.Size == other.Size
+}
+
+// statFile returns the stamp of the file at path,
+// or the zero stamp if there is none.
+func statFile(path string) (fileStamp, error) {
+	info, err := os.Stat(osPath(path))
+	if errors.Is(err, fs.ErrNotExist) {
+		return fileStamp{}, nil
+	}
+	if err != nil {
+		return fileStamp{}, errors.Wrapf(err, "statting %s", path)
+	}
+	return fileStamp{ModTime: info.ModTime(), Size: info.Size()}, nil
+}
+
+// statDir returns the stamp of dir.
+func statDir(dir string) (dirStamp, error) {
+	info, err := os.Stat(osPath(dir))
+	if err != nil {
+		return dirStamp{}, errors.Wrapf(err, "statting %s", dir)
+	}
+	ignore, err := statFile(filepath.Join(dir, IgnoreFileName))
+	if err != nil {
+		return dirStamp{}, err
+	}
+	return dirStamp{ModTime: info.ModTime(), Ignore: ignore}, nil
+}
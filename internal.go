@@ -0,0 +1,114 @@
+package modules
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// InternalViolation is an import of an internal package
+// from a module in the tree other than the one containing it,
+// by a package that should not be able to import it.
+// See [Walker.InternalViolations].
+type InternalViolation struct {
+	// ModuleDir and PkgPath identify the importing package.
+	ModuleDir string
+	PkgPath   string
+
+	// ImportModuleDir and Import identify the imported internal package.
+	ImportModuleDir string
+	Import          string
+
+	// Reason explains the violation.
+	Reason string
+}
+
+// InternalViolations finds imports that cross internal-package boundaries
+// between the Go modules in dir and its subdirectories.
+// This function calls Walker.InternalViolations with a default Walker.
+func InternalViolations(dir string) ([]InternalViolation, error) {
+	var w Walker
+	return w.InternalViolations(dir)
+}
+
+// InternalViolations finds imports that cross internal-package boundaries
+// between the Go modules in dir and its subdirectories.
+//
+// A package whose path contains an "internal" element
+// may be imported only by packages rooted at the parent of that element.
+// The go command enforces this by import path,
+// but when local replace directives are in play
+// the import paths may not reflect where the code actually lives,
+// so this checks both:
+// an import of an internal package in one module of the tree
+// by a package in another
+// is a violation if the importer's path is outside the internal package's parent path,
+// or if the importer's directory is outside the internal package's parent directory.
+//
+// Imports within a single module are left to the go command.
+// The imports are found with [Walker.BuildImportGraph].
+// The result is sorted by PkgPath and then by Import.
+func (w *Walker) InternalViolations(dir string) ([]InternalViolation, error) {
+	g, err := w.BuildImportGraph(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []InternalViolation
+	for _, n := range g.Nodes {
+		for _, imp := range n.Imports {
+			if imp.ModuleDir == n.ModuleDir || !isInternalPath(imp.PkgPath) {
+				continue
+			}
+			if reason := internalViolation(n, imp); reason != "" {
+				result = append(result, InternalViolation{
+					ModuleDir:       n.ModuleDir,
+					PkgPath:         n.PkgPath,
+					ImportModuleDir: imp.ModuleDir,
+					Import:          imp.PkgPath,
+					Reason:          reason,
+				})
+			}
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].PkgPath != result[j].PkgPath {
+			return result[i].PkgPath < result[j].PkgPath
+		}
+		return result[i].Import < result[j].Import
+	})
+	return result, nil
+}
+
+// internalViolation tells why the package of node from may not import the internal package of node to,
+// or returns the empty string if it may.
+func internalViolation(from, to *ImportNode) string {
+	// The parent is everything before the last "internal" element.
+	elems := strings.Split(to.PkgPath, "/")
+	i := len(elems) - 1
+	for i >= 0 && elems[i] != "internal" {
+		i--
+	}
+	if i < 0 {
+		return ""
+	}
+	parent := strings.Join(elems[:i], "/")
+
+	if parent != "" && from.PkgPath != parent && !strings.HasPrefix(from.PkgPath, parent+"/") {
+		return "importer's path is outside " + parent
+	}
+
+	if to.Dir == "" || from.Dir == "" {
+		return ""
+	}
+	parentDir := to.Dir
+	for j := i; j < len(elems); j++ {
+		parentDir = filepath.Dir(parentDir)
+	}
+	if rel, err := filepath.Rel(parentDir, from.Dir); err != nil || !filepath.IsLocal(rel) {
+		return "importer's directory is outside " + parentDir
+	}
+
+	return ""
+}
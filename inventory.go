@@ -0,0 +1,123 @@
+package modules
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/bobg/errors"
+	"golang.org/x/mod/modfile"
+	"golang.org/x/tools/go/packages"
+)
+
+// InventoryFormat is an output format for [Walker.WriteInventory].
+type InventoryFormat int
+
+const (
+	// InventoryJSON produces a single JSON array of [InventoryEntry] objects.
+	InventoryJSON InventoryFormat = iota
+
+	// InventoryNDJSON produces newline-delimited JSON:
+	// one [InventoryEntry] object per line.
+	InventoryNDJSON
+)
+
+// InventoryEntry describes one module in the output of [Walker.WriteInventory].
+type InventoryEntry struct {
+	Dir       string             `json:"dir"`
+	Path      string             `json:"path"`
+	GoVersion string             `json:"goVersion,omitempty"`
+	Requires  []InventoryRequire `json:"requires,omitempty"`
+	Replaces  []InventoryReplace `json:"replaces,omitempty"`
+	Packages  int                `json:"packages"`
+}
+
+// InventoryRequire describes a require directive in an [InventoryEntry].
+type InventoryRequire struct {
+	Path     string `json:"path"`
+	Version  string `json:"version"`
+	Indirect bool   `json:"indirect,omitempty"`
+}
+
+// InventoryReplace describes a replace directive in an [InventoryEntry].
+type InventoryReplace struct {
+	OldPath    string `json:"oldPath"`
+	OldVersion string `json:"oldVersion,omitempty"`
+	NewPath    string `json:"newPath"`
+	NewVersion string `json:"newVersion,omitempty"`
+}
+
+// WriteInventory writes a machine-readable description of each Go module in dir and its subdirectories to out.
+// This function calls Walker.WriteInventory with a default Walker.
+func WriteInventory(dir string, out io.Writer, format InventoryFormat) error {
+	var w Walker
+	return w.WriteInventory(dir, out, format)
+}
+
+// WriteInventory writes a machine-readable description of each Go module in dir and its subdirectories to out.
+// Each module is described by an [InventoryEntry],
+// in JSON form.
+// The format argument says whether to write a single JSON array
+// or newline-delimited JSON objects.
+//
+// Packages are loaded as with [Walker.LoadEach]
+// in order to count them,
+// but only package names are requested.
+func (w *Walker) WriteInventory(dir string, out io.Writer, format InventoryFormat) error {
+	if format != InventoryJSON && format != InventoryNDJSON {
+		return fmt.Errorf("unknown inventory format %d", format)
+	}
+
+	var (
+		entries []InventoryEntry
+		enc     = json.NewEncoder(out)
+	)
+
+	err := w.withLoadMode(packages.NeedName).LoadEachGomod(dir, func(subdir string, mf *modfile.File, pkgs []*packages.Package) error {
+		entry := InventoryEntry{Dir: subdir}
+		if mf.Module != nil {
+			entry.Path = mf.Module.Mod.Path
+		}
+		if mf.Go != nil {
+			entry.GoVersion = mf.Go.Version
+		}
+		for _, req := range mf.Require {
+			entry.Requires = append(entry.Requires, InventoryRequire{
+				Path:     req.Mod.Path,
+				Version:  req.Mod.Version,
+				Indirect: req.Indirect,
+			})
+		}
+		for _, rep := range mf.Replace {
+			entry.Replaces = append(entry.Replaces, InventoryReplace{
+				OldPath:    rep.Old.Path,
+				OldVersion: rep.Old.Version,
+				NewPath:    rep.New.Path,
+				NewVersion: rep.New.Version,
+			})
+		}
+		for _, pkg := range pkgs {
+			if !isTestVariant(pkg) {
+				entry.Packages++
+			}
+		}
+
+		if format == InventoryNDJSON {
+			return errors.Wrapf(enc.Encode(entry), "writing inventory entry for %s", subdir)
+		}
+		entries = append(entries, entry)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if format == InventoryJSON {
+		if entries == nil {
+			entries = []InventoryEntry{}
+		}
+		return errors.Wrap(enc.Encode(entries), "writing inventory")
+	}
+
+	return nil
+}
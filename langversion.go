@@ -0,0 +1,291 @@
+package modules
+
+import (
+	"go/ast"
+	"go/build/constraint"
+	"go/token"
+	"go/types"
+	"sort"
+	"strings"
+
+	"golang.org/x/mod/modfile"
+	"golang.org/x/tools/go/packages"
+)
+
+// LanguageFeatureUse is a use of a Go language feature
+// that requires a newer Go version than the one in effect where it appears.
+// See [Walker.LanguageFeatureEach].
+type LanguageFeatureUse struct {
+	// Feature describes the language feature,
+	// such as "type parameters" or "min builtin".
+	Feature string
+
+	// GoVersion is the first Go version supporting the feature,
+	// such as "1.18".
+	GoVersion string
+
+	// EffectiveVersion is the Go version in effect where the feature is used:
+	// the module's go directive,
+	// or a higher version required by the file's //go:build constraint.
+	EffectiveVersion string
+
+	// PkgPath is the import path of the package using the feature.
+	PkgPath string
+
+	// Position is the position of the use.
+	Position token.Position
+}
+
+// defaultGoDirective is the language version the go command assumes for a module whose go.mod has no go directive.
+const defaultGoDirective = "1.16"
+
+// languageFeatureLoadMode is what [Walker.LanguageFeatureEach] needs loaded.
+const languageFeatureLoadMode = packages.NeedName | packages.NeedFiles | packages.NeedCompiledGoFiles | packages.NeedSyntax | packages.NeedTypes | packages.NeedTypesInfo | packages.NeedModule
+
+// LanguageFeatureEach finds uses of Go language features
+// that are newer than the go directive of the module using them,
+// for each Go module in dir and its subdirectories.
+// This function calls Walker.LanguageFeatureEach with a default Walker.
+func LanguageFeatureEach(dir string, f func(string, *modfile.File, []LanguageFeatureUse) error) error {
+	var w Walker
+	return w.LanguageFeatureEach(dir, f)
+}
+
+// LanguageFeatureEach finds uses of Go language features
+// that are newer than the go directive of the module using them,
+// for each Go module in dir and its subdirectories.
+// The callback receives the module's directory
+// (which will have dir as a prefix),
+// its parsed go.mod file,
+// and the offending uses in its packages,
+// sorted by position.
+//
+// A file whose //go:build constraint requires a newer Go version
+// (such as "//go:build go1.21")
+// may use the features of that version.
+// A module with no go directive is treated as declaring go 1.16,
+// as the go command does.
+//
+// The features detected include
+// binary, octal, and digit-separated number literals (1.13),
+// slice-to-array-pointer conversions and unsafe.Add and unsafe.Slice (1.17),
+// type parameters and instantiations, any, and comparable (1.18),
+// slice-to-array conversions and unsafe.SliceData, unsafe.String, and unsafe.StringData (1.20),
+// the min, max, and clear builtins (1.21),
+// ranging over integers (1.22),
+// ranging over functions (1.23),
+// and generic type aliases (1.24).
+// A new toolchain compiling with an old go directive reports most of these as errors,
+// but only when someone builds with a toolchain new enough to know about them;
+// this check finds them regardless.
+//
+// Packages are loaded as with [Walker.LoadEachGomod],
+// except that only what this check needs is requested.
+// Type-checking errors caused by the very features being reported do not prevent reporting them,
+// unless the Walker is configured to fail on package errors.
+func (w *Walker) LanguageFeatureEach(dir string, f func(string, *modfile.File, []LanguageFeatureUse) error) error {
+	return w.withLoadMode(languageFeatureLoadMode).LoadEachGomod(dir, func(subdir string, mf *modfile.File, pkgs []*packages.Package) error {
+		declared := defaultGoDirective
+		if mf.Go != nil {
+			declared = mf.Go.Version
+		}
+
+		type key struct {
+			pos     token.Position
+			feature string
+		}
+		var (
+			uses []LanguageFeatureUse
+			seen = make(map[key]bool) // test variants repeat their package's files
+		)
+		for _, pkg := range pkgs {
+			if pkg.TypesInfo == nil {
+				continue
+			}
+			for _, file := range pkg.Syntax {
+				effective := declared
+				if v := fileGoVersion(file); compareGoVersions(v, effective) > 0 {
+					effective = v
+				}
+				report := func(node ast.Node, feature, version string) {
+					if compareGoVersions(version, effective) <= 0 {
+						return
+					}
+					pos := pkg.Fset.Position(node.Pos())
+					if k := (key{pos: pos, feature: feature}); !seen[k] {
+						seen[k] = true
+						uses = append(uses, LanguageFeatureUse{
+							Feature:          feature,
+							GoVersion:        version,
+							EffectiveVersion: effective,
+							PkgPath:          pkg.PkgPath,
+							Position:         pos,
+						})
+					}
+				}
+				ast.Inspect(file, func(node ast.Node) bool {
+					findLanguageFeatures(pkg.TypesInfo, node, report)
+					return true
+				})
+			}
+		}
+
+		sort.Slice(uses, func(i, j int) bool {
+			a, b := uses[i].Position, uses[j].Position
+			if a.Filename != b.Filename {
+				return a.Filename < b.Filename
+			}
+			return a.Offset < b.Offset
+		})
+		return f(subdir, mf, uses)
+	})
+}
+
+// languageBuiltins maps the names of builtins
+// (including those of package unsafe)
+// added since Go 1.13 to the versions that added them.
+var languageBuiltins = map[string]string{
+	"Add":        "1.17",
+	"Slice":      "1.17",
+	"SliceData":  "1.20",
+	"String":     "1.20",
+	"StringData": "1.20",
+	"min":        "1.21",
+	"max":        "1.21",
+	"clear":      "1.21",
+}
+
+// findLanguageFeatures calls report for each versioned language feature used in node itself
+// (not its children).
+func findLanguageFeatures(info *types.Info, node ast.Node, report func(ast.Node, string, string)) {
+	switch node := node.(type) {
+	case *ast.FuncType:
+		if node.TypeParams != nil && len(node.TypeParams.List) > 0 {
+			report(node, "type parameters", "1.18")
+		}
+
+	case *ast.TypeSpec:
+		if node.TypeParams != nil && len(node.TypeParams.List) > 0 {
+			if node.Assign.IsValid() {
+				report(node, "generic type aliases", "1.24")
+			} else {
+				report(node, "type parameters", "1.18")
+			}
+		}
+
+	case *ast.BasicLit:
+		if node.Kind == token.INT || node.Kind == token.FLOAT || node.Kind == token.IMAG {
+			lit := strings.ToLower(node.Value)
+			if strings.Contains(lit, "_") || strings.HasPrefix(lit, "0b") || strings.HasPrefix(lit, "0o") || (strings.HasPrefix(lit, "0x") && strings.Contains(lit, "p")) {
+				report(node, "number literal syntax", "1.13")
+			}
+		}
+
+	case *ast.Ident:
+		if _, ok := info.Instances[node]; ok {
+			report(node, "generic instantiation", "1.18")
+		}
+		switch obj := info.Uses[node].(type) {
+		case *types.Builtin:
+			if v, ok := languageBuiltins[obj.Name()]; ok {
+				name := obj.Name()
+				if name != "min" && name != "max" && name != "clear" {
+					name = "unsafe." + name
+				}
+				report(node, name+" builtin", v)
+			}
+		case *types.TypeName:
+			if obj.Pkg() == nil && (obj.Name() == "any" || obj.Name() == "comparable") && obj == types.Universe.Lookup(obj.Name()) {
+				report(node, obj.Name(), "1.18")
+			}
+		case nil:
+			// The type checker records no object for a predeclared identifier
+			// that the module's language version doesn't have.
+			if _, defined := info.Defs[node]; !defined && (node.Name == "any" || node.Name == "comparable") {
+				report(node, node.Name, "1.18")
+			}
+		}
+
+	case *ast.RangeStmt:
+		if t := info.TypeOf(node.X); t != nil {
+			switch u := t.Underlying().(type) {
+			case *types.Basic:
+				if u.Info()&types.IsInteger != 0 {
+					report(node, "range over integer", "1.22")
+				}
+			case *types.Signature:
+				report(node, "range over function", "1.23")
+			}
+		}
+
+	case *ast.CallExpr:
+		if len(node.Args) != 1 {
+			return
+		}
+		tv, ok := info.Types[node.Fun]
+		if !ok || !tv.IsType() {
+			return
+		}
+		argType := info.TypeOf(node.Args[0])
+		if argType == nil {
+			return
+		}
+		if _, ok := argType.Underlying().(*types.Slice); !ok {
+			return
+		}
+		switch target := tv.Type.Underlying().(type) {
+		case *types.Array:
+			report(node, "slice to array conversion", "1.20")
+		case *types.Pointer:
+			if _, ok := target.Elem().Underlying().(*types.Array); ok {
+				report(node, "slice to array pointer conversion", "1.17")
+			}
+		}
+	}
+}
+
+// fileGoVersion returns the minimum Go version required by the //go:build constraint of file,
+// such as "1.21" for "//go:build go1.21 && linux",
+// or the empty string if it requires none.
+func fileGoVersion(file *ast.File) string {
+	for _, group := range file.Comments {
+		if group.Pos() >= file.Package {
+			break
+		}
+		for _, c := range group.List {
+			if !constraint.IsGoBuild(c.Text) {
+				continue
+			}
+			expr, err := constraint.Parse(c.Text)
+			if err != nil {
+				return ""
+			}
+			return constraintGoVersion(expr)
+		}
+	}
+	return ""
+}
+
+// constraintGoVersion returns the minimum Go version implied by a build constraint expression,
+// or the empty string if it implies none.
+func constraintGoVersion(expr constraint.Expr) string {
+	switch expr := expr.(type) {
+	case *constraint.TagExpr:
+		if v, ok := strings.CutPrefix(expr.Tag, "go"); ok && compareGoVersions(v, "1.0") > 0 {
+			return v
+		}
+	case *constraint.AndExpr:
+		x, y := constraintGoVersion(expr.X), constraintGoVersion(expr.Y)
+		if compareGoVersions(x, y) > 0 {
+			return x
+		}
+		return y
+	case *constraint.OrExpr:
+		x, y := constraintGoVersion(expr.X), constraintGoVersion(expr.Y)
+		if compareGoVersions(x, y) < 0 {
+			return x
+		}
+		return y
+	}
+	return ""
+}
@@ -0,0 +1,448 @@
+package modules
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/bobg/errors"
+	"golang.org/x/mod/modfile"
+)
+
+const (
+	// LicenseUnknown is the license reported for a dependency
+	// whose license files are not recognized.
+	LicenseUnknown = "unknown"
+
+	// LicenseNotFound is the license reported for a dependency
+	// with no license files,
+	// or whose source is unavailable.
+	LicenseNotFound = "none"
+)
+
+// DependencyLicense describes the licensing of one dependency of a Go module.
+type DependencyLicense struct {
+	// Path and Version identify the dependency.
+	Path    string
+	Version string
+
+	// Indirect tells whether the dependency is an indirect one.
+	Indirect bool
+
+	// Dir is the directory holding the dependency's source
+	// (normally in the module cache,
+	// or the target of a local replace directive),
+	// or the empty string if the source is unavailable.
+	Dir string
+
+	// Files are the license files found at the top level of Dir,
+	// sorted.
+	Files []string
+
+	// Licenses are the SPDX identifiers of the licenses detected in Files,
+	// sorted.
+	// It is [LicenseUnknown] if there are license files but none is recognized,
+	// and [LicenseNotFound] if there are no license files.
+	Licenses []string
+}
+
+// ModuleLicenses is the license inventory for one Go module.
+type ModuleLicenses struct {
+	// Dir is the directory containing the module's go.mod file.
+	Dir string
+
+	// Path is the module path.
+	Path string
+
+	// Deps are the module's dependencies,
+	// as listed by "go list -m all",
+	// in the same order.
+	Deps []DependencyLicense
+}
+
+// LicenseReport is the result of [Walker.LicenseInventory].
+type LicenseReport struct {
+	// Modules are the per-module inventories,
+	// in the order [Walker.Each] visits the modules.
+	Modules []ModuleLicenses
+
+	// ByLicense maps each license found
+	// (including [LicenseUnknown] and [LicenseNotFound])
+	// to the dependencies using it,
+	// across all modules,
+	// as sorted "path@version" strings.
+	// A dual-licensed dependency appears under each of its licenses.
+	ByLicense map[string][]string
+}
+
+// LicenseInventory reports the licenses of the dependencies of each Go module in dir and its subdirectories.
+// This function calls Walker.LicenseInventory with a default Walker.
+func LicenseInventory(dir string) (*LicenseReport, error) {
+	var w Walker
+	return w.LicenseInventory(dir)
+}
+
+// LicenseInventory reports the licenses of the dependencies of each Go module in dir and its subdirectories.
+//
+// Each module's dependencies are the modules in its build list,
+// as reported by "go list -m all"
+// (with the settings in w.Env, w.GOFLAGS, and w.GOWORK).
+// Dependencies missing from the module cache are downloaded with "go mod download".
+// Replaced dependencies are inspected at their replacements.
+//
+// Licenses are detected by looking for files named like LICENSE, LICENCE, or COPYING
+// at the top level of each dependency
+// and matching them against the distinctive text of common licenses:
+// Apache-2.0, MIT, BSD-2-Clause, BSD-3-Clause, ISC, MPL-2.0, EPL-2.0,
+// the GPL family, Unlicense, and CC0-1.0.
+// This is a heuristic,
+// not a substitute for legal review.
+func (w *Walker) LicenseInventory(dir string) (*LicenseReport, error) {
+	var (
+		report  = &LicenseReport{ByLicense: make(map[string][]string)}
+		byDir   = make(map[string]licenseScan) // memoizes scans of dependency dirs
+		seen    = make(map[[2]string]bool)     // license, path@version
+		scanDir = func(dir string) (licenseScan, error) {
+			if s, ok := byDir[dir]; ok {
+				return s, nil
+			}
+			s, err := scanLicenses(dir)
+			if err != nil {
+				return s, err
+			}
+			byDir[dir] = s
+			return s, nil
+		}
+	)
+
+	err := w.EachGomod(dir, func(subdir string, mf *modfile.File) error {
+		ml := ModuleLicenses{Dir: subdir}
+		if mf.Module != nil {
+			ml.Path = mf.Module.Mod.Path
+		}
+
+		deps, err := w.listModules(subdir, "all")
+		if err != nil {
+			return errors.Wrapf(err, "listing dependencies of %s", subdir)
+		}
+		if err := w.downloadMissing(subdir, deps); err != nil {
+			return errors.Wrapf(err, "downloading dependencies of %s", subdir)
+		}
+
+		for _, dep := range deps {
+			if dep.Main {
+				continue
+			}
+			dl := DependencyLicense{
+				Path:     dep.Path,
+				Version:  dep.Version,
+				Indirect: dep.Indirect,
+				Dir:      dep.Dir,
+			}
+			if dl.Dir != "" {
+				s, err := scanDir(dl.Dir)
+				if err != nil {
+					return err
+				}
+				dl.Files, dl.Licenses = s.files, s.licenses
+			}
+			if len(dl.Licenses) == 0 {
+				dl.Licenses = []string{LicenseNotFound}
+			}
+			ml.Deps = append(ml.Deps, dl)
+
+			id := dl.Path
+			if dl.Version != "" {
+				id += "@" + dl.Version
+			}
+			for _, lic := range dl.Licenses {
+				if key := [2]string{lic, id}; !seen[key] {
+					seen[key] = true
+					report.ByLicense[lic] = append(report.ByLicense[lic], id)
+				}
+			}
+		}
+
+		report.Modules = append(report.Modules, ml)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, ids := range report.ByLicense {
+		sort.Strings(ids)
+	}
+	return report, nil
+}
+
+// downloadMissing downloads the modules in deps that have no source directory,
+// filling in their Dir fields.
+// Modules that can't be downloaded are left alone.
+func (w *Walker) downloadMissing(dir string, deps []listedModule) error {
+	var (
+		args  = []string{"mod", "download", "-json"}
+		index = make(map[string]int)
+	)
+	for i, dep := range deps {
+		if dep.Main || dep.Dir != "" || dep.Error != nil {
+			continue
+		}
+		mod := dep
+		if dep.Replace != nil {
+			mod = *dep.Replace
+		}
+		if mod.Version == "" {
+			continue // A missing local replacement.
+		}
+		arg := mod.Path + "@" + mod.Version
+		index[arg] = i
+		args = append(args, arg)
+	}
+	if len(index) == 0 {
+		return nil
+	}
+
+	// The go command exits with an error if any module fails to download,
+	// but still reports on the others.
+	out, err := w.goCmd(dir, args...)
+	downloaded, decodeErr := decodeListedModules(out)
+	if decodeErr != nil {
+		return errors.Join(err, decodeErr)
+	}
+	for _, d := range downloaded {
+		if i, ok := index[d.Path+"@"+d.Version]; ok && d.Dir != "" {
+			deps[i].Dir = d.Dir
+		}
+	}
+	return nil
+}
+
+type licenseScan struct {
+	files, licenses []string
+}
+
+var licenseFileRegex = regexp.MustCompile(`(?i)^(un)?licen[cs]e|^copying`)
+
+// scanLicenses finds and classifies the license files at the top level of dir.
+func scanLicenses(dir string) (licenseScan, error) {
+	var result licenseScan
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return result, errors.Wrapf(err, "reading %s", dir)
+	}
+
+	found := make(map[string]bool)
+	for _, entry := range entries {
+		if entry.IsDir() || !licenseFileRegex.MatchString(entry.Name()) {
+			continue
+		}
+		result.files = append(result.files, entry.Name())
+
+		path := filepath.Join(dir, entry.Name())
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return result, errors.Wrapf(err, "reading %s", path)
+		}
+		ids := detectLicenses(string(data))
+		if len(ids) == 0 {
+			ids = []string{LicenseUnknown}
+		}
+		for _, id := range ids {
+			found[id] = true
+		}
+	}
+
+	// Don't report unknown alongside a recognized license,
+	// as from an unrecognized notice or authors file.
+	if len(found) > 1 {
+		delete(found, LicenseUnknown)
+	}
+	for id := range found {
+		result.licenses = append(result.licenses, id)
+	}
+	sort.Strings(result.files)
+	sort.Strings(result.licenses)
+	return result, nil
+}
+
+// detectLicenses returns the SPDX identifiers of the licenses whose text appears in text.
+func detectLicenses(text string) []string {
+	text = strings.Join(strings.Fields(strings.ToLower(text)), " ")
+	has := func(s string) bool { return strings.Contains(text, s) }
+
+	var result []string
+
+	// The GPL family's texts mention one another,
+	// so check the most specific first.
+	switch {
+	case has("gnu affero general public license"):
+		result = append(result, "AGPL-3.0")
+	case has("gnu lesser general public license") || has("gnu library general public license"):
+		if has("version 3, 29 june 2007") {
+			result = append(result, "LGPL-3.0")
+		} else {
+			result = append(result, "LGPL-2.1")
+		}
+	case has("gnu general public license"):
+		if has("version 3, 29 june 2007") {
+			result = append(result, "GPL-3.0")
+		} else {
+			result = append(result, "GPL-2.0")
+		}
+	}
+
+	if has("apache license") && has("version 2.0") {
+		result = append(result, "Apache-2.0")
+	}
+	if has("permission is hereby granted, free of charge, to any person obtaining a copy") {
+		result = append(result, "MIT")
+	}
+	if has("redistribution and use in source and binary forms") {
+		if has("neither the name") || has("names of its contributors") {
+			result = append(result, "BSD-3-Clause")
+		} else {
+			result = append(result, "BSD-2-Clause")
+		}
+	}
+	if has("distribute this software for any purpose with or without fee is hereby granted") {
+		result = append(result, "ISC")
+	}
+	if has("mozilla public license") && has("2.0") {
+		result = append(result, "MPL-2.0")
+	}
+	if has("eclipse public license") && has("2.0") {
+		result = append(result, "EPL-2.0")
+	}
+	if has("this is free and unencumbered software released into the public domain") {
+		result = append(result, "Unlicense")
+	}
+	if has("cc0 1.0 universal") {
+		result = append(result, "CC0-1.0")
+	}
+
+	return result
+}
+
+// LicensePolicy says which dependency licenses are acceptable.
+// See [LicensePolicy.Check].
+type LicensePolicy struct {
+	// Allow, if non-empty,
+	// lists the SPDX identifiers of the only acceptable licenses.
+	// Include [LicenseUnknown] and [LicenseNotFound] to accept dependencies
+	// whose licenses could not be determined.
+	Allow []string
+
+	// Deny lists the SPDX identifiers of unacceptable licenses.
+	// It takes precedence over Allow.
+	Deny []string
+
+	// Exempt lists dependencies that are not checked,
+	// each as a module path
+	// (exempting all versions)
+	// or as "path@version".
+	Exempt []string
+
+	// Overrides maps module paths of modules in the tree
+	// to the policies that apply to them instead of this one.
+	// Overrides within an override are ignored.
+	Overrides map[string]*LicensePolicy
+}
+
+// LicenseViolation is a dependency license that a [LicensePolicy] does not accept.
+type LicenseViolation struct {
+	// ModuleDir and ModulePath identify the module in the tree with the offending dependency.
+	ModuleDir, ModulePath string
+
+	// Dep is the offending dependency.
+	Dep DependencyLicense
+
+	// License is the SPDX identifier
+	// (or [LicenseUnknown] or [LicenseNotFound])
+	// of the unacceptable license.
+	License string
+
+	// Denied tells whether License is in the policy's Deny list,
+	// as opposed to missing from its Allow list.
+	Denied bool
+}
+
+// Check evaluates the license inventory in report against p.
+// A dependency with several licenses
+// (for instance, dual-licensed)
+// may be used under any one of them,
+// so it is accepted if any of them is.
+// Only when none is acceptable
+// is each of its licenses reported as a violation.
+// Violations are returned in the order of report.Modules and their dependencies,
+// and by license within a dependency.
+func (p *LicensePolicy) Check(report *LicenseReport) []LicenseViolation {
+	var result []LicenseViolation
+	for _, ml := range report.Modules {
+		policy := p
+		if override, ok := p.Overrides[ml.Path]; ok && override != nil {
+			policy = override
+		}
+		for _, dep := range ml.Deps {
+			if policy.exempt(dep) || policy.acceptsAny(dep.Licenses) {
+				continue
+			}
+			for _, lic := range dep.Licenses {
+				result = append(result, LicenseViolation{
+					ModuleDir:  ml.Dir,
+					ModulePath: ml.Path,
+					Dep:        dep,
+					License:    lic,
+					Denied:     slices.Contains(policy.Deny, lic),
+				})
+			}
+		}
+	}
+	return result
+}
+
+// acceptsAny tells whether any of licenses is acceptable under p:
+// not denied,
+// and allowed if p has an allow list.
+func (p *LicensePolicy) acceptsAny(licenses []string) bool {
+	for _, lic := range licenses {
+		if !slices.Contains(p.Deny, lic) && (len(p.Allow) == 0 || slices.Contains(p.Allow, lic)) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *LicensePolicy) exempt(dep DependencyLicense) bool {
+	for _, e := range p.Exempt {
+		if e == dep.Path || e == dep.Path+"@"+dep.Version {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckLicenses evaluates the licenses of the dependencies of each Go module in dir and its subdirectories
+// against a policy.
+// This function calls Walker.CheckLicenses with a default Walker.
+func CheckLicenses(dir string, policy *LicensePolicy) ([]LicenseViolation, error) {
+	var w Walker
+	return w.CheckLicenses(dir, policy)
+}
+
+// CheckLicenses evaluates the licenses of the dependencies of each Go module in dir and its subdirectories
+// against policy,
+// returning the violations.
+// It is [Walker.LicenseInventory] followed by [LicensePolicy.Check];
+// an empty result means the tree complies.
+func (w *Walker) CheckLicenses(dir string, policy *LicensePolicy) ([]LicenseViolation, error) {
+	report, err := w.LicenseInventory(dir)
+	if err != nil {
+		return nil, err
+	}
+	return policy.Check(report), nil
+}
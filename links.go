@@ -0,0 +1,161 @@
+package modules
+
+import (
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/bobg/errors"
+)
+
+// LinkPolicy controls how a [Walker] treats symbolic links to directories,
+// and on Windows,
+// junctions and other reparse points.
+// See [Walker.Links].
+type LinkPolicy int
+
+const (
+	// LinkSkip means links are not walked into.
+	// This is the default.
+	LinkSkip LinkPolicy = iota + 1
+
+	// LinkFollow means links to directories are walked into like ordinary directories.
+	// Each directory is visited at most once,
+	// however many links lead to it,
+	// so links that form loops do not make the walk loop.
+	LinkFollow
+)
+
+func (p LinkPolicy) String() string {
+	switch p {
+	case LinkSkip:
+		return "skip"
+	case LinkFollow:
+		return "follow"
+	}
+	return "unknown"
+}
+
+// walkState is the state of a single walk of a tree.
+type walkState struct {
+	ig *ignorer
+
+	// seen is the set of real paths of directories visited,
+	// when following links.
+	mu   sync.Mutex
+	seen map[string]bool
+
+	// onVisit, if not nil,
+	// is called with each directory on its first visit.
+	// It may be called concurrently.
+	onVisit func(dir string)
+}
+
+func (w *Walker) newWalkState(root string) *walkState {
+	ws := &walkState{ig: w.newIgnorer(root)}
+	if w.Links == LinkFollow {
+		ws.seen = make(map[string]bool)
+	}
+	return ws
+}
+
+// firstVisit tells whether this is the first visit to dir in the walk.
+// It is always true unless links are being followed.
+func (ws *walkState) firstVisit(dir string) (bool, error) {
+	if ws.seen == nil {
+		ws.visited(dir)
+		return true, nil
+	}
+	resolved, err := filepath.EvalSymlinks(osPath(dir))
+	if err != nil {
+		return false, errors.Wrapf(err, "resolving %s", dir)
+	}
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	if ws.seen[resolved] {
+		return false, nil
+	}
+	ws.seen[resolved] = true
+	ws.visited(dir)
+	return true, nil
+}
+
+func (ws *walkState) visited(dir string) {
+	if ws.onVisit != nil {
+		ws.onVisit(dir)
+	}
+}
+
+// subdirs reads dir,
+// reporting whether it contains a file with the given name
+// (as [hasFile] does,
+// but without a separate call to stat the file)
+// and returning the entries for the subdirectories of dir that w walks into,
+// in lexical order.
+// Depending on w.Links,
+// these may include links to directories.
+//
+// If w.PruneLeaves is true
+// and dir is known to have no subdirectories,
+// it is not read;
+// only the file is checked for.
+func (w *Walker) subdirs(ws *walkState, dir, filename string) (found bool, result []fs.DirEntry, err error) {
+	end := w.startSpan(SpanScan, slog.String("dir", dir))
+	defer func() { end(err) }()
+
+	// Link counts don't count symlinks to directories,
+	// which are subdirectories when following links.
+	if w.PruneLeaves && w.Links != LinkFollow && isLeafDir(dir) {
+		w.log(LevelTrace, "pruning leaf directory", "dir", dir)
+		found, err = hasFile(dir, filename)
+		return found, nil, err
+	}
+
+	entries, err := os.ReadDir(osPath(dir))
+	if err != nil {
+		return false, nil, err
+	}
+
+	for _, entry := range entries {
+		if entry.Name() == filename && !entry.IsDir() {
+			if isLink(entry) {
+				found, err = hasFile(dir, filename)
+				if err != nil {
+					return false, nil, err
+				}
+			} else {
+				found = true
+			}
+			continue
+		}
+
+		subdir := filepath.Join(dir, entry.Name())
+		if !entry.IsDir() {
+			if !isLink(entry) {
+				continue
+			}
+			if w.Links != LinkFollow {
+				w.log(LevelTrace, "skipping link", "dir", subdir)
+				continue
+			}
+			info, err := os.Stat(osPath(subdir))
+			if err != nil || !info.IsDir() {
+				continue // Broken link, or not to a directory.
+			}
+		}
+		if skip, err := w.skipDir(ws.ig, subdir); err != nil {
+			return false, nil, err
+		} else if skip {
+			continue
+		}
+		result = append(result, entry)
+	}
+	return found, result, nil
+}
+
+// logRevisit logs that dir is skipped because it has been visited already via a link.
+func (w *Walker) logRevisit(dir string) {
+	w.log(slog.LevelDebug, "skipping directory", "dir", dir, "reason", "already visited")
+}
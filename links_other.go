@@ -0,0 +1,15 @@
+//go:build !windows
+
+package modules
+
+import "io/fs"
+
+// isLink tells whether entry is a symbolic link.
+func isLink(entry fs.DirEntry) bool {
+	return entry.Type()&fs.ModeSymlink != 0
+}
+
+// osPath returns the form of path to pass to the os package.
+func osPath(path string) string {
+	return path
+}
@@ -0,0 +1,32 @@
+//go:build windows
+
+package modules
+
+import (
+	"io/fs"
+	"path/filepath"
+)
+
+// isLink tells whether entry is a symbolic link or another kind of reparse point,
+// such as a junction,
+// that may refer to a directory.
+func isLink(entry fs.DirEntry) bool {
+	return entry.Type()&(fs.ModeSymlink|fs.ModeIrregular) != 0
+}
+
+// maxRelPath is the length beyond which relative paths are made absolute by [osPath].
+// This is MAX_PATH (260) less room for a file name such as go.mod.
+const maxRelPath = 248
+
+// osPath returns the form of path to pass to the os package.
+// The os package lifts the MAX_PATH limit on Windows only for absolute paths,
+// so long relative paths are made absolute.
+func osPath(path string) string {
+	if len(path) < maxRelPath || filepath.IsAbs(path) {
+		return path
+	}
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return path
+}
@@ -0,0 +1,29 @@
+package modules
+
+import "golang.org/x/tools/go/packages"
+
+// LoadAll loads the packages of every Go module in dir and its subdirectories,
+// returning them in a map keyed by module directory
+// (each of which will have dir as a prefix).
+// This function calls Walker.LoadAll with a default Walker.
+func LoadAll(dir string) (map[string][]*packages.Package, error) {
+	var w Walker
+	return w.LoadAll(dir)
+}
+
+// LoadAll loads the packages of every Go module in dir and its subdirectories,
+// returning them in a map keyed by module directory
+// (each of which will have dir as a prefix).
+//
+// This is a convenience wrapper around [Walker.LoadEach]
+// for callers that need random access to the packages of all modules at once.
+// Note that this keeps everything loaded in memory,
+// which for large trees can be a lot.
+func (w *Walker) LoadAll(dir string) (map[string][]*packages.Package, error) {
+	result := make(map[string][]*packages.Package)
+	err := w.LoadEach(dir, func(subdir string, pkgs []*packages.Package) error {
+		result[subdir] = pkgs
+		return nil
+	})
+	return result, err
+}
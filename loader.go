@@ -0,0 +1,45 @@
+package modules
+
+import (
+	"sync"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// EachLoader calls f for each Go module in dir and its subdirectories,
+// passing it the directory containing the go.mod file
+// (which will have dir as a prefix)
+// and a function for loading the module's packages.
+// This function calls Walker.EachLoader with a default Walker.
+func EachLoader(dir string, f func(string, func() ([]*packages.Package, error)) error) error {
+	var w Walker
+	return w.EachLoader(dir, f)
+}
+
+// EachLoader calls f for each Go module in dir and its subdirectories,
+// passing it the directory containing the go.mod file
+// (which will have dir as a prefix)
+// and a function for loading the module's packages.
+//
+// Packages are loaded only if f calls the load function,
+// so callers that decide whether to process a module based on other criteria
+// (such as the contents of its go.mod file)
+// don't pay the cost of loading modules they skip.
+// The load function loads packages the same way [Walker.LoadEach] does.
+// Calling it more than once returns the same result without reloading.
+func (w *Walker) EachLoader(dir string, f func(string, func() ([]*packages.Package, error)) error) error {
+	return w.Each(dir, func(subdir string) error {
+		var (
+			once sync.Once
+			pkgs []*packages.Package
+			err  error
+		)
+		load := func() ([]*packages.Package, error) {
+			once.Do(func() {
+				pkgs, err = w.load(subdir, 0)
+			})
+			return pkgs, err
+		}
+		return f(subdir, load)
+	})
+}
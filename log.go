@@ -0,0 +1,19 @@
+package modules
+
+import (
+	"context"
+	"log/slog"
+)
+
+// LevelTrace is the [slog.Level] of the most detailed messages logged to [Walker.Logger],
+// such as one for each directory visited.
+const LevelTrace = slog.LevelDebug - 4
+
+// log logs a message to w.Logger at the given level,
+// if w.Logger is non-nil.
+func (w *Walker) log(level slog.Level, msg string, args ...any) {
+	if w.Logger == nil {
+		return
+	}
+	w.Logger.Log(context.Background(), level, msg, args...)
+}
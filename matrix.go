@@ -0,0 +1,202 @@
+package modules
+
+import (
+	"fmt"
+	"go/build/constraint"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/bobg/errors"
+	"golang.org/x/mod/modfile"
+	"golang.org/x/tools/go/packages"
+)
+
+// Platform is a GOOS/GOARCH pair.
+type Platform struct {
+	GOOS, GOARCH string
+}
+
+// String returns the platform in GOOS/GOARCH form,
+// as in "linux/amd64".
+func (p Platform) String() string {
+	return fmt.Sprintf("%s/%s", p.GOOS, p.GOARCH)
+}
+
+// env returns the environment settings selecting this platform.
+func (p Platform) env() []string {
+	return []string{"GOOS=" + p.GOOS, "GOARCH=" + p.GOARCH}
+}
+
+// LoadEachMatrix is like [Walker.LoadEach],
+// but loads each module once for each of the given platforms.
+// This function calls Walker.LoadEachMatrix with a default Walker.
+func LoadEachMatrix(dir string, platforms []Platform, f func(string, map[Platform][]*packages.Package) error) error {
+	var w Walker
+	return w.LoadEachMatrix(dir, platforms, f)
+}
+
+// LoadEachMatrix is like [Walker.LoadEach],
+// but loads each module once for each of the given platforms.
+// The arguments to f are the directory containing the go.mod file
+// (which will have dir as a prefix)
+// and the packages loaded for each platform.
+//
+// Platforms are selected by setting GOOS and GOARCH in the load environment,
+// overriding any settings for those in w.Env or w.LoadConfig.Env.
+// This lets cross-platform checks see files that are excluded by build constraints
+// on the host platform.
+func (w *Walker) LoadEachMatrix(dir string, platforms []Platform, f func(string, map[Platform][]*packages.Package) error) error {
+	return w.Each(dir, func(subdir string) error {
+		result := make(map[Platform][]*packages.Package, len(platforms))
+		for _, p := range platforms {
+			pkgs, err := w.load(subdir, 0, p.env()...)
+			if err != nil {
+				return errors.Wrapf(err, "loading for %s", p)
+			}
+			result[p] = pkgs
+		}
+		return f(subdir, result)
+	})
+}
+
+// MatrixEntry describes one Go module for a CI build matrix.
+// See [Walker.MatrixEach].
+// It has JSON tags for serializing into, for example,
+// a GitHub Actions matrix.
+type MatrixEntry struct {
+	// ModuleDir is the module's directory relative to the tree's root,
+	// with forward slashes,
+	// such as "." or "tools/gen".
+	ModuleDir string `json:"moduleDir"`
+
+	// ModulePath is the module path.
+	ModulePath string `json:"modulePath"`
+
+	// GoVersion is the version in the module's go directive,
+	// or the empty string if there is none.
+	GoVersion string `json:"goVersion"`
+
+	// HasTests tells whether the module contains any _test.go files.
+	HasTests bool `json:"hasTests"`
+
+	// Tags are the custom build tags used in the //go:build constraints of the module's files,
+	// sorted.
+	// Tags for operating systems, architectures, Go versions, compilers, and cgo are omitted.
+	Tags []string `json:"tags,omitempty"`
+}
+
+// MatrixEach describes each Go module in dir and its subdirectories for a CI build matrix.
+// This function calls Walker.MatrixEach with a default Walker.
+func MatrixEach(dir string) ([]MatrixEntry, error) {
+	var w Walker
+	return w.MatrixEach(dir)
+}
+
+// MatrixEach describes each Go module in dir and its subdirectories for a CI build matrix,
+// in the order [Walker.Each] visits them.
+// The result can be serialized with encoding/json
+// and used as, for example,
+// the "include" list of a GitHub Actions matrix.
+// Only go.mod files and Go source files are read;
+// no packages are loaded.
+func (w *Walker) MatrixEach(dir string) ([]MatrixEntry, error) {
+	var result []MatrixEntry
+	err := w.EachGomod(dir, func(subdir string, mf *modfile.File) error {
+		rel, err := filepath.Rel(dir, subdir)
+		if err != nil {
+			return errors.Wrapf(err, "getting relative path of %s", subdir)
+		}
+		entry := MatrixEntry{ModuleDir: filepath.ToSlash(rel)}
+		if mf.Module != nil {
+			entry.ModulePath = mf.Module.Mod.Path
+		}
+		if mf.Go != nil {
+			entry.GoVersion = mf.Go.Version
+		}
+
+		tags := make(map[string]bool)
+		err = walkModuleFiles(subdir, func(path string, e fs.DirEntry) error {
+			name := e.Name()
+			if !strings.HasSuffix(name, ".go") {
+				return nil
+			}
+			if strings.HasSuffix(name, "_test.go") {
+				entry.HasTests = true
+			}
+			return fileBuildTags(path, tags)
+		})
+		if err != nil {
+			return err
+		}
+		for tag := range tags {
+			entry.Tags = append(entry.Tags, tag)
+		}
+		sort.Strings(entry.Tags)
+
+		result = append(result, entry)
+		return nil
+	})
+	return result, err
+}
+
+// fileBuildTags adds the custom build tags in the //go:build constraint of the Go file at path to tags.
+func fileBuildTags(path string, tags map[string]bool) error {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, path, nil, parser.PackageClauseOnly|parser.ParseComments)
+	if err != nil {
+		return errors.Wrapf(err, "parsing %s", path)
+	}
+	for _, group := range file.Comments {
+		if group.Pos() >= file.Package {
+			break
+		}
+		for _, c := range group.List {
+			if !constraint.IsGoBuild(c.Text) {
+				continue
+			}
+			expr, err := constraint.Parse(c.Text)
+			if err != nil {
+				return errors.Wrapf(err, "parsing build constraint in %s", path)
+			}
+			expr.Eval(func(tag string) bool {
+				if !wellKnownBuildTag(tag) {
+					tags[tag] = true
+				}
+				return false
+			})
+		}
+	}
+	return nil
+}
+
+// wellKnownBuildTag tells whether tag is one the go command sets itself:
+// an operating system, architecture, Go version, compiler, or cgo.
+func wellKnownBuildTag(tag string) bool {
+	if strings.HasPrefix(tag, "go1.") {
+		return true
+	}
+	switch tag {
+	case "cgo", "gc", "gccgo", "unix":
+		return true
+	}
+	return knownOS[tag] || knownArch[tag]
+}
+
+var knownOS = map[string]bool{
+	"aix": true, "android": true, "darwin": true, "dragonfly": true, "freebsd": true,
+	"hurd": true, "illumos": true, "ios": true, "js": true, "linux": true,
+	"nacl": true, "netbsd": true, "openbsd": true, "plan9": true, "solaris": true,
+	"wasip1": true, "windows": true, "zos": true,
+}
+
+var knownArch = map[string]bool{
+	"386": true, "amd64": true, "amd64p32": true, "arm": true, "armbe": true,
+	"arm64": true, "arm64be": true, "loong64": true, "mips": true, "mipsle": true,
+	"mips64": true, "mips64le": true, "mips64p32": true, "mips64p32le": true, "ppc": true,
+	"ppc64": true, "ppc64le": true, "riscv": true, "riscv64": true, "s390": true,
+	"s390x": true, "sparc": true, "sparc64": true, "wasm": true,
+}
@@ -0,0 +1,307 @@
+package modules
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bobg/errors"
+	"golang.org/x/mod/modfile"
+	"golang.org/x/mod/semver"
+)
+
+// MergeModules folds one Go module in a tree into another.
+// This function calls Walker.MergeModules with a default Walker.
+func MergeModules(treeDir, victimDir, targetDir string) error {
+	var w Walker
+	return w.MergeModules(treeDir, victimDir, targetDir)
+}
+
+// MergeModules folds the Go module in victimDir into the one in targetDir,
+// both in the tree rooted at treeDir.
+//
+// If victimDir is inside targetDir,
+// the victim's files stay where they are;
+// otherwise the victim's directory is moved into targetDir,
+// keeping its base name.
+// Either way the victim's go.mod and go.sum files are removed,
+// and its packages become part of the target module,
+// with import paths based on the target's module path and their location in it.
+// If those differ from the victim's import paths,
+// imports throughout the tree are rewritten.
+// It is an error if the victim contains nested modules.
+//
+// The victim's requires are merged into the target's,
+// taking the higher version where both require the same module.
+// The victim's replace directives are copied to the target
+// unless the target already replaces the same module.
+// The victim's go.sum lines are added to the target's go.sum.
+// Other modules in the tree that required the victim
+// are changed to require the target instead,
+// with a local replace directive.
+// If treeDir contains a go.work file,
+// its use directive for the victim is removed.
+// Running "go mod tidy" afterwards is advisable.
+func (w *Walker) MergeModules(treeDir, victimDir, targetDir string) error {
+	w = w.forEdit()
+
+	var (
+		gomods   = make(map[string]*modfile.File) // absolute module dir -> go.mod
+		dirs     = make(map[string]string)        // absolute module dir -> module dir
+		modPaths []string
+	)
+	err := w.EachGomod(treeDir, func(d string, mf *modfile.File) error {
+		abs, err := filepath.Abs(d)
+		if err != nil {
+			return errors.Wrapf(err, "getting absolute path of %s", d)
+		}
+		gomods[abs] = mf
+		dirs[abs] = d
+		if mf.Module != nil {
+			modPaths = append(modPaths, mf.Module.Mod.Path)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	absVictim, err := filepath.Abs(victimDir)
+	if err != nil {
+		return errors.Wrapf(err, "getting absolute path of %s", victimDir)
+	}
+	absTarget, err := filepath.Abs(targetDir)
+	if err != nil {
+		return errors.Wrapf(err, "getting absolute path of %s", targetDir)
+	}
+	victimMF, targetMF := gomods[absVictim], gomods[absTarget]
+	if victimMF == nil || victimMF.Module == nil {
+		return fmt.Errorf("no module in %s", victimDir)
+	}
+	if targetMF == nil || targetMF.Module == nil {
+		return fmt.Errorf("no module in %s", targetDir)
+	}
+	if absVictim == absTarget {
+		return fmt.Errorf("cannot merge %s into itself", victimDir)
+	}
+	for abs := range gomods {
+		if rel, err := filepath.Rel(absVictim, abs); err == nil && rel != "." && filepath.IsLocal(rel) {
+			return fmt.Errorf("%s contains nested module %s", victimDir, dirs[abs])
+		}
+	}
+	victimPath, targetPath := victimMF.Module.Mod.Path, targetMF.Module.Mod.Path
+
+	// Read the go.work file before changing anything,
+	// so a problem with it doesn't leave the tree half-modified.
+	wf, err := w.readGowork(treeDir)
+	if err != nil {
+		return err
+	}
+
+	// Move the victim's files into the target, if necessary,
+	// and remove its go.mod and go.sum.
+	newVictim := absVictim
+	if rel, err := filepath.Rel(absTarget, absVictim); err != nil || !filepath.IsLocal(rel) {
+		newVictim = filepath.Join(absTarget, filepath.Base(absVictim))
+		if _, err := os.Lstat(newVictim); err == nil {
+			return fmt.Errorf("%s already exists", newVictim)
+		}
+	}
+	victimSum, err := os.ReadFile(filepath.Join(absVictim, "go.sum"))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return errors.Wrapf(err, "reading %s", filepath.Join(absVictim, "go.sum"))
+	}
+	if err := os.Remove(filepath.Join(absVictim, "go.mod")); err != nil {
+		return errors.Wrapf(err, "removing %s", filepath.Join(absVictim, "go.mod"))
+	}
+	if err := os.Remove(filepath.Join(absVictim, "go.sum")); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return errors.Wrapf(err, "removing %s", filepath.Join(absVictim, "go.sum"))
+	}
+	if newVictim != absVictim {
+		if err := os.Rename(absVictim, newVictim); err != nil {
+			return errors.Wrapf(err, "moving %s to %s", absVictim, newVictim)
+		}
+	}
+
+	// Rewrite imports of the victim's packages.
+	rel, err := filepath.Rel(absTarget, newVictim)
+	if err != nil {
+		return errors.Wrapf(err, "getting relative path of %s", newVictim)
+	}
+	newPrefix := targetPath + "/" + filepath.ToSlash(rel)
+	if newPrefix != victimPath {
+		rewrite := func(importPath string) (string, bool) {
+			if owningModule(importPath, modPaths) != victimPath || isOtherMajorVersion(importPath, victimPath) {
+				return "", false
+			}
+			return newPrefix + strings.TrimPrefix(importPath, victimPath), true
+		}
+		for abs := range gomods {
+			if abs == absVictim {
+				continue
+			}
+			if _, err := rewriteModuleImports(abs, rewrite); err != nil {
+				return err
+			}
+		}
+	}
+
+	// Merge the victim's requirements into the target.
+	if err := w.mergeRequires(targetMF, absTarget, victimMF, absVictim); err != nil {
+		return errors.Wrapf(err, "merging requirements into %s", targetDir)
+	}
+	if err := dropModule(targetMF, victimPath); err != nil {
+		return errors.Wrapf(err, "updating %s", targetDir)
+	}
+	if err := w.writeGomod(absTarget, targetMF); err != nil {
+		return err
+	}
+	if err := mergeGosum(absTarget, victimSum); err != nil {
+		return err
+	}
+
+	// Point the victim's dependents at the target.
+	for abs, mf := range gomods {
+		if abs == absVictim || abs == absTarget {
+			continue
+		}
+		var requiresVictim bool
+		for _, req := range mf.Require {
+			if req.Mod.Path == victimPath {
+				requiresVictim = true
+				break
+			}
+		}
+		if !requiresVictim {
+			continue
+		}
+		if err := dropModule(mf, victimPath); err != nil {
+			return errors.Wrapf(err, "updating %s", dirs[abs])
+		}
+		if err := addLocalRequire(mf, abs, targetPath, absTarget); err != nil {
+			return errors.Wrapf(err, "updating %s", dirs[abs])
+		}
+		if err := w.writeGomod(abs, mf); err != nil {
+			return err
+		}
+	}
+
+	if wf == nil {
+		return nil
+	}
+	absTree, err := filepath.Abs(treeDir)
+	if err != nil {
+		return errors.Wrapf(err, "getting absolute path of %s", treeDir)
+	}
+	for _, use := range append([]*modfile.Use{}, wf.Use...) {
+		if filepath.Join(absTree, filepath.FromSlash(use.Path)) == absVictim {
+			if err := wf.DropUse(use.Path); err != nil {
+				return errors.Wrap(err, "removing use directive")
+			}
+		}
+	}
+	return writeGowork(treeDir, wf)
+}
+
+// mergeRequires adds the requires and replaces of the go.mod file from
+// (in the directory fromDir)
+// to the go.mod file to
+// (in toDir).
+// Where both require the same module,
+// the higher version wins,
+// and the result is indirect only if both are.
+// Replaces for modules that to already replaces are not copied.
+func (w *Walker) mergeRequires(to *modfile.File, toDir string, from *modfile.File, fromDir string) error {
+	existing := make(map[string]*modfile.Require)
+	for _, req := range to.Require {
+		existing[req.Mod.Path] = req
+	}
+	for _, req := range from.Require {
+		if to.Module != nil && req.Mod.Path == to.Module.Mod.Path {
+			continue
+		}
+		old, ok := existing[req.Mod.Path]
+		if !ok {
+			w.setRequire(to, req.Mod.Path, req.Mod.Version, req.Indirect)
+			continue
+		}
+		version, indirect := semver.Max(old.Mod.Version, req.Mod.Version), old.Indirect && req.Indirect
+		if version == old.Mod.Version && indirect == old.Indirect {
+			continue
+		}
+		w.setRequire(to, req.Mod.Path, version, indirect)
+	}
+
+	replaced := make(map[string]bool)
+	for _, rep := range to.Replace {
+		replaced[rep.Old.Path] = true
+	}
+	for _, rep := range from.Replace {
+		if replaced[rep.Old.Path] || (to.Module != nil && rep.Old.Path == to.Module.Mod.Path) {
+			continue
+		}
+		if err := copyReplaces(from, fromDir, to, toDir, rep.Old.Path); err != nil {
+			return err
+		}
+		replaced[rep.Old.Path] = true
+	}
+	return nil
+}
+
+// dropModule removes the require and replace directives for modPath from mf.
+func dropModule(mf *modfile.File, modPath string) error {
+	if err := mf.DropRequire(modPath); err != nil {
+		return err
+	}
+	for _, rep := range append([]*modfile.Replace{}, mf.Replace...) {
+		if rep.Old.Path == modPath {
+			if err := mf.DropReplace(modPath, rep.Old.Version); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// mergeGosum adds the lines in extra that are not already in the go.sum file in dir to that file,
+// creating it if necessary.
+func mergeGosum(dir string, extra []byte) error {
+	if len(extra) == 0 {
+		return nil
+	}
+	gosumPath := filepath.Join(dir, "go.sum")
+	data, err := os.ReadFile(gosumPath)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return errors.Wrapf(err, "reading %s", gosumPath)
+	}
+
+	have := make(map[string]bool)
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for sc.Scan() {
+		have[sc.Text()] = true
+	}
+
+	var added bool
+	if len(data) > 0 && !bytes.HasSuffix(data, []byte("\n")) {
+		data = append(data, '\n')
+	}
+	sc = bufio.NewScanner(bytes.NewReader(extra))
+	for sc.Scan() {
+		line := sc.Text()
+		if line == "" || have[line] {
+			continue
+		}
+		have[line] = true
+		data = append(data, line...)
+		data = append(data, '\n')
+		added = true
+	}
+	if !added {
+		return nil
+	}
+	return errors.Wrapf(os.WriteFile(gosumPath, data, 0644), "writing %s", gosumPath)
+}
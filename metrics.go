@@ -0,0 +1,205 @@
+package modules
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+
+	"github.com/bobg/errors"
+	"golang.org/x/tools/go/packages"
+)
+
+// ModuleMetrics are size and complexity metrics for a Go module.
+// See [Walker.MetricsEach].
+type ModuleMetrics struct {
+	Stats
+
+	// Path is the module path.
+	Path string
+
+	// Exported is the number of exported identifiers declared at the top level of the module's non-main packages,
+	// including exported methods of exported types.
+	Exported int
+
+	// DirectDeps is the number of other modules
+	// providing packages that the module's packages import directly.
+	DirectDeps int
+
+	// TransitiveDeps is the number of other modules
+	// providing packages that the module's packages import directly or indirectly.
+	// It is the same as Stats.Deps.
+	TransitiveDeps int
+
+	// TestRatio is TestLines divided by Lines,
+	// or 0 if Lines is 0.
+	TestRatio float64
+}
+
+// MetricsSummary aggregates the [ModuleMetrics] of the modules in a tree.
+// See [Walker.MetricsEach].
+type MetricsSummary struct {
+	// Modules is the number of modules measured.
+	Modules int
+
+	// Packages, Lines, TestLines, and Exported are totals over all modules.
+	Packages, Lines, TestLines, Exported int
+
+	// Deps is the number of distinct modules outside the tree
+	// that any module in the tree depends on, directly or indirectly.
+	Deps int
+
+	// TestRatio is TestLines divided by Lines,
+	// or 0 if Lines is 0.
+	TestRatio float64
+}
+
+// MetricsEach computes size and complexity metrics for each Go module in dir and its subdirectories.
+// This function calls Walker.MetricsEach with a default Walker.
+func MetricsEach(dir string, f func(string, ModuleMetrics) error) (*MetricsSummary, error) {
+	var w Walker
+	return w.MetricsEach(dir, f)
+}
+
+// MetricsEach computes size and complexity metrics for each Go module in dir and its subdirectories,
+// calling f with the module's directory
+// (which will have dir as a prefix)
+// and its metrics.
+// Packages are loaded as with [Walker.LoadEach],
+// and the counts in the embedded [Stats] are as for [Walker.ModuleStats].
+//
+// The result summarizes the metrics across all modules.
+func (w *Walker) MetricsEach(dir string, f func(string, ModuleMetrics) error) (*MetricsSummary, error) {
+	var (
+		summary   = new(MetricsSummary)
+		treePaths = make(map[string]bool)
+		allDeps   = make(map[string]bool)
+	)
+
+	err := w.loadEach(dir, statsLoadMode, func(subdir string, pkgs []*packages.Package) error {
+		stats, err := moduleStats(subdir, pkgs)
+		if err != nil {
+			return err
+		}
+		m := ModuleMetrics{Stats: stats, TransitiveDeps: stats.Deps}
+		if stats.Lines > 0 {
+			m.TestRatio = float64(stats.TestLines) / float64(stats.Lines)
+		}
+
+		direct := make(map[string]bool)
+		fset := token.NewFileSet()
+		for _, pkg := range pkgs {
+			if isTestVariant(pkg) {
+				continue
+			}
+			if pkg.Module != nil {
+				m.Path = pkg.Module.Path
+			}
+			for _, imp := range pkg.Imports {
+				if imp.Module != nil && (pkg.Module == nil || imp.Module.Path != pkg.Module.Path) {
+					direct[imp.Module.Path] = true
+				}
+			}
+			if pkg.Name == "main" {
+				continue
+			}
+			for _, filename := range pkg.GoFiles {
+				n, err := countExported(fset, filename)
+				if err != nil {
+					return err
+				}
+				m.Exported += n
+			}
+		}
+		m.DirectDeps = len(direct)
+
+		treePaths[m.Path] = true
+		packages.Visit(pkgs, nil, func(pkg *packages.Package) {
+			if pkg.Module != nil && pkg.Module.Path != m.Path {
+				allDeps[pkg.Module.Path] = true
+			}
+		})
+
+		summary.Modules++
+		summary.Packages += m.Packages
+		summary.Lines += m.Lines
+		summary.TestLines += m.TestLines
+		summary.Exported += m.Exported
+
+		return f(subdir, m)
+	})
+
+	for path := range allDeps {
+		if !treePaths[path] {
+			summary.Deps++
+		}
+	}
+	if summary.Lines > 0 {
+		summary.TestRatio = float64(summary.TestLines) / float64(summary.Lines)
+	}
+
+	return summary, err
+}
+
+// countExported counts the exported top-level identifiers declared in the Go file filename,
+// including exported methods of exported types.
+func countExported(fset *token.FileSet, filename string) (int, error) {
+	file, err := parser.ParseFile(fset, filename, nil, parser.SkipObjectResolution)
+	if err != nil {
+		return 0, errors.Wrapf(err, "parsing %s", filename)
+	}
+
+	var n int
+	for _, decl := range file.Decls {
+		switch decl := decl.(type) {
+		case *ast.FuncDecl:
+			if !decl.Name.IsExported() {
+				continue
+			}
+			if decl.Recv != nil && !exportedReceiver(decl.Recv) {
+				continue
+			}
+			n++
+
+		case *ast.GenDecl:
+			for _, spec := range decl.Specs {
+				switch spec := spec.(type) {
+				case *ast.TypeSpec:
+					if spec.Name.IsExported() {
+						n++
+					}
+				case *ast.ValueSpec:
+					for _, name := range spec.Names {
+						if name.IsExported() {
+							n++
+						}
+					}
+				}
+			}
+		}
+	}
+	return n, nil
+}
+
+// exportedReceiver tells whether the receiver of a method declaration has an exported base type.
+func exportedReceiver(recv *ast.FieldList) bool {
+	if len(recv.List) == 0 {
+		return false
+	}
+	typ := recv.List[0].Type
+	for {
+		switch t := typ.(type) {
+		case *ast.StarExpr:
+			typ = t.X
+		case *ast.ParenExpr:
+			typ = t.X
+		case *ast.IndexExpr:
+			typ = t.X
+		case *ast.IndexListExpr:
+			typ = t.X
+		case *ast.Ident:
+			return t.IsExported()
+		default:
+			return false
+		}
+	}
+}
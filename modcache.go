@@ -0,0 +1,214 @@
+package modules
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/bobg/errors"
+	"golang.org/x/mod/modfile"
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/semver"
+)
+
+// ModCacheEntry is a module version in the module cache
+// (or missing from it)
+// that the modules in a tree require.
+// See [Walker.ModCacheUsage].
+type ModCacheEntry struct {
+	// Path and Version identify the module version.
+	// If a require is replaced by another module version,
+	// this is the replacement.
+	Path, Version string
+
+	// Dir is the directory where the go command extracts the module's source,
+	// whether or not it exists.
+	Dir string
+
+	// Extracted tells whether Dir exists.
+	Extracted bool
+
+	// Downloaded tells whether the module's zip file is in the download cache.
+	Downloaded bool
+
+	// Size is the number of bytes taken by the module's files in the cache:
+	// the extracted source in Dir plus the files in the download cache.
+	Size int64
+
+	// RequiredBy are the directories of the modules in the tree requiring this module version,
+	// in the order [Walker.Each] visits them.
+	RequiredBy []string
+}
+
+// Missing tells whether the module version has not been downloaded at all.
+func (e ModCacheEntry) Missing() bool {
+	return !e.Extracted && !e.Downloaded
+}
+
+// ModCacheReport describes how the modules in a tree use the module cache.
+// See [Walker.ModCacheUsage].
+type ModCacheReport struct {
+	// GOMODCACHE is the root of the module cache.
+	GOMODCACHE string
+
+	// Entries are the module versions required in the tree,
+	// sorted by path and then by version.
+	Entries []ModCacheEntry
+}
+
+// Missing returns the entries that have not been downloaded.
+func (r *ModCacheReport) Missing() []ModCacheEntry {
+	var result []ModCacheEntry
+	for _, e := range r.Entries {
+		if e.Missing() {
+			result = append(result, e)
+		}
+	}
+	return result
+}
+
+// Size returns the total size of the entries in the cache.
+func (r *ModCacheReport) Size() int64 {
+	var result int64
+	for _, e := range r.Entries {
+		result += e.Size
+	}
+	return result
+}
+
+// ModCacheUsage maps the requires of the Go modules in dir and its subdirectories to the module cache.
+// This function calls Walker.ModCacheUsage with a default Walker.
+func ModCacheUsage(dir string) (*ModCacheReport, error) {
+	var w Walker
+	return w.ModCacheUsage(dir)
+}
+
+// ModCacheUsage maps the requires of the Go modules in dir and its subdirectories to the module cache,
+// reporting where each required module version is
+// (or would be)
+// in the cache,
+// how much space it takes,
+// and whether it is missing.
+//
+// Every require directive is considered,
+// including indirect ones,
+// but not the rest of each module's build list.
+// Requires replaced by local directories are skipped,
+// and those replaced by other module versions are reported as the replacements.
+//
+// The location of the module cache is given by "go env GOMODCACHE",
+// run with the settings in w.Env, w.GOFLAGS, and w.GOWORK,
+// and the environment in w.LoadConfig.
+func (w *Walker) ModCacheUsage(dir string) (*ModCacheReport, error) {
+	env, err := w.goEnv(dir, "GOMODCACHE")
+	if err != nil {
+		return nil, err
+	}
+	report := &ModCacheReport{GOMODCACHE: env["GOMODCACHE"]}
+	if report.GOMODCACHE == "" {
+		return nil, errors.New("GOMODCACHE not set")
+	}
+
+	byVersion := make(map[module.Version]*ModCacheEntry)
+	var order []module.Version
+	err = w.EachGomod(dir, func(subdir string, mf *modfile.File) error {
+		for _, req := range mf.Require {
+			mod := req.Mod
+			if rep := findReplace(mf, mod.Path, mod.Version); rep != nil {
+				if modfile.IsDirectoryPath(rep.New.Path) {
+					continue
+				}
+				mod = rep.New
+			}
+			e, ok := byVersion[mod]
+			if !ok {
+				e = &ModCacheEntry{Path: mod.Path, Version: mod.Version}
+				byVersion[mod] = e
+				order = append(order, mod)
+			}
+			if len(e.RequiredBy) == 0 || e.RequiredBy[len(e.RequiredBy)-1] != subdir {
+				e.RequiredBy = append(e.RequiredBy, subdir)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(order, func(i, j int) bool {
+		if order[i].Path != order[j].Path {
+			return order[i].Path < order[j].Path
+		}
+		return semver.Compare(order[i].Version, order[j].Version) < 0
+	})
+	for _, mod := range order {
+		e := byVersion[mod]
+		if err := inspectModCache(report.GOMODCACHE, e); err != nil {
+			return nil, err
+		}
+		report.Entries = append(report.Entries, *e)
+	}
+
+	return report, nil
+}
+
+// inspectModCache fills in the fields of e describing its presence in the module cache rooted at cache.
+func inspectModCache(cache string, e *ModCacheEntry) error {
+	escPath, err := module.EscapePath(e.Path)
+	if err != nil {
+		return errors.Wrapf(err, "escaping module path %s", e.Path)
+	}
+	escVersion, err := module.EscapeVersion(e.Version)
+	if err != nil {
+		return errors.Wrapf(err, "escaping version %s", e.Version)
+	}
+
+	e.Dir = filepath.Join(cache, filepath.FromSlash(escPath)+"@"+escVersion)
+	if info, err := os.Stat(e.Dir); err == nil && info.IsDir() {
+		e.Extracted = true
+		size, err := dirSize(e.Dir)
+		if err != nil {
+			return err
+		}
+		e.Size += size
+	}
+
+	base := filepath.Join(cache, "cache", "download", filepath.FromSlash(escPath), "@v", escVersion)
+	for _, ext := range []string{".info", ".mod", ".zip", ".ziphash"} {
+		info, err := os.Stat(base + ext)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return errors.Wrapf(err, "statting %s", base+ext)
+		}
+		e.Size += info.Size()
+		if ext == ".zip" {
+			e.Downloaded = true
+		}
+	}
+
+	return nil
+}
+
+// dirSize returns the total size of the regular files in dir and its subdirectories.
+func dirSize(dir string) (int64, error) {
+	var result int64
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		result += info.Size()
+		return nil
+	})
+	return result, errors.Wrapf(err, "measuring %s", dir)
+}
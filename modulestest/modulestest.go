@@ -0,0 +1,229 @@
+// Package modulestest builds synthetic trees of Go modules
+// for testing code that uses package modules.
+//
+// A [Tree] is built in memory,
+// then written to a temporary directory with [Tree.TempDir]
+// or converted to an [fstest.MapFS] with [Tree.MapFS].
+//
+//	dir := modulestest.New().
+//		Module("a", "example.com/a").
+//		Require("example.com/b", "v1.0.0").
+//		Replace("example.com/b", "../b", "").
+//		Package(".", "a", "example.com/b").
+//		Tree().
+//		Module("b", "example.com/b").
+//		Package(".", "b").
+//		Tree().
+//		TempDir(t)
+//
+// Builder methods panic on invalid arguments,
+// such as malformed module paths or versions,
+// since those are mistakes in the test itself.
+package modulestest
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/bobg/errors"
+	"golang.org/x/mod/modfile"
+)
+
+// DefaultGoVersion is the version in the go directive of each module's go.mod file,
+// unless changed with [Module.Go].
+const DefaultGoVersion = "1.21"
+
+// Tree is a synthetic tree of Go modules and other files.
+// The zero value is not usable;
+// create one with [New].
+type Tree struct {
+	files   map[string][]byte
+	modules []*Module
+}
+
+// New returns a new, empty [Tree].
+func New() *Tree {
+	return &Tree{files: make(map[string][]byte)}
+}
+
+// File adds a file to the tree.
+// The name is slash-separated
+// and relative to the tree's root.
+// It replaces any file previously added with the same name.
+func (t *Tree) File(name, content string) *Tree {
+	t.files[cleanName(name)] = []byte(content)
+	return t
+}
+
+// Module adds a Go module to the tree,
+// in the slash-separated directory dir relative to the tree's root
+// (which may be "."),
+// with the given module path,
+// and returns it for adding directives and packages.
+// Its go.mod file is generated when the tree is written.
+func (t *Tree) Module(dir, modpath string) *Module {
+	mf := new(modfile.File)
+	must(mf.AddModuleStmt(modpath))
+	must(mf.AddGoStmt(DefaultGoVersion))
+
+	m := &Module{tree: t, dir: cleanName(dir), path: modpath, mf: mf}
+	t.modules = append(t.modules, m)
+	return m
+}
+
+// Files returns the contents of the tree,
+// including the generated go.mod files,
+// as a map from slash-separated file names to contents.
+func (t *Tree) Files() map[string][]byte {
+	result := make(map[string][]byte, len(t.files)+len(t.modules))
+	for name, data := range t.files {
+		result[name] = data
+	}
+	for _, m := range t.modules {
+		m.mf.Cleanup()
+		data, err := m.mf.Format()
+		must(err)
+		result[path.Join(m.dir, "go.mod")] = data
+	}
+	return result
+}
+
+// MapFS returns the contents of the tree as an [fstest.MapFS].
+func (t *Tree) MapFS() fstest.MapFS {
+	result := make(fstest.MapFS)
+	for name, data := range t.Files() {
+		result[name] = &fstest.MapFile{Data: data, Mode: 0644}
+	}
+	return result
+}
+
+// Write writes the tree's files into dir,
+// creating directories as needed.
+func (t *Tree) Write(dir string) error {
+	files := t.Files()
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		filename := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+			return errors.Wrapf(err, "creating directory for %s", filename)
+		}
+		if err := os.WriteFile(filename, files[name], 0644); err != nil {
+			return errors.Wrapf(err, "writing %s", filename)
+		}
+	}
+	return nil
+}
+
+// TempDir writes the tree into a new temporary directory,
+// which is removed when the test finishes,
+// and returns the directory's name.
+// It fails the test if the tree cannot be written.
+func (t *Tree) TempDir(tb testing.TB) string {
+	tb.Helper()
+
+	dir := tb.TempDir()
+	if err := t.Write(dir); err != nil {
+		tb.Fatal(err)
+	}
+	return dir
+}
+
+// Module is a Go module in a [Tree].
+type Module struct {
+	tree *Tree
+	dir  string
+	path string
+	mf   *modfile.File
+}
+
+// Tree returns the tree containing m,
+// for continuing to build it.
+func (m *Module) Tree() *Tree {
+	return m.tree
+}
+
+// Dir returns the slash-separated directory of m,
+// relative to the tree's root.
+func (m *Module) Dir() string {
+	return m.dir
+}
+
+// Path returns m's module path.
+func (m *Module) Path() string {
+	return m.path
+}
+
+// Go sets the version in m's go directive.
+func (m *Module) Go(version string) *Module {
+	must(m.mf.AddGoStmt(version))
+	return m
+}
+
+// Require adds a require directive to m's go.mod file.
+func (m *Module) Require(modpath, version string) *Module {
+	must(m.mf.AddRequire(modpath, version))
+	return m
+}
+
+// Replace adds a replace directive to m's go.mod file,
+// replacing all versions of modpath with newPath at newVersion.
+// For a replacement with a local directory,
+// such as "../b",
+// newVersion must be empty.
+func (m *Module) Replace(modpath, newPath, newVersion string) *Module {
+	must(m.mf.AddReplace(modpath, "", newPath, newVersion))
+	return m
+}
+
+// Package adds a minimal Go package to m,
+// in the slash-separated directory dir relative to m's directory
+// (which may be "."),
+// with the given package name,
+// importing each of imports for its side effects.
+// The package's single file is named after the package.
+func (m *Module) Package(dir, name string, imports ...string) *Module {
+	var buf strings.Builder
+	fmt.Fprintf(&buf, "package %s\n", name)
+	if len(imports) > 0 {
+		buf.WriteString("\nimport (\n")
+		for _, imp := range imports {
+			fmt.Fprintf(&buf, "\t_ %q\n", imp)
+		}
+		buf.WriteString(")\n")
+	}
+	return m.File(path.Join(dir, name+".go"), buf.String())
+}
+
+// File adds a file to m.
+// The name is slash-separated
+// and relative to m's directory.
+func (m *Module) File(name, content string) *Module {
+	m.tree.File(path.Join(m.dir, name), content)
+	return m
+}
+
+func cleanName(name string) string {
+	name = path.Clean(name)
+	if !fs.ValidPath(name) {
+		panic(fmt.Sprintf("invalid file name %q", name))
+	}
+	return name
+}
+
+func must(err error) {
+	if err != nil {
+		panic(err)
+	}
+}
@@ -0,0 +1,340 @@
+package modules
+
+import (
+	"fmt"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/bobg/errors"
+	"golang.org/x/mod/modfile"
+)
+
+// MovePackage moves a package from one Go module in a tree to another,
+// updating the rest of the tree to match.
+// It returns the new import path of the package.
+// This function calls Walker.MovePackage with a default Walker.
+func MovePackage(treeDir, srcPkg, dstModuleDir string) (string, error) {
+	var w Walker
+	return w.MovePackage(treeDir, srcPkg, dstModuleDir)
+}
+
+// MovePackage moves the package with import path srcPkg
+// from the Go module containing it
+// to the module in dstModuleDir,
+// both in the tree rooted at treeDir.
+// The package keeps its location relative to its module root,
+// so moving example.com/a/util/strs into module example.com/b
+// produces example.com/b/util/strs.
+// It is an error if the destination directory already contains Go files,
+// or any other file the move would replace,
+// or if srcPkg is the root package of its module.
+//
+// The package's files are moved,
+// along with any subdirectories that the go command ignores
+// (such as testdata);
+// other subdirectories are separate packages and stay where they are.
+// Imports of srcPkg throughout the tree are rewritten to the new path.
+//
+// Go.mod files are updated so the tree still builds:
+// every module that imports the moved package gets a require and local replace directive for the destination module,
+// the destination module gets the same for any module in the tree that the package imports,
+// and it copies from the source module the requires of any other modules that the package imports.
+// Running "go mod tidy" afterwards is advisable.
+func (w *Walker) MovePackage(treeDir, srcPkg, dstModuleDir string) (string, error) {
+	w = w.forEdit()
+
+	var (
+		gomods   = make(map[string]*modfile.File) // module dir -> go.mod
+		byPath   = make(map[string]string)        // module path -> module dir
+		dirs     []string
+		modPaths []string
+	)
+	err := w.EachGomod(treeDir, func(subdir string, mf *modfile.File) error {
+		dirs = append(dirs, subdir)
+		gomods[subdir] = mf
+		if mf.Module != nil {
+			byPath[mf.Module.Mod.Path] = subdir
+			modPaths = append(modPaths, mf.Module.Mod.Path)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	srcModPath := owningModule(srcPkg, modPaths)
+	if srcModPath == "" {
+		return "", fmt.Errorf("package %s is not in any module in %s", srcPkg, treeDir)
+	}
+	srcModDir := byPath[srcModPath]
+	rel := strings.TrimPrefix(strings.TrimPrefix(srcPkg, srcModPath), "/")
+	if rel == "" {
+		return "", fmt.Errorf("package %s is the root package of module %s; move the module instead", srcPkg, srcModPath)
+	}
+	srcDir := filepath.Join(srcModDir, filepath.FromSlash(rel))
+
+	// Find dstModuleDir among the module dirs as Walker.Each reports them.
+	absDst, err := filepath.Abs(dstModuleDir)
+	if err != nil {
+		return "", errors.Wrapf(err, "getting absolute path of %s", dstModuleDir)
+	}
+	dstModuleDir = ""
+	for _, subdir := range dirs {
+		if abs, err := filepath.Abs(subdir); err == nil && abs == absDst {
+			dstModuleDir = subdir
+			break
+		}
+	}
+	dstMF := gomods[dstModuleDir]
+	if dstMF == nil || dstMF.Module == nil {
+		return "", fmt.Errorf("no module in %s", absDst)
+	}
+	dstModPath := dstMF.Module.Mod.Path
+	if dstModPath == srcModPath {
+		return "", fmt.Errorf("package %s is already in module %s", srcPkg, dstModPath)
+	}
+	dstPkg := dstModPath
+	if rel != "" {
+		dstPkg += "/" + rel
+	}
+	dstDir := filepath.Join(dstModuleDir, filepath.FromSlash(rel))
+
+	if ok, err := dirHasGoFiles(srcDir); err != nil {
+		return "", err
+	} else if !ok {
+		return "", fmt.Errorf("no Go files in %s", srcDir)
+	}
+	if ok, err := dirHasGoFiles(dstDir); err != nil {
+		return "", err
+	} else if ok {
+		return "", fmt.Errorf("%s already contains Go files", dstDir)
+	}
+
+	if err := movePackageFiles(srcDir, dstDir); err != nil {
+		return "", err
+	}
+
+	// Rewrite imports of the package,
+	// noting which modules import it.
+	importers := make(map[string]bool)
+	rewrite := func(importPath string) (string, bool) {
+		return dstPkg, importPath == srcPkg
+	}
+	for _, subdir := range dirs {
+		changed, err := rewriteModuleImports(subdir, rewrite)
+		if err != nil {
+			return dstPkg, err
+		}
+		if len(changed) > 0 {
+			importers[subdir] = true
+		}
+	}
+
+	for subdir := range importers {
+		if subdir == dstModuleDir {
+			continue
+		}
+		mf := gomods[subdir]
+		if err := addLocalRequire(mf, subdir, dstModPath, dstModuleDir); err != nil {
+			return dstPkg, errors.Wrapf(err, "updating %s", subdir)
+		}
+		if err := w.writeGomod(subdir, mf); err != nil {
+			return dstPkg, err
+		}
+	}
+
+	// Give the destination module what it needs for the package's own imports.
+	imports, err := dirImports(dstDir)
+	if err != nil {
+		return dstPkg, err
+	}
+	srcMF := gomods[srcModDir]
+	for _, imp := range imports {
+		if owner := owningModule(imp, modPaths); owner != "" {
+			if owner == dstModPath {
+				continue
+			}
+			if err := addLocalRequire(dstMF, dstModuleDir, owner, byPath[owner]); err != nil {
+				return dstPkg, errors.Wrapf(err, "updating %s", dstModuleDir)
+			}
+			continue
+		}
+		req := requireFor(srcMF, imp)
+		if req == nil || requireFor(dstMF, imp) != nil {
+			continue
+		}
+		w.setRequire(dstMF, req.Mod.Path, req.Mod.Version, false)
+	}
+	if err := w.writeGomod(dstModuleDir, dstMF); err != nil {
+		return dstPkg, err
+	}
+
+	return dstPkg, nil
+}
+
+// addLocalRequire makes the module whose go.mod file (in dir) is mf
+// depend on the module with path modPath in the directory target,
+// adding a require directive if needed
+// and a replace directive pointing to target if there is none.
+func addLocalRequire(mf *modfile.File, dir, modPath, target string) error {
+	var required bool
+	for _, req := range mf.Require {
+		if req.Mod.Path == modPath {
+			required = true
+			break
+		}
+	}
+	if !required {
+		if err := mf.AddRequire(modPath, localRequireVersion); err != nil {
+			return err
+		}
+	}
+	for _, rep := range mf.Replace {
+		if rep.Old.Path == modPath {
+			return nil
+		}
+	}
+	return mf.AddReplace(modPath, "", relativeModPath(dir, target), "")
+}
+
+// requireFor returns the require directive in mf for the module providing the package pkgPath,
+// or nil if there is none.
+func requireFor(mf *modfile.File, pkgPath string) *modfile.Require {
+	var result *modfile.Require
+	for _, req := range mf.Require {
+		p := req.Mod.Path
+		if (pkgPath == p || strings.HasPrefix(pkgPath, p+"/")) && (result == nil || len(p) > len(result.Mod.Path)) {
+			result = req
+		}
+	}
+	return result
+}
+
+// dirHasGoFiles tells whether dir directly contains any Go files.
+// A nonexistent dir has none.
+func dirHasGoFiles(dir string) (bool, error) {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, errors.Wrapf(err, "reading %s", dir)
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".go") {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// movePackageFiles moves the files of the package in srcDir to dstDir,
+// which is created if necessary,
+// along with any subdirectories that the go command ignores.
+// If that leaves srcDir empty,
+// it is removed.
+// Nothing is moved if any of the files already exists in dstDir.
+func movePackageFiles(srcDir, dstDir string) error {
+	entries, err := os.ReadDir(srcDir)
+	if err != nil {
+		return errors.Wrapf(err, "reading %s", srcDir)
+	}
+
+	var names []string
+	for _, entry := range entries {
+		if entry.IsDir() && !ignoredDir(entry.Name()) {
+			continue
+		}
+		dst := filepath.Join(dstDir, entry.Name())
+		if _, err := os.Lstat(dst); err == nil {
+			return fmt.Errorf("%s already exists", dst)
+		}
+		names = append(names, entry.Name())
+	}
+
+	if err := os.MkdirAll(dstDir, 0755); err != nil {
+		return errors.Wrapf(err, "creating %s", dstDir)
+	}
+
+	for _, name := range names {
+		src, dst := filepath.Join(srcDir, name), filepath.Join(dstDir, name)
+		if err := os.Rename(src, dst); err != nil {
+			return errors.Wrapf(err, "moving %s to %s", src, dst)
+		}
+	}
+	remaining := len(entries) - len(names)
+
+	if remaining == 0 {
+		return errors.Wrapf(os.Remove(srcDir), "removing %s", srcDir)
+	}
+	return nil
+}
+
+// dirImports returns the import paths used by the Go files directly in dir,
+// without duplicates.
+func dirImports(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, errors.Wrapf(err, "reading %s", dir)
+	}
+
+	c := newImportCollector()
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".go") {
+			continue
+		}
+		if err := c.add(filepath.Join(dir, entry.Name())); err != nil {
+			return nil, err
+		}
+	}
+	return c.result, nil
+}
+
+// moduleImports returns the import paths used by the Go files in the module in dir,
+// without duplicates,
+// skipping nested modules and directories ignored by the go command.
+func moduleImports(dir string) ([]string, error) {
+	c := newImportCollector()
+	err := walkModuleFiles(dir, func(path string, entry fs.DirEntry) error {
+		if !strings.HasSuffix(entry.Name(), ".go") {
+			return nil
+		}
+		return c.add(path)
+	})
+	return c.result, err
+}
+
+// importCollector accumulates the distinct import paths used by a set of Go files.
+type importCollector struct {
+	fset   *token.FileSet
+	seen   map[string]bool
+	result []string
+}
+
+func newImportCollector() *importCollector {
+	return &importCollector{fset: token.NewFileSet(), seen: make(map[string]bool)}
+}
+
+// add adds the imports of the Go file at path.
+func (c *importCollector) add(path string) error {
+	file, err := parser.ParseFile(c.fset, path, nil, parser.ImportsOnly)
+	if err != nil {
+		return errors.Wrapf(err, "parsing %s", path)
+	}
+	for _, imp := range file.Imports {
+		importPath, err := strconv.Unquote(imp.Path.Value)
+		if err != nil {
+			return errors.Wrapf(err, "unquoting import path %s in %s", imp.Path.Value, path)
+		}
+		if !c.seen[importPath] {
+			c.seen[importPath] = true
+			c.result = append(c.result, importPath)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package modules
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/bobg/errors"
+	"golang.org/x/mod/modfile"
+)
+
+// Nearest finds the Go module enclosing path.
+// This function calls Walker.Nearest with a default Walker.
+func Nearest(path string) (dir string, mf *modfile.File, err error) {
+	var w Walker
+	return w.Nearest(path)
+}
+
+// Nearest finds the Go module enclosing path,
+// which may be a file or a directory,
+// by looking for a go.mod file in path
+// (or the directory containing it, if it is a file)
+// and then in each parent directory in turn,
+// as the go command does.
+// It returns the absolute path of the module's directory
+// and its parsed go.mod file.
+//
+// If there is no enclosing module,
+// the result is an error wrapping [ErrNoModules].
+func (w *Walker) Nearest(path string) (dir string, mf *modfile.File, err error) {
+	dir, err = nearestModuleRoot(path)
+	if err != nil {
+		return "", nil, err
+	}
+	_, mf, err = w.readGomod(dir)
+	return dir, mf, err
+}
+
+// nearestModuleRoot finds the absolute path of the directory of the Go module enclosing path.
+func nearestModuleRoot(path string) (string, error) {
+	dir, err := filepath.Abs(path)
+	if err != nil {
+		return "", errors.Wrapf(err, "getting absolute path of %s", path)
+	}
+	info, err := os.Stat(dir)
+	if err != nil {
+		return "", errors.Wrapf(err, "statting %s", path)
+	}
+	if !info.IsDir() {
+		dir = filepath.Dir(dir)
+	}
+
+	for {
+		found, err := hasFile(dir, "go.mod")
+		if err != nil {
+			return "", err
+		}
+		if found {
+			return dir, nil
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", WalkError{Dir: path, Op: "finding enclosing module of", Err: ErrNoModules}
+		}
+		dir = parent
+	}
+}
+
+// IsModuleRoot tells whether dir is the root directory of a Go module,
+// by the same rule [Walker.Each] uses:
+// whether it contains a go.mod file.
+func IsModuleRoot(dir string) (bool, error) {
+	return hasFile(dir, "go.mod")
+}
+
+// IsInsideModule tells whether path,
+// a file or directory,
+// is inside a Go module,
+// as found by [Walker.Nearest].
+func IsInsideModule(path string) (bool, error) {
+	_, err := nearestModuleRoot(path)
+	if errors.Is(err, ErrNoModules) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// hasFile tells whether dir contains a file
+// (or something other than a directory)
+// with the given name.
+func hasFile(dir, name string) (bool, error) {
+	path := filepath.Join(dir, name)
+	info, err := os.Stat(osPath(path))
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return false, nil
+	case err != nil:
+		return false, WalkError{Dir: dir, Op: "checking for " + name + " in", Err: err}
+	}
+	return !info.IsDir(), nil
+}
@@ -0,0 +1,32 @@
+package modules
+
+import "time"
+
+// Metrics receives timings of the work a [Walker] does,
+// so they can be recorded with a metrics library such as Prometheus or expvar.
+// See [Walker.Metrics].
+//
+// Each method is passed the directory the work was for,
+// suitable for use as a label,
+// how long the work took,
+// and the error it produced, if any.
+// Implementations must be safe for concurrent use.
+type Metrics interface {
+	// ObserveWalk is called at the end of each walk of a tree,
+	// with the tree's root directory.
+	// The duration includes the time spent in callbacks
+	// (such as loading packages, in [Walker.LoadEach]).
+	ObserveWalk(dir string, d time.Duration, err error)
+
+	// ObserveParse is called after each go.mod file is parsed,
+	// with the directory of its module.
+	// Files found in a [GomodCache] are not parsed,
+	// and not observed.
+	ObserveParse(dir string, d time.Duration, err error)
+
+	// ObserveLoad is called after each call to [packages.Load],
+	// with the directory of the module whose packages were loaded.
+	// Packages found in a [LoadCache] are not loaded,
+	// and not observed.
+	ObserveLoad(dir string, d time.Duration, err error)
+}
@@ -0,0 +1,352 @@
+package modules
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"golang.org/x/mod/modfile"
+	"golang.org/x/tools/go/packages"
+)
+
+// Option is an option for [NewWalker].
+type Option func(*Walker) error
+
+// NewWalker returns a new [Walker] configured by the given options,
+// which are applied in order.
+// It is an error if any option is invalid,
+// or if the resulting Walker fails [Walker.Validate].
+//
+// A Walker can also be created as a struct literal,
+// but NewWalker checks its settings up front
+// rather than when the Walker is used.
+func NewWalker(opts ...Option) (*Walker, error) {
+	w := new(Walker)
+	for _, opt := range opts {
+		if err := opt(w); err != nil {
+			return nil, err
+		}
+	}
+	if err := w.Validate(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// WithIncludeVendor is an [Option] that makes the Walker walk into vendor directories.
+// See [Walker.IncludeVendor].
+func WithIncludeVendor() Option {
+	return func(w *Walker) error {
+		w.IncludeVendor = true
+		return nil
+	}
+}
+
+// WithIncludeTestdata is an [Option] that makes the Walker walk into testdata directories.
+// See [Walker.IncludeTestdata].
+func WithIncludeTestdata() Option {
+	return func(w *Walker) error {
+		w.IncludeTestdata = true
+		return nil
+	}
+}
+
+// WithLinks is an [Option] setting how the Walker treats links to directories.
+// See [Walker.Links].
+func WithLinks(policy LinkPolicy) Option {
+	return func(w *Walker) error {
+		switch policy {
+		case LinkSkip, LinkFollow:
+		default:
+			return fmt.Errorf("unknown link policy %d", policy)
+		}
+		w.Links = policy
+		return nil
+	}
+}
+
+// WithNoIgnoreFiles is an [Option] that makes the Walker disregard [IgnoreFileName] files.
+// See [Walker.NoIgnoreFiles].
+func WithNoIgnoreFiles() Option {
+	return func(w *Walker) error {
+		w.NoIgnoreFiles = true
+		return nil
+	}
+}
+
+// WithRequireModules is an [Option] that makes walking a tree with no Go modules an error.
+// See [Walker.RequireModules] and [ErrNoModules].
+func WithRequireModules() Option {
+	return func(w *Walker) error {
+		w.RequireModules = true
+		return nil
+	}
+}
+
+// WithLimit is an [Option] setting the maximum number of modules to visit.
+// It is an error if n is less than 1.
+// See [Walker.Limit].
+func WithLimit(n int) Option {
+	return func(w *Walker) error {
+		if n < 1 {
+			return fmt.Errorf("limit %d is less than 1", n)
+		}
+		w.Limit = n
+		return nil
+	}
+}
+
+// WithParseLax is an [Option] that makes the Walker parse go.mod files with [modfile.ParseLax].
+// See [Walker.ParseLax].
+func WithParseLax() Option {
+	return func(w *Walker) error {
+		w.ParseLax = true
+		return nil
+	}
+}
+
+// WithVersionFixer is an [Option] setting the function used to fix version strings when parsing go.mod files.
+// See [Walker.VersionFixer].
+func WithVersionFixer(fix modfile.VersionFixer) Option {
+	return func(w *Walker) error {
+		w.VersionFixer = fix
+		return nil
+	}
+}
+
+// WithConcurrency is an [Option] setting the number of modules to work on at once.
+// It is an error if n is less than 1.
+// See [Walker.Concurrency].
+func WithConcurrency(n int) Option {
+	return func(w *Walker) error {
+		if n < 1 {
+			return fmt.Errorf("concurrency %d is less than 1", n)
+		}
+		w.Concurrency = n
+		return nil
+	}
+}
+
+// WithScanConcurrency is an [Option] setting the number of directories to scan at once when walking a tree.
+// It is an error if n is less than 1.
+// See [Walker.ScanConcurrency].
+func WithScanConcurrency(n int) Option {
+	return func(w *Walker) error {
+		if n < 1 {
+			return fmt.Errorf("scan concurrency %d is less than 1", n)
+		}
+		w.ScanConcurrency = n
+		return nil
+	}
+}
+
+// WithTracer is an [Option] setting the [Tracer] that receives spans for the Walker's work.
+// See [Walker.Tracer].
+func WithTracer(t Tracer) Option {
+	return func(w *Walker) error {
+		w.Tracer = t
+		return nil
+	}
+}
+
+// WithMetrics is an [Option] setting the [Metrics] that observe the Walker's timings.
+// See [Walker.Metrics].
+func WithMetrics(m Metrics) Option {
+	return func(w *Walker) error {
+		w.Metrics = m
+		return nil
+	}
+}
+
+// WithSubmodules is an [Option] setting whether the Walker walks into git submodule checkouts.
+// See [Walker.Submodules].
+func WithSubmodules(p SubmodulePolicy) Option {
+	return func(w *Walker) error {
+		w.Submodules = p
+		return nil
+	}
+}
+
+// WithGitMetadata is an [Option] that adds git commit information to each [Module] produced.
+// See [Walker.GitMetadata].
+func WithGitMetadata() Option {
+	return func(w *Walker) error {
+		w.GitMetadata = true
+		return nil
+	}
+}
+
+// WithSkipNonGoDirs is an [Option] that skips directories named in [NonGoDirs].
+// See [Walker.SkipNonGoDirs].
+func WithSkipNonGoDirs() Option {
+	return func(w *Walker) error {
+		w.SkipNonGoDirs = true
+		return nil
+	}
+}
+
+// WithPruneLeaves is an [Option] that avoids reading directories with no subdirectories.
+// See [Walker.PruneLeaves].
+func WithPruneLeaves() Option {
+	return func(w *Walker) error {
+		w.PruneLeaves = true
+		return nil
+	}
+}
+
+// WithPipeline is an [Option] setting how loading packages overlaps with finding modules.
+// See [Walker.Pipeline].
+func WithPipeline(opts PipelineOptions) Option {
+	return func(w *Walker) error {
+		w.Pipeline = opts
+		return nil
+	}
+}
+
+// WithLoadMode is an [Option] setting the mode used when loading packages.
+// It is an error if mode is zero.
+// See [Walker.LoadConfig].
+func WithLoadMode(mode packages.LoadMode) Option {
+	return func(w *Walker) error {
+		if mode == 0 {
+			return fmt.Errorf("zero load mode")
+		}
+		w.LoadConfig.Mode = mode
+		return nil
+	}
+}
+
+// WithLoadTests is an [Option] that makes the Walker include test packages when loading.
+// See [Walker.LoadTests].
+func WithLoadTests() Option {
+	return func(w *Walker) error {
+		w.LoadTests = true
+		return nil
+	}
+}
+
+// WithFailOnPackageErrors is an [Option] that makes the Walker return an error
+// when packages fail to load.
+// If kinds is non-empty,
+// only package errors of those kinds cause a failure.
+// See [Walker.FailOnPackageErrors] and [Walker.FailOn].
+func WithFailOnPackageErrors(kinds ...packages.ErrorKind) Option {
+	return func(w *Walker) error {
+		for _, kind := range kinds {
+			switch kind {
+			case packages.UnknownError, packages.ListError, packages.ParseError, packages.TypeError:
+			default:
+				return fmt.Errorf("unknown package error kind %d", kind)
+			}
+		}
+		w.FailOnPackageErrors = true
+		w.FailOn = kinds
+		return nil
+	}
+}
+
+// WithBuildFlags is an [Option] adding build flags to use when loading packages.
+// It is an error if a flag does not begin with "-".
+// See [Walker.BuildFlags].
+func WithBuildFlags(flags ...string) Option {
+	return func(w *Walker) error {
+		for _, flag := range flags {
+			if !strings.HasPrefix(flag, "-") {
+				return fmt.Errorf("build flag %q does not begin with -", flag)
+			}
+		}
+		w.BuildFlags = append(w.BuildFlags, flags...)
+		return nil
+	}
+}
+
+// WithLoadPatterns is an [Option] setting the patterns to load in each module.
+// It is an error if no patterns are given.
+// See [Walker.LoadPatterns].
+func WithLoadPatterns(patterns ...string) Option {
+	return func(w *Walker) error {
+		if len(patterns) == 0 {
+			return fmt.Errorf("no load patterns")
+		}
+		w.LoadPatterns = patterns
+		return nil
+	}
+}
+
+// WithLoadCache is an [Option] setting the cache for package loads.
+// See [Walker.LoadCache].
+func WithLoadCache(cache LoadCache) Option {
+	return func(w *Walker) error {
+		if cache == nil {
+			return fmt.Errorf("nil load cache")
+		}
+		w.LoadCache = cache
+		return nil
+	}
+}
+
+// WithGomodCache is an [Option] setting the cache for parsed go.mod files.
+// See [Walker.GomodCache].
+func WithGomodCache(cache *GomodCache) Option {
+	return func(w *Walker) error {
+		if cache == nil {
+			return fmt.Errorf("nil go.mod cache")
+		}
+		w.GomodCache = cache
+		return nil
+	}
+}
+
+// WithEnv is an [Option] adding environment variable settings,
+// in "KEY=value" form,
+// to use when loading packages and running the go command.
+// It is an error if a setting has no "=".
+// See [Walker.Env].
+func WithEnv(env ...string) Option {
+	return func(w *Walker) error {
+		for _, kv := range env {
+			if k, _, ok := strings.Cut(kv, "="); !ok || k == "" {
+				return fmt.Errorf("environment setting %q is not in KEY=value form", kv)
+			}
+		}
+		w.Env = append(w.Env, env...)
+		return nil
+	}
+}
+
+// WithGomodEdits is an [Option] setting how the Walker lays out changes to go.mod files.
+// See [Walker.GomodEdits].
+func WithGomodEdits(opts GomodEditOptions) Option {
+	return func(w *Walker) error {
+		w.GomodEdits = opts
+		return nil
+	}
+}
+
+// WithLogger is an [Option] setting the logger for messages about what the Walker does.
+// See [Walker.Logger].
+func WithLogger(logger *slog.Logger) Option {
+	return func(w *Walker) error {
+		w.Logger = logger
+		return nil
+	}
+}
+
+// WithGOWORK is an [Option] setting the value of GOWORK,
+// such as "off" to disable workspace mode.
+// See [Walker.GOWORK].
+func WithGOWORK(gowork string) Option {
+	return func(w *Walker) error {
+		w.GOWORK = gowork
+		return nil
+	}
+}
+
+// WithGOFLAGS is an [Option] setting the value of GOFLAGS.
+// See [Walker.GOFLAGS].
+func WithGOFLAGS(goflags string) Option {
+	return func(w *Walker) error {
+		w.GOFLAGS = goflags
+		return nil
+	}
+}
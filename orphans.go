@@ -0,0 +1,150 @@
+package modules
+
+import (
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/bobg/errors"
+)
+
+// OrphanReason is the reason a Go file is an [OrphanedFile].
+type OrphanReason int
+
+const (
+	// OrphanOutsideModule means the file is not inside any module in the tree.
+	OrphanOutsideModule OrphanReason = iota + 1
+
+	// OrphanIgnoredDir means the file is inside a module,
+	// but in a directory whose name begins with _,
+	// which the go command ignores when matching package patterns.
+	// This includes directories with their own go.mod files,
+	// which are not modules of the tree for the same reason.
+	OrphanIgnoredDir
+
+	// OrphanBadGomod means the innermost go.mod file above the file
+	// cannot be parsed or has no module directive,
+	// so the file belongs to no usable module.
+	OrphanBadGomod
+)
+
+func (r OrphanReason) String() string {
+	switch r {
+	case OrphanOutsideModule:
+		return "outside module"
+	case OrphanIgnoredDir:
+		return "ignored directory"
+	case OrphanBadGomod:
+		return "bad go.mod"
+	}
+	return "unknown"
+}
+
+// OrphanedFile is a Go file in a tree of modules
+// that is not part of any package matched by a module's "./..." pattern.
+// See [Walker.OrphanedFiles].
+type OrphanedFile struct {
+	// Path is the path of the file.
+	Path string
+
+	// ModuleDir is the directory of the innermost module containing the file,
+	// or the empty string if there is none.
+	ModuleDir string
+
+	// Reason is why the file is orphaned.
+	Reason OrphanReason
+}
+
+// OrphanedFiles finds Go files in dir and its subdirectories
+// that no module's "./..." pattern reaches.
+// This function calls Walker.OrphanedFiles with a default Walker.
+func OrphanedFiles(dir string) ([]OrphanedFile, error) {
+	var w Walker
+	return w.OrphanedFiles(dir)
+}
+
+// OrphanedFiles finds Go files in dir and its subdirectories
+// that no module's "./..." pattern reaches,
+// and so are never built, tested, or vetted.
+// Such a file may be outside every module in the tree,
+// in a directory the go command ignores,
+// or under a go.mod file that is not usable.
+//
+// Directories whose names begin with a dot,
+// and testdata and vendor directories,
+// are not searched,
+// since Go files in them are deliberately excluded from builds.
+// Build constraints are not considered:
+// a file excluded only by build tags is not orphaned.
+// The result is sorted by Path.
+func (w *Walker) OrphanedFiles(dir string) ([]OrphanedFile, error) {
+	bad := make(map[string]bool) // module dirs with unusable go.mod files
+	var modDirs []string
+	err := w.Each(dir, func(subdir string) error {
+		modDirs = append(modDirs, subdir)
+		if _, mf, err := w.readGomod(subdir); err != nil || mf.Module == nil {
+			bad[subdir] = true
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var result []OrphanedFile
+	err = filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		name := entry.Name()
+		if entry.IsDir() {
+			if path != dir && (strings.HasPrefix(name, ".") || name == "testdata" || name == "vendor") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !strings.HasSuffix(name, ".go") || !entry.Type().IsRegular() {
+			return nil
+		}
+
+		fileDir := filepath.Dir(path)
+		modDir := innermostModuleDir(fileDir, modDirs)
+		switch {
+		case modDir == "":
+			result = append(result, OrphanedFile{Path: path, Reason: OrphanOutsideModule})
+		case bad[modDir]:
+			result = append(result, OrphanedFile{Path: path, ModuleDir: modDir, Reason: OrphanBadGomod})
+		default:
+			rel, err := filepath.Rel(modDir, fileDir)
+			if err != nil {
+				return errors.Wrapf(err, "getting relative path of %s", fileDir)
+			}
+			for _, elem := range strings.Split(filepath.ToSlash(rel), "/") {
+				if strings.HasPrefix(elem, "_") {
+					result = append(result, OrphanedFile{Path: path, ModuleDir: modDir, Reason: OrphanIgnoredDir})
+					break
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "walking %s", dir)
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].Path < result[j].Path })
+	return result, nil
+}
+
+// innermostModuleDir returns the longest of modDirs that is or contains dir,
+// or the empty string if there is none.
+func innermostModuleDir(dir string, modDirs []string) string {
+	var result string
+	for _, d := range modDirs {
+		if rel, err := filepath.Rel(d, dir); err == nil && filepath.IsLocal(rel) && len(d) > len(result) {
+			result = d
+		}
+	}
+	return result
+}
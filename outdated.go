@@ -0,0 +1,260 @@
+package modules
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"github.com/bobg/errors"
+	"golang.org/x/mod/modfile"
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/semver"
+)
+
+// UpgradeKind classifies an available upgrade of a dependency.
+type UpgradeKind int
+
+const (
+	// UpgradeNone means no newer version is available.
+	UpgradeNone UpgradeKind = iota
+
+	// UpgradePatch means the newer version differs only in its patch number.
+	UpgradePatch
+
+	// UpgradeMinor means the newer version has a higher minor number.
+	UpgradeMinor
+
+	// UpgradeMajor means the newer version has a higher major number,
+	// and so (from v2 on) a different module path.
+	UpgradeMajor
+)
+
+func (k UpgradeKind) String() string {
+	switch k {
+	case UpgradeNone:
+		return "none"
+	case UpgradePatch:
+		return "patch"
+	case UpgradeMinor:
+		return "minor"
+	case UpgradeMajor:
+		return "major"
+	}
+	return "unknown"
+}
+
+// OutdatedRequire is a require directive for a dependency with a newer version available,
+// or whose required version has been retracted.
+// See [Walker.OutdatedEach].
+type OutdatedRequire struct {
+	// Path and Version are the module path and version in the require directive.
+	Path, Version string
+
+	// Indirect tells whether the require directive is marked "// indirect".
+	Indirect bool
+
+	// Latest is the latest version of the module at the same module path,
+	// or the empty string if it is no newer than Version.
+	// Retracted versions are never reported here.
+	Latest string
+
+	// Kind classifies the upgrade from Version to Latest.
+	// It is UpgradeMajor only for an upgrade from v0 to v1.
+	Kind UpgradeKind
+
+	// MajorPath and MajorVersion are the module path and latest version
+	// of the highest newer major version of the module,
+	// such as "example.com/foo/v3" and "v3.1.0",
+	// or empty strings if there is none.
+	MajorPath, MajorVersion string
+
+	// Retracted contains the retraction rationales for Version,
+	// if it has been retracted by the module's author.
+	Retracted []string
+}
+
+// ModuleOutdated is the result of [Walker.OutdatedEach] for a single module.
+type ModuleOutdated struct {
+	// Dir is the module's directory.
+	Dir string
+
+	// Requires are the module's require directives that are outdated,
+	// in go.mod order.
+	Requires []OutdatedRequire
+}
+
+// OutdatedEach reports available upgrades of the dependencies
+// of each Go module in dir and its subdirectories.
+// This function calls Walker.OutdatedEach with a default Walker.
+func OutdatedEach(ctx context.Context, dir string) ([]ModuleOutdated, error) {
+	var w Walker
+	return w.OutdatedEach(ctx, dir)
+}
+
+// OutdatedEach reports available upgrades of the dependencies
+// of each Go module in dir and its subdirectories.
+// The result has one entry per module,
+// including those with nothing outdated.
+//
+// The latest version of each required module is found with "go list -m -u",
+// which queries the module proxy given by GOPROXY
+// (see [Walker.Env])
+// and skips retracted versions.
+// Newer major versions,
+// which have different module paths,
+// are found by querying "path/v2@latest", "path/v3@latest", and so on
+// until one is not found.
+// Requires that are replaced with a local directory are skipped,
+// and each module is queried outside of any workspace,
+// so versions are relative to what its own go.mod requires.
+func (w *Walker) OutdatedEach(ctx context.Context, dir string) ([]ModuleOutdated, error) {
+	w2 := *w
+	w2.GOWORK = "off"
+
+	var result []ModuleOutdated
+	err := w.EachGomod(dir, func(subdir string, mf *modfile.File) error {
+		reqs, err := w2.outdatedRequires(ctx, subdir, mf, true)
+		if err != nil {
+			return err
+		}
+		result = append(result, ModuleOutdated{Dir: subdir, Requires: reqs})
+		return nil
+	})
+	return result, err
+}
+
+// outdatedRequires finds the outdated requires in go.mod file mf of the module in dir.
+// If majors is false,
+// newer major versions are not looked for.
+func (w *Walker) outdatedRequires(ctx context.Context, dir string, mf *modfile.File, majors bool) ([]OutdatedRequire, error) {
+	if len(mf.Require) == 0 {
+		return nil, nil
+	}
+
+	args := []string{"list", "-m", "-u", "-retracted", "-json"}
+	for _, req := range mf.Require {
+		args = append(args, req.Mod.Path)
+	}
+	out, err := w.goCmdContext(ctx, dir, args...)
+	if err != nil {
+		return nil, err
+	}
+	listed, err := decodeListedModules(out)
+	if err != nil {
+		return nil, err
+	}
+	byPath := make(map[string]listedModule)
+	for _, m := range listed {
+		byPath[m.Path] = m
+	}
+
+	var result []OutdatedRequire
+	for _, req := range mf.Require {
+		m := byPath[req.Mod.Path]
+		if m.Replace != nil && m.Replace.Version == "" {
+			continue // replaced with a local directory
+		}
+
+		o := OutdatedRequire{
+			Path:     req.Mod.Path,
+			Version:  req.Mod.Version,
+			Indirect: req.Indirect,
+		}
+
+		// Go list reports updates relative to the selected version,
+		// which may be higher than the required one.
+		latest := m.Version
+		if m.Update != nil {
+			latest = m.Update.Version
+		}
+		if semver.Compare(latest, req.Mod.Version) > 0 {
+			o.Latest = latest
+			o.Kind = classifyUpgrade(req.Mod.Version, latest)
+		}
+		if m.Version == req.Mod.Version {
+			o.Retracted = m.Retracted
+		} else if o.Retracted, err = w.retractions(ctx, dir, req.Mod.Path, req.Mod.Version); err != nil {
+			return nil, err
+		}
+
+		if majors {
+			o.MajorPath, o.MajorVersion, err = w.latestMajor(ctx, dir, req.Mod.Path)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		if o.Latest != "" || o.MajorPath != "" || len(o.Retracted) > 0 {
+			result = append(result, o)
+		}
+	}
+	return result, nil
+}
+
+// retractions returns the retraction rationales for version of the module modpath,
+// as reported by "go list -m -retracted".
+func (w *Walker) retractions(ctx context.Context, dir, modpath, version string) ([]string, error) {
+	out, err := w.goCmdContext(ctx, dir, "list", "-m", "-retracted", "-json", modpath+"@"+version)
+	if err != nil {
+		return nil, err
+	}
+	listed, err := decodeListedModules(out)
+	if err != nil || len(listed) == 0 {
+		return nil, err
+	}
+	return listed[0].Retracted, nil
+}
+
+// latestMajor finds the highest major version of the module modpath newer than modpath's own,
+// returning its module path and latest version,
+// or empty strings if there is none.
+func (w *Walker) latestMajor(ctx context.Context, dir, modpath string) (string, string, error) {
+	prefix, pathMajor, ok := module.SplitPathVersion(modpath)
+	if !ok {
+		return "", "", nil
+	}
+
+	major := 1
+	if pathMajor != "" {
+		n, err := strconv.Atoi(strings.TrimLeft(pathMajor, "/.v"))
+		if err != nil {
+			return "", "", errors.Wrapf(err, "parsing major version of %s", modpath)
+		}
+		major = n
+	}
+	sep := "/v"
+	if strings.HasPrefix(modpath, "gopkg.in/") {
+		sep = ".v"
+	}
+
+	var resultPath, resultVersion string
+	for {
+		major++
+		candidate := prefix + sep + strconv.Itoa(major)
+		out, err := w.goCmdContext(ctx, dir, "list", "-m", "-json", candidate+"@latest")
+		if err != nil {
+			// Not found, or unreachable;
+			// either way, there is nothing more to report.
+			break
+		}
+		listed, err := decodeListedModules(out)
+		if err != nil || len(listed) == 0 || listed[0].Error != nil {
+			break
+		}
+		resultPath, resultVersion = candidate, listed[0].Version
+	}
+	return resultPath, resultVersion, ctx.Err()
+}
+
+// classifyUpgrade classifies the upgrade from version from to version to,
+// which must be newer.
+func classifyUpgrade(from, to string) UpgradeKind {
+	switch {
+	case semver.Major(from) != semver.Major(to):
+		return UpgradeMajor
+	case semver.MajorMinor(from) != semver.MajorMinor(to):
+		return UpgradeMinor
+	default:
+		return UpgradePatch
+	}
+}
@@ -0,0 +1,113 @@
+package modules
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/bobg/errors"
+	"golang.org/x/mod/modfile"
+)
+
+// GomodDiagnostic is a problem found in a go.mod file by [Walker.DiagnoseGomods].
+type GomodDiagnostic struct {
+	// Dir is the directory of the module.
+	Dir string
+
+	// Filename is the path of the go.mod file.
+	Filename string
+
+	// Line and Column are the 1-based position of the problem,
+	// with Column counting runes.
+	// They are zero if the problem has no specific position.
+	Line, Column int
+
+	// Snippet is the text of the go.mod file's line at Line,
+	// without its line ending,
+	// or the empty string if Line is zero.
+	Snippet string
+
+	// Message describes the problem.
+	Message string
+}
+
+func (d GomodDiagnostic) String() string {
+	switch {
+	case d.Line == 0:
+		return fmt.Sprintf("%s: %s", d.Filename, d.Message)
+	case d.Column == 0:
+		return fmt.Sprintf("%s:%d: %s", d.Filename, d.Line, d.Message)
+	}
+	return fmt.Sprintf("%s:%d:%d: %s", d.Filename, d.Line, d.Column, d.Message)
+}
+
+// DiagnoseGomods parses every go.mod file in dir and its subdirectories
+// and reports the problems found.
+// This function calls Walker.DiagnoseGomods with a default Walker.
+func DiagnoseGomods(dir string) ([]GomodDiagnostic, error) {
+	var w Walker
+	return w.DiagnoseGomods(dir)
+}
+
+// DiagnoseGomods parses every go.mod file in dir and its subdirectories
+// and reports the problems found,
+// in the order [Walker.Each] visits the modules
+// and then in file order.
+// Unlike [Walker.EachGomod],
+// it does not stop at the first go.mod file that fails to parse,
+// so it can show every problem in a tree at once.
+//
+// Files are parsed strictly,
+// as with [modfile.Parse],
+// regardless of w.ParseLax,
+// though w.VersionFixer is used.
+// A go.mod file with no module directive is also reported.
+// The error result is for problems walking the tree,
+// not problems in go.mod files.
+func (w *Walker) DiagnoseGomods(dir string) ([]GomodDiagnostic, error) {
+	var result []GomodDiagnostic
+	err := w.Each(dir, func(subdir string) error {
+		filename := filepath.Join(subdir, "go.mod")
+		data, err := os.ReadFile(filename)
+		if err != nil {
+			return errors.Wrapf(err, "reading %s", filename)
+		}
+		result = append(result, diagnoseGomod(subdir, filename, data, w.VersionFixer)...)
+		return nil
+	})
+	return result, err
+}
+
+func diagnoseGomod(dir, filename string, data []byte, fix modfile.VersionFixer) []GomodDiagnostic {
+	lines := bytes.Split(data, []byte("\n"))
+	diag := func(line, col int, msg string) GomodDiagnostic {
+		d := GomodDiagnostic{Dir: dir, Filename: filename, Line: line, Column: col, Message: msg}
+		if line > 0 && line <= len(lines) {
+			d.Snippet = string(bytes.TrimRight(lines[line-1], "\r"))
+		}
+		return d
+	}
+
+	mf, err := modfile.Parse(filename, data, fix)
+	if err != nil {
+		var errList modfile.ErrorList
+		if !errors.As(err, &errList) {
+			return []GomodDiagnostic{diag(0, 0, err.Error())}
+		}
+		var result []GomodDiagnostic
+		for _, e := range errList {
+			msg := e.Err.Error()
+			if e.Verb != "" {
+				msg = e.Verb + " " + e.ModPath + ": " + msg
+			}
+			result = append(result, diag(e.Pos.Line, e.Pos.LineRune, msg))
+		}
+		return result
+	}
+
+	if mf.Module == nil {
+		return []GomodDiagnostic{diag(0, 0, "no module directive")}
+	}
+	return nil
+}
@@ -0,0 +1,234 @@
+package modules
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+
+	"github.com/bobg/errors"
+	"golang.org/x/mod/modfile"
+	"golang.org/x/sync/errgroup"
+	"golang.org/x/tools/go/packages"
+)
+
+// PipelineOptions control how [Walker.LoadEach] and [Walker.LoadEachGomod]
+// overlap finding modules, parsing their go.mod files, and loading their packages.
+// See [Walker.Pipeline].
+//
+// When neither Parse nor Load is greater than 1,
+// there is no pipeline:
+// each module is found, parsed, loaded, and passed to the callback
+// before the walk looks for the next one.
+//
+// Otherwise the walk
+// (which may itself be concurrent; see [Walker.ScanConcurrency])
+// runs ahead of parsing,
+// which runs ahead of loading,
+// each stage with its own number of goroutines.
+// Callbacks are still called one at a time.
+// The walk may find,
+// and the later stages may process,
+// modules that a callback's [filepath.SkipDir] or [filepath.SkipAll] then skips.
+type PipelineOptions struct {
+	// Parse is the number of go.mod files to parse at once.
+	// Values less than 1 mean 1.
+	Parse int
+
+	// Load is the number of modules whose packages are loaded at once.
+	// Values less than 1 mean 1.
+	Load int
+
+	// Unordered, if true,
+	// passes each module to the callback as soon as it is loaded.
+	// Otherwise modules are passed to the callback in the order [Walker.Each] visits them,
+	// and a module that loads quickly may wait for one found earlier that loads slowly.
+	// To bound the memory held by modules waiting their turn,
+	// the walk then runs no more than 2*(Parse+Load) modules ahead of the callback,
+	// so one slow module can stall the pipeline.
+	//
+	// When Unordered is true,
+	// a [filepath.SkipDir] from the callback
+	// does not prevent calls for nested modules that were already delivered.
+	Unordered bool
+}
+
+func (o PipelineOptions) enabled() bool {
+	return o.Parse > 1 || o.Load > 1
+}
+
+// pipelineItem is a module making its way through the stages of [Walker.pipeline].
+type pipelineItem struct {
+	seq  int // position in walk order
+	dir  string
+	data []byte
+	mf   *modfile.File
+	pkgs []*packages.Package
+	err  error
+}
+
+// pipeline is the implementation of loadEach and loadEachGomod
+// when w.Pipeline is enabled.
+// If parse is false,
+// go.mod files are not parsed
+// and f receives a nil *modfile.File.
+func (w *Walker) pipeline(dir string, mode packages.LoadMode, parse bool, f func(string, *modfile.File, []*packages.Package) error) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var (
+		g       errgroup.Group
+		found   = make(chan pipelineItem)
+		parsed  = make(chan pipelineItem)
+		loaded  = make(chan pipelineItem)
+		walkErr error
+
+		// slots, if not nil,
+		// limits how far the walk runs ahead of delivery in walk order.
+		// The walk takes a slot for each module it finds,
+		// and deliver gives it back when the module's turn comes.
+		slots chan struct{}
+	)
+	if !w.Pipeline.Unordered {
+		slots = make(chan struct{}, 2*(max(w.Pipeline.Parse, 1)+max(w.Pipeline.Load, 1)))
+	}
+
+	// send sends item on ch,
+	// reporting false if the pipeline has been canceled instead.
+	send := func(ch chan<- pipelineItem, item pipelineItem) bool {
+		select {
+		case ch <- item:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+
+	g.Go(func() error {
+		defer close(found)
+
+		var seq int
+		walkErr = w.Each(dir, func(subdir string) error {
+			if slots != nil {
+				select {
+				case slots <- struct{}{}:
+				case <-ctx.Done():
+					return filepath.SkipAll
+				}
+			}
+			if !send(found, pipelineItem{seq: seq, dir: subdir}) {
+				return filepath.SkipAll
+			}
+			seq++
+			return nil
+		})
+		return nil
+	})
+
+	w.pipelineStage(&g, w.Pipeline.Parse, found, parsed, send, func(item *pipelineItem) {
+		if parse {
+			item.data, item.mf, item.err = w.readGomod(item.dir)
+		}
+	})
+	w.pipelineStage(&g, w.Pipeline.Load, parsed, loaded, send, func(item *pipelineItem) {
+		if item.err == nil {
+			item.pkgs, item.err = w.loadWithGomod(item.dir, item.data, mode)
+		}
+	})
+
+	err := w.deliver(loaded, slots, f)
+
+	cancel()
+	_ = g.Wait() // Stage goroutines report their errors in the items they send.
+
+	if err != nil {
+		if errors.Is(err, filepath.SkipAll) {
+			return nil
+		}
+		return err
+	}
+	return walkErr
+}
+
+// pipelineStage starts n goroutines (at least one)
+// calling process on each item from in
+// and sending the result to out.
+// It closes out when they are done.
+func (w *Walker) pipelineStage(g *errgroup.Group, n int, in <-chan pipelineItem, out chan<- pipelineItem, send func(chan<- pipelineItem, pipelineItem) bool, process func(*pipelineItem)) {
+	var stage errgroup.Group
+	for i := 0; i < max(n, 1); i++ {
+		stage.Go(func() error {
+			for item := range in {
+				process(&item)
+				if !send(out, item) {
+					return nil
+				}
+			}
+			return nil
+		})
+	}
+	g.Go(func() error {
+		defer close(out)
+		return stage.Wait()
+	})
+}
+
+// deliver calls f for the items from ch,
+// in walk order unless w.Pipeline.Unordered is true,
+// until ch is closed or f returns an error.
+// In walk order,
+// it frees one of slots (if not nil) as each item's turn comes.
+// Errors are handled as [Walker.each] handles them.
+func (w *Walker) deliver(ch <-chan pipelineItem, slots <-chan struct{}, f func(string, *modfile.File, []*packages.Package) error) error {
+	var (
+		skipped []string // prefixes of directories skipped by f
+		pending = make(map[int]pipelineItem)
+		next    int
+	)
+
+	call := func(item pipelineItem) error {
+		for _, prefix := range skipped {
+			if strings.HasPrefix(item.dir, prefix) {
+				return nil
+			}
+		}
+		if item.err != nil {
+			return visitError(item.dir, item.err)
+		}
+		err := f(item.dir, item.mf, item.pkgs)
+		switch {
+		case errors.Is(err, filepath.SkipDir):
+			skipped = append(skipped, item.dir+string(filepath.Separator))
+			return nil
+		case errors.Is(err, filepath.SkipAll):
+			return err
+		case err != nil:
+			return visitError(item.dir, err)
+		}
+		return nil
+	}
+
+	for item := range ch {
+		if w.Pipeline.Unordered {
+			if err := call(item); err != nil {
+				return err
+			}
+			continue
+		}
+		pending[item.seq] = item
+		for {
+			item, ok := pending[next]
+			if !ok {
+				break
+			}
+			delete(pending, next)
+			next++
+			if slots != nil {
+				<-slots
+			}
+			if err := call(item); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,166 @@
+package modules
+
+import (
+	"go/ast"
+	"go/doc"
+	"go/token"
+	"sort"
+
+	"github.com/bobg/errors"
+	"golang.org/x/tools/go/packages"
+)
+
+// PackageDoc is the documentation of a package.
+// See [Walker.DocEach].
+type PackageDoc struct {
+	// PkgPath is the package's import path.
+	PkgPath string
+
+	// Name is the package name.
+	Name string
+
+	// Doc is the package's doc comment,
+	// and Synopsis is its first sentence.
+	Doc, Synopsis string
+
+	// Symbols are the package's exported identifiers,
+	// sorted by name.
+	Symbols []DocSymbol
+}
+
+// DocSymbol is an exported identifier in a [PackageDoc].
+type DocSymbol struct {
+	// Name is the identifier,
+	// qualified with the name of its receiver type if it is a method,
+	// as in "Reader.Read".
+	Name string
+
+	// Kind is "const", "var", "type", "func", or "method".
+	Kind string
+
+	// Doc is the identifier's doc comment.
+	// For a constant or variable declared in a group,
+	// this is the group's doc comment
+	// if the identifier has none of its own.
+	Doc string
+
+	// Position is the location of the identifier's declaration.
+	Position token.Position
+}
+
+// DocEach calls f with the documentation of the packages in each Go module in dir and its subdirectories.
+// This function calls Walker.DocEach with a default Walker.
+func DocEach(dir string, f func(string, []PackageDoc) error) error {
+	var w Walker
+	return w.DocEach(dir, f)
+}
+
+// DocEach calls f with the documentation of the packages in each Go module in dir and its subdirectories,
+// as extracted by [go/doc] from the syntax trees of the packages loaded as with [Walker.LoadEach].
+// The arguments to f are the directory containing the go.mod file
+// (which will have dir as a prefix)
+// and the documentation for each of its packages,
+// sorted by import path.
+// Test packages are omitted.
+func (w *Walker) DocEach(dir string, f func(string, []PackageDoc) error) error {
+	const mode = packages.NeedName | packages.NeedFiles | packages.NeedSyntax
+
+	return w.loadEach(dir, mode, func(subdir string, pkgs []*packages.Package) error {
+		var docs []PackageDoc
+		for _, pkg := range pkgs {
+			if isTestVariant(pkg) || len(pkg.Syntax) == 0 {
+				continue
+			}
+			p, err := doc.NewFromFiles(pkg.Fset, pkg.Syntax, pkg.PkgPath)
+			if err != nil {
+				return errors.Wrapf(err, "extracting documentation of %s", pkg.PkgPath)
+			}
+			docs = append(docs, packageDoc(pkg.Fset, p))
+		}
+		sort.Slice(docs, func(i, j int) bool { return docs[i].PkgPath < docs[j].PkgPath })
+		return f(subdir, docs)
+	})
+}
+
+func packageDoc(fset *token.FileSet, p *doc.Package) PackageDoc {
+	result := PackageDoc{
+		PkgPath:  p.ImportPath,
+		Name:     p.Name,
+		Doc:      p.Doc,
+		Synopsis: p.Synopsis(p.Doc),
+	}
+
+	addValues := func(kind string, values []*doc.Value) {
+		for _, v := range values {
+			for i, name := range v.Names {
+				if !token.IsExported(name) {
+					continue
+				}
+				sym := DocSymbol{Name: name, Kind: kind, Doc: v.Doc}
+				if spec := valueSpec(v, i); spec != nil {
+					sym.Position = fset.Position(spec.Pos())
+					if spec.Doc != nil {
+						sym.Doc = spec.Doc.Text()
+					}
+				}
+				result.Symbols = append(result.Symbols, sym)
+			}
+		}
+	}
+	addFuncs := func(prefix, kind string, funcs []*doc.Func) {
+		for _, fn := range funcs {
+			result.Symbols = append(result.Symbols, DocSymbol{
+				Name:     prefix + fn.Name,
+				Kind:     kind,
+				Doc:      fn.Doc,
+				Position: fset.Position(fn.Decl.Pos()),
+			})
+		}
+	}
+
+	addValues("const", p.Consts)
+	addValues("var", p.Vars)
+	addFuncs("", "func", p.Funcs)
+	for _, t := range p.Types {
+		result.Symbols = append(result.Symbols, DocSymbol{
+			Name:     t.Name,
+			Kind:     "type",
+			Doc:      t.Doc,
+			Position: fset.Position(typePos(t)),
+		})
+		addValues("const", t.Consts)
+		addValues("var", t.Vars)
+		addFuncs("", "func", t.Funcs)
+		addFuncs(t.Name+".", "method", t.Methods)
+	}
+
+	sort.SliceStable(result.Symbols, func(i, j int) bool { return result.Symbols[i].Name < result.Symbols[j].Name })
+	return result
+}
+
+// valueSpec returns the spec declaring the i'th name in v.
+func valueSpec(v *doc.Value, i int) *ast.ValueSpec {
+	name := v.Names[i]
+	for _, spec := range v.Decl.Specs {
+		vs, ok := spec.(*ast.ValueSpec)
+		if !ok {
+			continue
+		}
+		for _, ident := range vs.Names {
+			if ident.Name == name {
+				return vs
+			}
+		}
+	}
+	return nil
+}
+
+// typePos returns the position of the spec declaring t.
+func typePos(t *doc.Type) token.Pos {
+	for _, spec := range t.Decl.Specs {
+		if ts, ok := spec.(*ast.TypeSpec); ok && ts.Name.Name == t.Name {
+			return ts.Pos()
+		}
+	}
+	return t.Decl.Pos()
+}
@@ -0,0 +1,9 @@
+//go:build !unix
+
+package modules
+
+// isLeafDir tells whether dir is known to have no subdirectories.
+// On this platform it never is.
+func isLeafDir(dir string) bool {
+	return false
+}
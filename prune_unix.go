@@ -0,0 +1,24 @@
+//go:build unix
+
+package modules
+
+import (
+	"os"
+	"syscall"
+)
+
+// isLeafDir tells whether dir is known to have no subdirectories,
+// judging by its link count:
+// a directory's link count is 2 plus its number of subdirectories
+// on most Unix filesystems.
+// Some filesystems report other counts for directories
+// (such as 1, meaning unknown),
+// which are not trusted.
+func isLeafDir(dir string) bool {
+	info, err := os.Stat(osPath(dir))
+	if err != nil {
+		return false
+	}
+	st, ok := info.Sys().(*syscall.Stat_t)
+	return ok && st.Nlink == 2
+}
@@ -0,0 +1,65 @@
+package modules
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bobg/errors"
+	"golang.org/x/mod/modfile"
+	"golang.org/x/mod/module"
+)
+
+// PseudoVersion computes the pseudo-version
+// (such as v1.2.4-0.20231115123456-abcdef123456)
+// corresponding to the HEAD commit of the git repository containing the Go module in dir.
+// This is suitable for use in require directives pointing at unreleased versions of the module.
+//
+// The base version of the pseudo-version is the highest tagged version of the module reachable from HEAD
+// with the major version implied by the module path.
+// Tags for a module in a subdirectory of its repository must be prefixed with that subdirectory,
+// as in "sub/dir/v1.2.3".
+//
+// Uncommitted changes in the working tree are not reflected in the result.
+func PseudoVersion(dir string) (string, error) {
+	gomodPath := filepath.Join(dir, "go.mod")
+	data, err := os.ReadFile(gomodPath)
+	if err != nil {
+		return "", errors.Wrapf(err, "reading %s", gomodPath)
+	}
+	modpath := modfile.ModulePath(data)
+	if modpath == "" {
+		return "", fmt.Errorf("no module path in %s", gomodPath)
+	}
+	major, err := modulePathMajor(modpath)
+	if err != nil {
+		return "", errors.Wrapf(err, "in %s", gomodPath)
+	}
+
+	out, err := git(dir, "log", "-1", "--format=%H %ct", "HEAD")
+	if err != nil {
+		return "", errors.Wrapf(err, "getting HEAD commit in %s", dir)
+	}
+	fields := strings.Fields(out)
+	if len(fields) != 2 {
+		return "", fmt.Errorf("unexpected git log output %q in %s", out, dir)
+	}
+	hash := fields[0]
+	if len(hash) > 12 {
+		hash = hash[:12]
+	}
+	secs, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil {
+		return "", errors.Wrapf(err, "parsing commit time %s", fields[1])
+	}
+
+	older, err := latestModuleVersion(dir, major, "HEAD")
+	if err != nil {
+		return "", err
+	}
+
+	return module.PseudoVersion(major, older, time.Unix(secs, 0), hash), nil
+}
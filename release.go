@@ -0,0 +1,176 @@
+package modules
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/bobg/errors"
+	"golang.org/x/mod/semver"
+)
+
+// ReleaseOrder returns the Go modules in dir and its subdirectories
+// in an order suitable for tagging releases.
+// This function calls Walker.ReleaseOrder with a default Walker.
+func ReleaseOrder(dir string) ([]*Module, error) {
+	var w Walker
+	return w.ReleaseOrder(dir)
+}
+
+// ReleaseOrder returns the Go modules in dir and its subdirectories
+// in an order suitable for tagging releases:
+// each module comes after every module in the tree that it depends on,
+// so that when its turn comes,
+// its dependencies have already been released.
+//
+// Dependencies are determined by [Walker.BuildModuleGraph],
+// and the order by [Graph.TopoSort].
+// If the modules have a dependency cycle,
+// there is no valid release order,
+// and the error is a [*CycleError].
+func (w *Walker) ReleaseOrder(dir string) ([]*Module, error) {
+	g, err := w.BuildModuleGraph(dir)
+	if err != nil {
+		return nil, err
+	}
+	nodes, err := g.TopoSort()
+	if err != nil {
+		return nil, err
+	}
+	result := make([]*Module, 0, len(nodes))
+	for _, node := range nodes {
+		result = append(result, node.Module)
+	}
+	return result, nil
+}
+
+// NextTag describes the next release of a module.
+// See [Walker.NextTags].
+type NextTag struct {
+	BumpRecommendation
+
+	// Version is the version for the next release,
+	// or the empty string if no release is needed
+	// (or if one cannot be computed; see Note).
+	Version string
+
+	// Tag is the git tag to create for the next release:
+	// Version, prefixed with the module's subdirectory in its repository, if any.
+	// It is the empty string when Version is.
+	Tag string
+
+	// Note explains why there is no Version when a release is needed but one cannot be computed.
+	Note string
+}
+
+// NextTags computes the next release tag for each Go module in dir and its subdirectories.
+// This function calls Walker.NextTags with a default Walker.
+func NextTags(dir string) ([]NextTag, error) {
+	var w Walker
+	return w.NextTags(dir)
+}
+
+// NextTags computes the next release tag for each Go module in dir and its subdirectories.
+// It uses [Walker.RecommendBumps] to find each module's latest tagged version
+// and the kind of version bump it needs,
+// then computes the resulting version and tag name.
+// Tags for a module in a subdirectory of its repository are prefixed with that subdirectory,
+// as in "sub/dir/v1.2.3".
+//
+// Following Go conventions,
+// incompatible changes to a v0 module call for a minor-version bump,
+// not a major one.
+// For a v1 or later module,
+// incompatible changes require a new module path with a new major-version suffix,
+// so no tag is computed;
+// see the Note field of [NextTag].
+// A module with no tagged versions gets v0.1.0,
+// or vN.0.0 if its module path has a /vN suffix.
+//
+// Modules that need no release are included in the result with an empty Version and Tag.
+func (w *Walker) NextTags(dir string) ([]NextTag, error) {
+	recs, err := w.RecommendBumps(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]NextTag, 0, len(recs))
+	for _, rec := range recs {
+		next := NextTag{BumpRecommendation: rec}
+		next.Version, next.Note, err = nextVersion(rec)
+		if err != nil {
+			return nil, errors.Wrapf(err, "in %s", rec.Dir)
+		}
+		if next.Version != "" {
+			prefix, err := moduleTagPrefix(rec.Dir)
+			if err != nil {
+				return nil, errors.Wrapf(err, "getting tag prefix for %s", rec.Dir)
+			}
+			next.Tag = prefix + next.Version
+		}
+		result = append(result, next)
+	}
+
+	return result, nil
+}
+
+// nextVersion computes the version following rec.Latest given rec.Level.
+// If that can't be done,
+// it returns the empty string and a note explaining why.
+func nextVersion(rec BumpRecommendation) (version, note string, err error) {
+	if rec.Level == BumpNone {
+		return "", "", nil
+	}
+
+	if rec.Latest == "" {
+		major, err := modulePathMajor(rec.Path)
+		if err != nil {
+			return "", "", err
+		}
+		if major == "" {
+			return "v0.1.0", "", nil
+		}
+		return major + ".0.0", "", nil
+	}
+
+	x, y, z, err := parseSemver(rec.Latest)
+	if err != nil {
+		return "", "", err
+	}
+	prerelease := semver.Prerelease(rec.Latest) != ""
+
+	level := rec.Level
+	if level == BumpMajor && x == 0 {
+		level = BumpMinor
+	}
+
+	// If the latest version is a prerelease,
+	// the release it anticipates may already be a big enough bump.
+	switch level {
+	case BumpMajor:
+		return "", "incompatible changes require a new major version, with a new module path", nil
+
+	case BumpMinor:
+		if !prerelease || z != 0 {
+			y, z = y+1, 0
+		}
+
+	case BumpPatch:
+		if !prerelease {
+			z++
+		}
+	}
+
+	return fmt.Sprintf("v%d.%d.%d", x, y, z), "", nil
+}
+
+// parseSemver parses the major, minor, and patch numbers from a semantic version string,
+// ignoring any prerelease and build suffixes.
+func parseSemver(v string) (x, y, z int, err error) {
+	canon := semver.Canonical(v)
+	if canon == "" {
+		return 0, 0, 0, fmt.Errorf("invalid semantic version %s", v)
+	}
+	canon = strings.TrimSuffix(canon, semver.Prerelease(canon))
+	_, err = fmt.Sscanf(canon, "v%d.%d.%d", &x, &y, &z)
+	return x, y, z, errors.Wrapf(err, "parsing semantic version %s", v)
+}
@@ -0,0 +1,260 @@
+package modules
+
+import (
+	"fmt"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/bobg/errors"
+	"golang.org/x/mod/modfile"
+	"golang.org/x/mod/module"
+)
+
+// RenameModule changes the module path of a Go module in dir or its subdirectories,
+// and updates the rest of the tree to match.
+// It returns the paths of the files it changed.
+// This function calls Walker.RenameModule with a default Walker.
+func RenameModule(dir, oldPath, newPath string) ([]string, error) {
+	var w Walker
+	return w.RenameModule(dir, oldPath, newPath)
+}
+
+// RenameModule changes the module path of a Go module in dir or its subdirectories
+// from oldPath to newPath,
+// and updates the rest of the tree to match.
+// It returns the paths of the files it changed.
+//
+// The module's go.mod file gets a new module directive.
+// In every module in the tree,
+// imports of packages in the renamed module are rewritten,
+// as are require and replace directives mentioning oldPath.
+// Imports of packages in other modules whose paths begin with oldPath
+// (such as nested modules, or a different major version)
+// are left alone.
+//
+// Import paths are rewritten in place in each Go file,
+// regardless of build constraints,
+// without otherwise reformatting it.
+// Files in directories that the go command ignores
+// (such as testdata)
+// are not changed.
+func (w *Walker) RenameModule(dir, oldPath, newPath string) ([]string, error) {
+	w = w.forEdit()
+
+	if err := module.CheckPath(newPath); err != nil {
+		return nil, errors.Wrapf(err, "checking module path %s", newPath)
+	}
+
+	var (
+		gomods    = make(map[string]*modfile.File)
+		dirs      []string
+		modPaths  []string
+		renameDir string
+	)
+	err := w.EachGomod(dir, func(subdir string, mf *modfile.File) error {
+		dirs = append(dirs, subdir)
+		gomods[subdir] = mf
+		if mf.Module == nil {
+			return nil
+		}
+		switch mf.Module.Mod.Path {
+		case oldPath:
+			if renameDir != "" {
+				return fmt.Errorf("module path %s is used by both %s and %s", oldPath, renameDir, subdir)
+			}
+			renameDir = subdir
+		case newPath:
+			return fmt.Errorf("module path %s is already used by %s", newPath, subdir)
+		}
+		modPaths = append(modPaths, mf.Module.Mod.Path)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if renameDir == "" {
+		return nil, fmt.Errorf("no module with path %s in %s", oldPath, dir)
+	}
+
+	rewrite := func(importPath string) (string, bool) {
+		if owningModule(importPath, modPaths) != oldPath || isOtherMajorVersion(importPath, oldPath) {
+			return "", false
+		}
+		return newPath + strings.TrimPrefix(importPath, oldPath), true
+	}
+
+	var changed []string
+	for _, subdir := range dirs {
+		mf := gomods[subdir]
+		if subdir == renameDir {
+			if err := mf.AddModuleStmt(newPath); err != nil {
+				return changed, errors.Wrapf(err, "updating module directive in %s", subdir)
+			}
+		}
+		gomodChanged, err := renameInGomod(mf, oldPath, newPath)
+		if err != nil {
+			return changed, errors.Wrapf(err, "updating %s", subdir)
+		}
+		if gomodChanged || subdir == renameDir {
+			if err := w.writeGomod(subdir, mf); err != nil {
+				return changed, err
+			}
+			changed = append(changed, filepath.Join(subdir, "go.mod"))
+		}
+
+		files, err := rewriteModuleImports(subdir, rewrite)
+		changed = append(changed, files...)
+		if err != nil {
+			return changed, err
+		}
+	}
+
+	return changed, nil
+}
+
+// renameInGomod changes the require and replace directives in mf that mention oldPath to use newPath instead.
+// It reports whether anything changed.
+func renameInGomod(mf *modfile.File, oldPath, newPath string) (bool, error) {
+	var changed bool
+
+	for _, req := range mf.Require {
+		if req.Mod.Path == oldPath {
+			if err := renameRequire(mf, oldPath, newPath); err != nil {
+				return false, err
+			}
+			changed = true
+			break
+		}
+	}
+
+	for _, rep := range append([]*modfile.Replace{}, mf.Replace...) {
+		if rep.Old.Path != oldPath && rep.New.Path != oldPath {
+			continue
+		}
+		oldMod, newMod := rep.Old, rep.New
+		if oldMod.Path == oldPath {
+			oldMod.Path = newPath
+		}
+		if newMod.Path == oldPath {
+			newMod.Path = newPath
+		}
+		if err := mf.DropReplace(rep.Old.Path, rep.Old.Version); err != nil {
+			return false, err
+		}
+		if err := mf.AddReplace(oldMod.Path, oldMod.Version, newMod.Path, newMod.Version); err != nil {
+			return false, err
+		}
+		changed = true
+	}
+
+	return changed, nil
+}
+
+// owningModule returns the longest of modPaths that is a prefix of the package path pkgPath,
+// i.e. the module in the tree that provides the package,
+// or the empty string if there is none.
+func owningModule(pkgPath string, modPaths []string) string {
+	var result string
+	for _, p := range modPaths {
+		if (pkgPath == p || strings.HasPrefix(pkgPath, p+"/")) && len(p) > len(result) {
+			result = p
+		}
+	}
+	return result
+}
+
+// isOtherMajorVersion tells whether pkgPath,
+// which has modPath as a prefix,
+// is in a different major version of the module,
+// as "example.com/foo/v2/bar" is for module example.com/foo.
+func isOtherMajorVersion(pkgPath, modPath string) bool {
+	rest, ok := strings.CutPrefix(pkgPath, modPath+"/")
+	if !ok {
+		return false
+	}
+	first, _, _ := strings.Cut(rest, "/")
+	_, pathMajor, ok := module.SplitPathVersion(modPath + "/" + first)
+	return ok && pathMajor != ""
+}
+
+// rewriteModuleImports rewrites the import paths in the Go files of the module in dir.
+// For each import path,
+// rewrite returns a replacement and true,
+// or false to leave the import alone.
+// It returns the paths of the files it changed.
+func rewriteModuleImports(dir string, rewrite func(string) (string, bool)) ([]string, error) {
+	var changed []string
+	err := walkModuleFiles(dir, func(path string, entry fs.DirEntry) error {
+		if !strings.HasSuffix(entry.Name(), ".go") {
+			return nil
+		}
+		ok, err := rewriteFileImports(path, rewrite)
+		if err != nil {
+			return err
+		}
+		if ok {
+			changed = append(changed, path)
+		}
+		return nil
+	})
+	return changed, err
+}
+
+// rewriteFileImports rewrites the import paths in the Go file at path,
+// as in rewriteModuleImports,
+// reporting whether the file changed.
+// Only the import path literals are changed;
+// the rest of the file is left exactly as it was.
+func rewriteFileImports(path string, rewrite func(string) (string, bool)) (bool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return false, errors.Wrapf(err, "reading %s", path)
+	}
+
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, path, data, parser.ImportsOnly)
+	if err != nil {
+		return false, errors.Wrapf(err, "parsing %s", path)
+	}
+
+	type edit struct {
+		start, end int
+		text       string
+	}
+	var edits []edit
+	for _, imp := range file.Imports {
+		importPath, err := strconv.Unquote(imp.Path.Value)
+		if err != nil {
+			return false, errors.Wrapf(err, "unquoting import path %s in %s", imp.Path.Value, path)
+		}
+		newImportPath, ok := rewrite(importPath)
+		if !ok || newImportPath == importPath {
+			continue
+		}
+		edits = append(edits, edit{
+			start: fset.Position(imp.Path.Pos()).Offset,
+			end:   fset.Position(imp.Path.End()).Offset,
+			text:  strconv.Quote(newImportPath),
+		})
+	}
+	if len(edits) == 0 {
+		return false, nil
+	}
+
+	sort.Slice(edits, func(i, j int) bool { return edits[i].start > edits[j].start })
+	for _, e := range edits {
+		data = append(data[:e.start:e.start], append([]byte(e.text), data[e.end:]...)...)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return false, errors.Wrapf(err, "statting %s", path)
+	}
+	return true, errors.Wrapf(os.WriteFile(path, data, info.Mode().Perm()), "writing %s", path)
+}
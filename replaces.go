@@ -0,0 +1,234 @@
+package modules
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/bobg/errors"
+	"golang.org/x/mod/modfile"
+	"golang.org/x/tools/go/packages"
+)
+
+// UnusedReplace describes a replace directive in a go.mod file
+// whose target module is neither required by the module
+// nor provides any package in the module's import graph.
+type UnusedReplace struct {
+	// Dir is the directory containing the go.mod file.
+	Dir string
+
+	// Replace is the unused replace directive.
+	Replace *modfile.Replace
+}
+
+// UnusedReplaces finds the unused replace directives in each Go module in dir and its subdirectories.
+// This function calls Walker.UnusedReplaces with a default Walker.
+func UnusedReplaces(dir string) ([]UnusedReplace, error) {
+	var w Walker
+	return w.UnusedReplaces(dir)
+}
+
+// UnusedReplaces finds the unused replace directives in each Go module in dir and its subdirectories.
+//
+// A replace directive is unused if the module it replaces
+// (at the specific version, if the directive has one)
+// is neither required in the go.mod file
+// nor the source of any package in the module's import graph,
+// as loaded with [Walker.LoadEachGomod]
+// (requesting only package metadata, not types or syntax).
+func (w *Walker) UnusedReplaces(dir string) ([]UnusedReplace, error) {
+	var result []UnusedReplace
+
+	err := w.withLoadMode(metadataLoadMode).LoadEachGomod(dir, func(subdir string, mf *modfile.File, pkgs []*packages.Package) error {
+		used := make(map[string]map[string]bool) // module path -> version -> true
+		use := func(path, version string) {
+			if used[path] == nil {
+				used[path] = make(map[string]bool)
+			}
+			used[path][version] = true
+		}
+
+		for _, req := range mf.Require {
+			use(req.Mod.Path, req.Mod.Version)
+		}
+		packages.Visit(pkgs, nil, func(pkg *packages.Package) {
+			if pkg.Module != nil {
+				use(pkg.Module.Path, pkg.Module.Version)
+			}
+		})
+
+		for _, rep := range mf.Replace {
+			versions := used[rep.Old.Path]
+			if len(versions) > 0 && (rep.Old.Version == "" || versions[rep.Old.Version]) {
+				continue
+			}
+			result = append(result, UnusedReplace{Dir: subdir, Replace: rep})
+		}
+
+		return nil
+	})
+
+	return result, err
+}
+
+// ReplaceProblemKind is the kind of a [ReplaceProblem].
+type ReplaceProblemKind int
+
+const (
+	// ReplaceAbsolute means the replacement is an absolute filesystem path,
+	// which is unlikely to exist on anyone else's machine.
+	ReplaceAbsolute ReplaceProblemKind = iota + 1
+
+	// ReplaceOutsideRepo means the replacement is a directory outside the repository.
+	ReplaceOutsideRepo
+
+	// ReplaceMissingDir means the replacement is a directory that does not exist.
+	ReplaceMissingDir
+)
+
+func (k ReplaceProblemKind) String() string {
+	switch k {
+	case ReplaceAbsolute:
+		return "absolute path"
+	case ReplaceOutsideRepo:
+		return "outside repository"
+	case ReplaceMissingDir:
+		return "missing directory"
+	}
+	return "unknown"
+}
+
+// ReplaceProblem describes a replace directive in a go.mod file
+// that points to a filesystem path that is likely to break builds elsewhere.
+// See [Walker.ReplaceHygiene].
+type ReplaceProblem struct {
+	// Dir is the directory containing the go.mod file.
+	Dir string
+
+	// Replace is the problematic replace directive.
+	Replace *modfile.Replace
+
+	// Kind is the kind of problem.
+	Kind ReplaceProblemKind
+}
+
+// ReplaceHygiene finds problematic filesystem-path replace directives in each Go module in dir and its subdirectories.
+// This function calls Walker.ReplaceHygiene with a default Walker.
+func ReplaceHygiene(dir string) ([]ReplaceProblem, error) {
+	var w Walker
+	return w.ReplaceHygiene(dir)
+}
+
+// ReplaceHygiene finds problematic filesystem-path replace directives in each Go module in dir and its subdirectories:
+// those pointing to absolute paths,
+// to directories outside the repository,
+// or to directories that don't exist.
+// A single directive may have more than one problem,
+// in which case it is reported once for each.
+//
+// The repository is the git repository containing dir,
+// or dir itself if it is not in one.
+// Replace directives whose replacements are module paths are not considered.
+func (w *Walker) ReplaceHygiene(dir string) ([]ReplaceProblem, error) {
+	root, err := repoRoot(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []ReplaceProblem
+	err = w.EachGomod(dir, func(subdir string, mf *modfile.File) error {
+		problems, err := replaceProblems(root, subdir, mf)
+		if err != nil {
+			return err
+		}
+		result = append(result, problems...)
+		return nil
+	})
+	return result, err
+}
+
+// ReplaceChecker returns a [Checker] reporting the problems found by [Walker.ReplaceHygiene],
+// with root as the repository root.
+// Absolute and missing replacement directories are reported as errors,
+// and directories outside the repository as warnings.
+func ReplaceChecker(root string) Checker {
+	return NewChecker("replaces", func(m *Module, _ []*packages.Package) []Finding {
+		absRoot, err := filepath.Abs(root)
+		if err != nil {
+			return []Finding{{Severity: SeverityError, Message: err.Error()}}
+		}
+		problems, err := replaceProblems(absRoot, m.Dir, m.Gomod)
+		if err != nil {
+			return []Finding{{Severity: SeverityError, Message: err.Error()}}
+		}
+		var result []Finding
+		for _, p := range problems {
+			finding := Finding{
+				Severity: SeverityError,
+				Message:  fmt.Sprintf("replace of %s with %s: %s", p.Replace.Old.Path, p.Replace.New.Path, p.Kind),
+			}
+			if p.Kind == ReplaceOutsideRepo {
+				finding.Severity = SeverityWarning
+			}
+			if p.Replace.Syntax != nil {
+				finding.Position = gomodPosition(m.Dir, p.Replace.Syntax.Start)
+			}
+			result = append(result, finding)
+		}
+		return result
+	})
+}
+
+// repoRoot returns the absolute path of the root of the git repository containing dir,
+// or of dir itself if it is not in one.
+func repoRoot(dir string) (string, error) {
+	if root, err := git(dir, "rev-parse", "--show-toplevel"); err == nil {
+		return root, nil
+	}
+	root, err := filepath.Abs(dir)
+	return root, errors.Wrapf(err, "getting absolute path of %s", dir)
+}
+
+// replaceProblems finds the problems with the directory replace directives in mf,
+// the go.mod file of the module in dir,
+// with absolute root as the repository root.
+func replaceProblems(root, dir string, mf *modfile.File) ([]ReplaceProblem, error) {
+	if r, err := filepath.EvalSymlinks(root); err == nil {
+		root = r
+	}
+
+	var result []ReplaceProblem
+	for _, rep := range mf.Replace {
+		if !modfile.IsDirectoryPath(rep.New.Path) {
+			continue
+		}
+		target := filepath.FromSlash(rep.New.Path)
+		if filepath.IsAbs(target) {
+			result = append(result, ReplaceProblem{Dir: dir, Replace: rep, Kind: ReplaceAbsolute})
+		} else {
+			target = filepath.Join(dir, target)
+		}
+		target, err := filepath.Abs(target)
+		if err != nil {
+			return nil, errors.Wrapf(err, "getting absolute path of %s", rep.New.Path)
+		}
+
+		info, err := os.Stat(target)
+		switch {
+		case errors.Is(err, fs.ErrNotExist) || (err == nil && !info.IsDir()):
+			result = append(result, ReplaceProblem{Dir: dir, Replace: rep, Kind: ReplaceMissingDir})
+		case err != nil:
+			return nil, errors.Wrapf(err, "checking %s", target)
+		default:
+			if t, err := filepath.EvalSymlinks(target); err == nil {
+				target = t
+			}
+		}
+
+		if rel, err := filepath.Rel(root, target); err != nil || !filepath.IsLocal(rel) {
+			result = append(result, ReplaceProblem{Dir: dir, Replace: rep, Kind: ReplaceOutsideRepo})
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,152 @@
+package modules
+
+import (
+	"os"
+	"sort"
+
+	"github.com/bobg/errors"
+	"golang.org/x/mod/modfile"
+	"golang.org/x/mod/semver"
+)
+
+// WorkspaceResolution is the version a dependency would resolve to
+// if all the Go modules in a tree were in one workspace.
+// See [Walker.ResolveWorkspace].
+type WorkspaceResolution struct {
+	// Path is the dependency's module path.
+	Path string
+
+	// Version is the version minimal version selection picks for it across the whole workspace.
+	Version string
+
+	// ForcedBy are the directories of the modules in the tree
+	// that select Version on their own,
+	// and so force it on the others.
+	// It is empty if Version emerges only from combining the modules' requirements.
+	ForcedBy []string
+
+	// Versions maps the directory of each module in the tree
+	// that has the dependency in its own build list
+	// to the version it selects on its own.
+	Versions map[string]string
+}
+
+// Changed returns the directories of the modules in the tree
+// whose own selected version of the dependency differs from the workspace's,
+// sorted.
+func (r WorkspaceResolution) Changed() []string {
+	var result []string
+	for dir, v := range r.Versions {
+		if v != r.Version {
+			result = append(result, dir)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+// ResolveWorkspace predicts the dependency versions that minimal version selection would choose
+// if all the Go modules in dir and its subdirectories were used together in one workspace.
+// This function calls Walker.ResolveWorkspace with a default Walker.
+func ResolveWorkspace(dir string) ([]WorkspaceResolution, error) {
+	var w Walker
+	return w.ResolveWorkspace(dir)
+}
+
+// ResolveWorkspace predicts the dependency versions that minimal version selection would choose
+// if all the Go modules in dir and its subdirectories were used together in one workspace
+// (as with a go.work file using each of them),
+// and which modules force each choice.
+//
+// The workspace's build list comes from "go list -m all"
+// with a synthesized go.work file,
+// and each module's own build list from "go list -m all" in the module with GOWORK=off,
+// so the go command does the version selection,
+// consulting the module proxy as needed.
+// Any go.work file already in the tree is ignored.
+//
+// The result has an entry for each dependency in the workspace's build list,
+// excluding the modules of the tree themselves,
+// sorted by Path.
+func (w *Walker) ResolveWorkspace(dir string) ([]WorkspaceResolution, error) {
+	var (
+		dirs      []string
+		goVersion string
+	)
+	err := w.EachGomod(dir, func(subdir string, mf *modfile.File) error {
+		dirs = append(dirs, subdir)
+		if mf.Go != nil && compareGoVersions(mf.Go.Version, goVersion) > 0 {
+			goVersion = mf.Go.Version
+		}
+		return nil
+	})
+	if err != nil || len(dirs) == 0 {
+		return nil, err
+	}
+
+	tmpdir, err := os.MkdirTemp("", "modules")
+	if err != nil {
+		return nil, errors.Wrap(err, "creating temp dir")
+	}
+	defer os.RemoveAll(tmpdir)
+
+	goworkPath, _, err := writeTempGowork(tmpdir, dirs, goVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	// Run go list in workspace mode.
+	// The go command rejects most -mod flags in that mode,
+	// so the environment is adjusted as in LoadAllWorkspace.
+	env := w.loadEnv(w.LoadConfig.Env)
+	if env == nil {
+		env = os.Environ()
+	}
+	ww := *w
+	ww.Env, ww.GOFLAGS, ww.GOWORK = nil, "", ""
+	ww.LoadConfig.Env = append(workspaceEnv(env), "GOWORK="+goworkPath)
+
+	unified, err := ww.listModules(dirs[0], "all")
+	if err != nil {
+		return nil, errors.Wrap(err, "listing workspace build list")
+	}
+
+	var (
+		result []WorkspaceResolution
+		byPath = make(map[string]*WorkspaceResolution)
+	)
+	for _, m := range unified {
+		if m.Main {
+			continue
+		}
+		result = append(result, WorkspaceResolution{Path: m.Path, Version: m.Version, Versions: make(map[string]string)})
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Path < result[j].Path })
+	for i := range result {
+		byPath[result[i].Path] = &result[i]
+	}
+
+	wo := *w
+	wo.GOWORK = "off"
+	for _, subdir := range dirs {
+		own, err := wo.listModules(subdir, "all")
+		if err != nil {
+			return nil, errors.Wrapf(err, "listing build list of %s", subdir)
+		}
+		for _, m := range own {
+			if m.Main {
+				continue
+			}
+			r, ok := byPath[m.Path]
+			if !ok {
+				continue // a module of the tree, replaced locally
+			}
+			r.Versions[subdir] = m.Version
+			if semver.Compare(m.Version, r.Version) == 0 {
+				r.ForcedBy = append(r.ForcedBy, subdir)
+			}
+		}
+	}
+
+	return result, nil
+}
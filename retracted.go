@@ -0,0 +1,159 @@
+package modules
+
+import (
+	"context"
+
+	"github.com/bobg/errors"
+	"golang.org/x/mod/modfile"
+	"golang.org/x/tools/go/packages"
+)
+
+// RetractedRequire is a require directive for a module version
+// that the module's author has retracted.
+// See [Walker.RetractedEach].
+type RetractedRequire struct {
+	// Dir is the directory of the requiring module.
+	Dir string
+
+	// Path and Version are the required module path and version.
+	// For a require that is replaced with another module version,
+	// these identify the replacement.
+	Path, Version string
+
+	// Indirect tells whether the require directive is marked "// indirect".
+	Indirect bool
+
+	// Rationale contains the retraction rationales
+	// from the retract directives in the module's latest go.mod file.
+	// An entry may be empty if the author gave no rationale.
+	Rationale []string
+
+	// Pos is the position of the require directive in the go.mod file.
+	Pos modfile.Position
+}
+
+// RetractedEach finds requires of retracted module versions
+// in each Go module in dir and its subdirectories.
+// This function calls Walker.RetractedEach with a default Walker.
+func RetractedEach(ctx context.Context, dir string) ([]RetractedRequire, error) {
+	var w Walker
+	return w.RetractedEach(ctx, dir)
+}
+
+// RetractedEach finds requires of retracted module versions
+// in each Go module in dir and its subdirectories,
+// in the order [Walker.Each] visits the modules
+// and then in go.mod order.
+//
+// Retractions are found with "go list -m -retracted",
+// which queries the module proxy given by GOPROXY
+// (see [Walker.Env])
+// for each required module's latest go.mod file.
+// Requires that are replaced with a local directory are skipped,
+// as are those the proxy cannot resolve,
+// such as requires of other modules in the tree.
+// Each module is queried outside of any workspace.
+func (w *Walker) RetractedEach(ctx context.Context, dir string) ([]RetractedRequire, error) {
+	w2 := *w
+	w2.GOWORK = "off"
+
+	var result []RetractedRequire
+	err := w.EachGomod(dir, func(subdir string, mf *modfile.File) error {
+		reqs, err := w2.retractedRequires(ctx, subdir, mf)
+		if err != nil {
+			return errors.Wrapf(err, "checking %s", subdir)
+		}
+		result = append(result, reqs...)
+		return nil
+	})
+	return result, err
+}
+
+// RetractedChecker returns a [Checker] reporting the requires found by [Walker.RetractedEach]
+// as errors,
+// positioned at the require directives.
+// The context is used when querying the module proxy.
+func (w *Walker) RetractedChecker(ctx context.Context) Checker {
+	w2 := *w
+	w2.GOWORK = "off"
+
+	return NewChecker("retracted", func(m *Module, _ []*packages.Package) []Finding {
+		reqs, err := w2.retractedRequires(ctx, m.Dir, m.Gomod)
+		if err != nil {
+			return []Finding{{Severity: SeverityError, Message: err.Error()}}
+		}
+		var result []Finding
+		for _, r := range reqs {
+			result = append(result, Finding{
+				Severity: SeverityError,
+				Position: gomodPosition(m.Dir, r.Pos),
+				Message:  retractedMessage(r),
+			})
+		}
+		return result
+	})
+}
+
+func retractedMessage(r RetractedRequire) string {
+	msg := r.Path + "@" + r.Version + " is retracted"
+	for _, rationale := range r.Rationale {
+		if rationale != "" {
+			msg += ": " + rationale
+			break
+		}
+	}
+	return msg
+}
+
+func (w *Walker) retractedRequires(ctx context.Context, dir string, mf *modfile.File) ([]RetractedRequire, error) {
+	var (
+		reqs []RetractedRequire
+		args = []string{"list", "-m", "-e", "-retracted", "-json"}
+	)
+	for _, req := range mf.Require {
+		r := RetractedRequire{
+			Dir:      dir,
+			Path:     req.Mod.Path,
+			Version:  req.Mod.Version,
+			Indirect: req.Indirect,
+		}
+		if rep := findReplace(mf, req.Mod.Path, req.Mod.Version); rep != nil {
+			if modfile.IsDirectoryPath(rep.New.Path) {
+				continue
+			}
+			r.Path, r.Version = rep.New.Path, rep.New.Version
+		}
+		if req.Syntax != nil {
+			r.Pos = req.Syntax.Start
+		}
+		reqs = append(reqs, r)
+		args = append(args, r.Path+"@"+r.Version)
+	}
+	if len(reqs) == 0 {
+		return nil, nil
+	}
+
+	out, err := w.goCmdContext(ctx, dir, args...)
+	if err != nil {
+		return nil, err
+	}
+	listed, err := decodeListedModules(out)
+	if err != nil {
+		return nil, err
+	}
+	retracted := make(map[[2]string][]string)
+	for _, m := range listed {
+		if m.Error == nil && len(m.Retracted) > 0 {
+			retracted[[2]string{m.Path, m.Version}] = m.Retracted
+		}
+	}
+
+	var result []RetractedRequire
+	for _, r := range reqs {
+		if rationale, ok := retracted[[2]string{r.Path, r.Version}]; ok {
+			r.Rationale = rationale
+			result = append(result, r)
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,481 @@
+package modules
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bobg/errors"
+	"golang.org/x/tools/go/packages"
+)
+
+// SBOMComponent is a Go module in a software bill of materials.
+type SBOMComponent struct {
+	// Path and Version are the module's path and version.
+	// Version is empty for a module built from local source,
+	// such as the main module.
+	Path, Version string
+
+	// Replace, if non-empty,
+	// is what the module is replaced with:
+	// "path@version" for another module version,
+	// or the directory of a local replacement.
+	Replace string
+
+	// Sum is the module's hash from go.sum,
+	// such as "h1:...",
+	// or the empty string if there is none
+	// (as for local modules).
+	Sum string
+
+	// Packages are the import paths of the module's packages that are actually built,
+	// sorted.
+	Packages []string
+}
+
+// Ref returns the package URL (purl) identifying c,
+// such as "pkg:golang/golang.org/x/mod@v0.14.0".
+func (c SBOMComponent) Ref() string {
+	ref := "pkg:golang/" + c.Path
+	if c.Version != "" {
+		ref += "@" + strings.ReplaceAll(c.Version, "+", "%2B")
+	}
+	return ref
+}
+
+// SBOM is a software bill of materials for one or more Go modules:
+// the modules whose packages they actually build,
+// and the dependencies among them.
+// See [Walker.SBOMEach].
+type SBOM struct {
+	// Name names the SBOM's subject:
+	// a module path,
+	// or for an aggregate SBOM,
+	// the tree's directory.
+	Name string
+
+	// Created is when the SBOM was produced.
+	Created time.Time
+
+	// Roots are the modules the SBOM describes.
+	Roots []SBOMComponent
+
+	// Components are their dependencies,
+	// sorted by path and version.
+	Components []SBOMComponent
+
+	// Dependencies maps the [SBOMComponent.Ref] of each root or component
+	// to the sorted refs of the components whose packages it imports.
+	Dependencies map[string][]string
+}
+
+// SBOMEach produces a software bill of materials for each Go module in dir and its subdirectories,
+// and an aggregate one for the whole tree.
+// This function calls Walker.SBOMEach with a default Walker.
+func SBOMEach(dir string, f func(string, *SBOM) error) (*SBOM, error) {
+	var w Walker
+	return w.SBOMEach(dir, f)
+}
+
+// SBOMEach produces a software bill of materials for each Go module in dir and its subdirectories,
+// passing the module's directory
+// (which will have dir as a prefix)
+// and its SBOM to the callback,
+// and returns an aggregate SBOM for the whole tree,
+// whose roots are all the modules.
+// Write an SBOM out with [SBOM.WriteSPDX] or [SBOM.WriteCycloneDX].
+//
+// Components are found from the packages that [Walker.LoadEach] would load
+// and their transitive imports,
+// so only modules that actually provide built packages are included,
+// not everything in go.mod.
+// Hashes come from each module's go.sum file.
+// Other modules in the tree that a module depends on
+// (via local replace directives or a go.work file)
+// appear as components with no version.
+func (w *Walker) SBOMEach(dir string, f func(string, *SBOM) error) (*SBOM, error) {
+	created := time.Now().UTC().Truncate(time.Second)
+	agg := &SBOM{Name: dir, Created: created, Dependencies: make(map[string][]string)}
+	aggComponents := make(map[string]SBOMComponent)
+
+	err := w.withLoadMode(metadataLoadMode).LoadEach(dir, func(subdir string, pkgs []*packages.Package) error {
+		gosum, err := readGosum(subdir)
+		if err != nil {
+			return err
+		}
+		_, mf, err := w.readGomod(subdir)
+		if err != nil {
+			return err
+		}
+		var modPath string
+		if mf.Module != nil {
+			modPath = mf.Module.Mod.Path
+		}
+
+		sbom := buildSBOM(modPath, pkgs, gosum)
+		sbom.Created = created
+
+		agg.Roots = append(agg.Roots, sbom.Roots...)
+		for _, c := range sbom.Components {
+			ref := c.Ref()
+			if prev, ok := aggComponents[ref]; ok {
+				c.Packages = mergeSorted(prev.Packages, c.Packages)
+				if c.Sum == "" {
+					c.Sum = prev.Sum
+				}
+			}
+			aggComponents[ref] = c
+		}
+		for ref, deps := range sbom.Dependencies {
+			agg.Dependencies[ref] = mergeSorted(agg.Dependencies[ref], deps)
+		}
+
+		return f(subdir, sbom)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// A module in the tree is a root of the aggregate,
+	// not a component of it.
+	for _, r := range agg.Roots {
+		delete(aggComponents, r.Ref())
+	}
+	for _, c := range aggComponents {
+		agg.Components = append(agg.Components, c)
+	}
+	sortComponents(agg.Components)
+	return agg, nil
+}
+
+// buildSBOM produces the SBOM for the main module with path modPath,
+// given its loaded packages and the contents of its go.sum file.
+func buildSBOM(modPath string, pkgs []*packages.Package, gosum map[string]string) *SBOM {
+	var (
+		root       = SBOMComponent{Path: modPath}
+		components = make(map[string]*SBOMComponent)
+		deps       = make(map[string]map[string]bool)
+		seenPkgs   = make(map[string]bool)
+	)
+
+	component := func(m *packages.Module) *SBOMComponent {
+		if m.Path == modPath {
+			return &root
+		}
+		c := SBOMComponent{Path: m.Path}
+		if !m.Main {
+			c.Version = m.Version
+		}
+		mod, version := m.Path, m.Version
+		if r := m.Replace; r != nil {
+			if r.Version == "" {
+				c.Replace = r.Path
+			} else {
+				c.Replace = r.Path + "@" + r.Version
+			}
+			mod, version = r.Path, r.Version
+		}
+		if version != "" {
+			c.Sum = gosum[mod+" "+version]
+		}
+		ref := c.Ref()
+		if existing, ok := components[ref]; ok {
+			return existing
+		}
+		components[ref] = &c
+		return &c
+	}
+
+	packages.Visit(pkgs, nil, func(pkg *packages.Package) {
+		if pkg.Module == nil || isTestVariant(pkg) || seenPkgs[pkg.PkgPath] {
+			return
+		}
+		seenPkgs[pkg.PkgPath] = true
+		c := component(pkg.Module)
+		c.Packages = append(c.Packages, pkg.PkgPath)
+
+		ref := c.Ref()
+		for _, imp := range pkg.Imports {
+			if imp.Module == nil {
+				continue
+			}
+			impRef := component(imp.Module).Ref()
+			if impRef == ref {
+				continue
+			}
+			if deps[ref] == nil {
+				deps[ref] = make(map[string]bool)
+			}
+			deps[ref][impRef] = true
+		}
+	})
+
+	sort.Strings(root.Packages)
+	result := &SBOM{
+		Name:         modPath,
+		Roots:        []SBOMComponent{root},
+		Dependencies: make(map[string][]string),
+	}
+	for _, c := range components {
+		sort.Strings(c.Packages)
+		result.Components = append(result.Components, *c)
+	}
+	sortComponents(result.Components)
+	for ref, m := range deps {
+		for dep := range m {
+			result.Dependencies[ref] = append(result.Dependencies[ref], dep)
+		}
+		sort.Strings(result.Dependencies[ref])
+	}
+	return result
+}
+
+func sortComponents(components []SBOMComponent) {
+	sort.Slice(components, func(i, j int) bool {
+		if components[i].Path != components[j].Path {
+			return components[i].Path < components[j].Path
+		}
+		return components[i].Version < components[j].Version
+	})
+}
+
+// mergeSorted returns the sorted union of a and b,
+// which must be sorted.
+func mergeSorted(a, b []string) []string {
+	result := make([]string, 0, len(a)+len(b))
+	for len(a) > 0 || len(b) > 0 {
+		switch {
+		case len(b) == 0 || (len(a) > 0 && a[0] < b[0]):
+			result = append(result, a[0])
+			a = a[1:]
+		case len(a) == 0 || b[0] < a[0]:
+			result = append(result, b[0])
+			b = b[1:]
+		default:
+			result = append(result, a[0])
+			a, b = a[1:], b[1:]
+		}
+	}
+	return result
+}
+
+// sbomTool identifies this package as the creator of SBOMs.
+const sbomTool = "github.com/bobg/modules"
+
+// sbomSumProperty is the name of the CycloneDX property holding a component's go.sum hash.
+// The hash is not of any artifact,
+// so it does not belong among the component's hashes.
+const sbomSumProperty = "golang:sum"
+
+// WriteSPDX writes s to out as an SPDX 2.3 JSON document.
+func (s *SBOM) WriteSPDX(out io.Writer) error {
+	type (
+		externalRef struct {
+			Category string `json:"referenceCategory"`
+			Type     string `json:"referenceType"`
+			Locator  string `json:"referenceLocator"`
+		}
+		pkg struct {
+			Name             string        `json:"name"`
+			SPDXID           string        `json:"SPDXID"`
+			VersionInfo      string        `json:"versionInfo,omitempty"`
+			DownloadLocation string        `json:"downloadLocation"`
+			FilesAnalyzed    bool          `json:"filesAnalyzed"`
+			LicenseConcluded string        `json:"licenseConcluded"`
+			LicenseDeclared  string        `json:"licenseDeclared"`
+			CopyrightText    string        `json:"copyrightText"`
+			Comment          string        `json:"comment,omitempty"`
+			ExternalRefs     []externalRef `json:"externalRefs"`
+		}
+		relationship struct {
+			Element string `json:"spdxElementId"`
+			Type    string `json:"relationshipType"`
+			Related string `json:"relatedSpdxElement"`
+		}
+		creationInfo struct {
+			Created  string   `json:"created"`
+			Creators []string `json:"creators"`
+		}
+		document struct {
+			SPDXVersion       string         `json:"spdxVersion"`
+			DataLicense       string         `json:"dataLicense"`
+			SPDXID            string         `json:"SPDXID"`
+			Name              string         `json:"name"`
+			DocumentNamespace string         `json:"documentNamespace"`
+			CreationInfo      creationInfo   `json:"creationInfo"`
+			Packages          []pkg          `json:"packages"`
+			Relationships     []relationship `json:"relationships"`
+		}
+	)
+
+	ids := make(map[string]string) // ref -> SPDX ID
+	doc := document{
+		SPDXVersion: "SPDX-2.3",
+		DataLicense: "CC0-1.0",
+		SPDXID:      "SPDXRef-DOCUMENT",
+		Name:        s.Name,
+		CreationInfo: creationInfo{
+			Created:  s.Created.UTC().Format(time.RFC3339),
+			Creators: []string{"Tool: " + sbomTool},
+		},
+	}
+	add := func(c SBOMComponent) {
+		ref := c.Ref()
+		if _, ok := ids[ref]; ok {
+			return
+		}
+		id := fmt.Sprintf("SPDXRef-Package-%d", len(ids)+1)
+		ids[ref] = id
+		p := pkg{
+			Name:             c.Path,
+			SPDXID:           id,
+			VersionInfo:      c.Version,
+			DownloadLocation: "NOASSERTION",
+			LicenseConcluded: "NOASSERTION",
+			LicenseDeclared:  "NOASSERTION",
+			CopyrightText:    "NOASSERTION",
+			ExternalRefs:     []externalRef{{Category: "PACKAGE-MANAGER", Type: "purl", Locator: ref}},
+		}
+		if c.Sum != "" {
+			p.Comment = "go.sum: " + c.Sum
+		}
+		doc.Packages = append(doc.Packages, p)
+	}
+	for _, r := range s.Roots {
+		add(r)
+		doc.Relationships = append(doc.Relationships, relationship{Element: doc.SPDXID, Type: "DESCRIBES", Related: ids[r.Ref()]})
+	}
+	for _, c := range s.Components {
+		add(c)
+	}
+	for _, ref := range sortedKeys(s.Dependencies) {
+		for _, dep := range s.Dependencies[ref] {
+			if ids[ref] != "" && ids[dep] != "" {
+				doc.Relationships = append(doc.Relationships, relationship{Element: ids[ref], Type: "DEPENDS_ON", Related: ids[dep]})
+			}
+		}
+	}
+	doc.DocumentNamespace = "https://spdx.org/spdxdocs/" + sbomDigest(s)
+
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	return errors.Wrap(enc.Encode(doc), "encoding SPDX document")
+}
+
+// WriteCycloneDX writes s to out as a CycloneDX 1.5 JSON document.
+// An SBOM with a single root describes that module as the document's subject;
+// otherwise the roots are listed among the components.
+func (s *SBOM) WriteCycloneDX(out io.Writer) error {
+	type (
+		property struct {
+			Name  string `json:"name"`
+			Value string `json:"value"`
+		}
+		component struct {
+			Type       string     `json:"type"`
+			BOMRef     string     `json:"bom-ref"`
+			Name       string     `json:"name"`
+			Version    string     `json:"version,omitempty"`
+			PURL       string     `json:"purl"`
+			Properties []property `json:"properties,omitempty"`
+		}
+		tool struct {
+			Type string `json:"type"`
+			Name string `json:"name"`
+		}
+		metadata struct {
+			Timestamp string `json:"timestamp"`
+			Tools     struct {
+				Components []tool `json:"components"`
+			} `json:"tools"`
+			Component *component `json:"component,omitempty"`
+		}
+		dependency struct {
+			Ref       string   `json:"ref"`
+			DependsOn []string `json:"dependsOn"`
+		}
+		document struct {
+			BOMFormat    string       `json:"bomFormat"`
+			SpecVersion  string       `json:"specVersion"`
+			SerialNumber string       `json:"serialNumber"`
+			Version      int          `json:"version"`
+			Metadata     metadata     `json:"metadata"`
+			Components   []component  `json:"components"`
+			Dependencies []dependency `json:"dependencies"`
+		}
+	)
+
+	convert := func(c SBOMComponent, typ string) component {
+		result := component{
+			Type:    typ,
+			BOMRef:  c.Ref(),
+			Name:    c.Path,
+			Version: c.Version,
+			PURL:    c.Ref(),
+		}
+		if c.Sum != "" {
+			result.Properties = append(result.Properties, property{Name: sbomSumProperty, Value: c.Sum})
+		}
+		return result
+	}
+
+	// The serial number is a name-based (version 5 style) UUID derived from the contents.
+	uuid, _ := hex.DecodeString(sbomDigest(s)[:32])
+	uuid[6] = (uuid[6] & 0x0f) | 0x50
+	uuid[8] = (uuid[8] & 0x3f) | 0x80
+	u := hex.EncodeToString(uuid)
+
+	doc := document{
+		BOMFormat:    "CycloneDX",
+		SpecVersion:  "1.5",
+		SerialNumber: "urn:uuid:" + u[0:8] + "-" + u[8:12] + "-" + u[12:16] + "-" + u[16:20] + "-" + u[20:32],
+		Version:      1,
+		Components:   []component{},
+		Dependencies: []dependency{},
+	}
+	doc.Metadata.Timestamp = s.Created.UTC().Format(time.RFC3339)
+	doc.Metadata.Tools.Components = []tool{{Type: "application", Name: sbomTool}}
+	if len(s.Roots) == 1 {
+		root := convert(s.Roots[0], "application")
+		doc.Metadata.Component = &root
+	} else {
+		for _, r := range s.Roots {
+			doc.Components = append(doc.Components, convert(r, "application"))
+		}
+	}
+	for _, c := range s.Components {
+		doc.Components = append(doc.Components, convert(c, "library"))
+	}
+	for _, ref := range sortedKeys(s.Dependencies) {
+		doc.Dependencies = append(doc.Dependencies, dependency{Ref: ref, DependsOn: s.Dependencies[ref]})
+	}
+
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	return errors.Wrap(enc.Encode(doc), "encoding CycloneDX document")
+}
+
+// sbomDigest returns a hex digest of the contents of s,
+// for use in the unique identifiers that SBOM formats require.
+func sbomDigest(s *SBOM) string {
+	h := sha256.New()
+	fmt.Fprintln(h, s.Name, s.Created.Unix())
+	for _, c := range append(append([]SBOMComponent{}, s.Roots...), s.Components...) {
+		fmt.Fprintln(h, c.Ref(), c.Replace, c.Sum)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,172 @@
+package modules
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/bobg/errors"
+	"golang.org/x/mod/modfile"
+	"golang.org/x/mod/module"
+)
+
+// NewModuleOptions are options for [Walker.NewModule].
+type NewModuleOptions struct {
+	// GoVersion is the version for the new module's go directive.
+	// The default is the highest go directive among the existing modules in the tree,
+	// or the language version of the Go release that built the running program if there are none.
+	GoVersion string
+
+	// Consumers are the directories of existing modules in the tree,
+	// relative to the tree's root,
+	// that will import the new module.
+	// Each gets a require directive for it
+	// and a replace directive pointing to its directory.
+	Consumers []string
+}
+
+// localRequireVersion is the version used in requires of modules that are only available via a local replace.
+// It is the version the go command itself uses for this purpose.
+const localRequireVersion = "v0.0.0-00010101000000-000000000000"
+
+// NewModule creates a new Go module in a tree of modules.
+// This function calls Walker.NewModule with a default Walker.
+func NewModule(treeDir, relDir, modulePath string, opts NewModuleOptions) error {
+	var w Walker
+	return w.NewModule(treeDir, relDir, modulePath, opts)
+}
+
+// NewModule creates a new Go module in a tree of modules
+// whose root is treeDir.
+// The new module has the given module path
+// and is in the directory relDir,
+// relative to treeDir,
+// which is created if necessary.
+// It is an error if relDir already contains a go.mod file.
+//
+// The new module's go.mod file has a module directive and a go directive
+// (see [NewModuleOptions]).
+// If treeDir contains a go.work file,
+// a use directive for the new module is added to it.
+// Modules listed in opts.Consumers get require and replace directives for the new module.
+func (w *Walker) NewModule(treeDir, relDir, modulePath string, opts NewModuleOptions) error {
+	w = w.forEdit()
+
+	if err := module.CheckPath(modulePath); err != nil {
+		return errors.Wrapf(err, "checking module path %s", modulePath)
+	}
+	if !filepath.IsLocal(relDir) {
+		return fmt.Errorf("directory %s is not within %s", relDir, treeDir)
+	}
+
+	dir := filepath.Join(treeDir, relDir)
+	if _, err := os.Stat(filepath.Join(dir, "go.mod")); err == nil {
+		return fmt.Errorf("%s already contains a go.mod file", dir)
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return errors.Wrapf(err, "statting %s", filepath.Join(dir, "go.mod"))
+	}
+
+	goVersion := opts.GoVersion
+	if goVersion == "" {
+		err := w.EachGomod(treeDir, func(_ string, mf *modfile.File) error {
+			if mf.Go != nil && compareGoVersions(mf.Go.Version, goVersion) > 0 {
+				goVersion = mf.Go.Version
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if goVersion == "" {
+		goVersion = toolchainGoVersion()
+	}
+
+	// Read the go.mod files to update before making any changes,
+	// so a problem with one doesn't leave the tree half-modified.
+	consumers := make([]*modfile.File, 0, len(opts.Consumers))
+	for _, c := range opts.Consumers {
+		_, mf, err := w.readGomod(filepath.Join(treeDir, c))
+		if err != nil {
+			return err
+		}
+		consumers = append(consumers, mf)
+	}
+	wf, err := w.readGowork(treeDir)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return errors.Wrapf(err, "creating %s", dir)
+	}
+	mf := new(modfile.File)
+	if err := mf.AddModuleStmt(modulePath); err != nil {
+		return errors.Wrap(err, "adding module directive")
+	}
+	if err := mf.AddGoStmt(goVersion); err != nil {
+		return errors.Wrap(err, "adding go directive")
+	}
+	if err := w.writeGomod(dir, mf); err != nil {
+		return err
+	}
+
+	if wf != nil {
+		if err := wf.AddUse(relativeModPath(treeDir, dir), ""); err != nil {
+			return errors.Wrap(err, "adding use directive")
+		}
+		if err := writeGowork(treeDir, wf); err != nil {
+			return err
+		}
+	}
+
+	for i, c := range opts.Consumers {
+		cdir := filepath.Join(treeDir, c)
+		mf := consumers[i]
+		if err := mf.AddRequire(modulePath, localRequireVersion); err != nil {
+			return errors.Wrapf(err, "adding require to %s", cdir)
+		}
+		if err := mf.AddReplace(modulePath, "", relativeModPath(cdir, dir), ""); err != nil {
+			return errors.Wrapf(err, "adding replace to %s", cdir)
+		}
+		if err := w.writeGomod(cdir, mf); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// relativeModPath returns the path of target relative to dir,
+// in the form used in replace and use directives:
+// slash-separated and beginning with . or ..
+func relativeModPath(dir, target string) string {
+	rel, err := filepath.Rel(dir, target)
+	if err != nil {
+		return filepath.ToSlash(target)
+	}
+	rel = filepath.ToSlash(rel)
+	if rel == "." || rel == ".." || strings.HasPrefix(rel, "../") {
+		return rel
+	}
+	return "./" + rel
+}
+
+// toolchainGoVersion returns the language version of the Go release that built the running program,
+// such as "1.21",
+// for use in a go directive.
+func toolchainGoVersion() string {
+	v := strings.TrimPrefix(runtime.Version(), "go")
+	parts := strings.SplitN(v, ".", 3)
+	if len(parts) < 2 {
+		return "1.20" // A development toolchain.
+	}
+	minor := parts[1]
+	if i := strings.IndexFunc(minor, func(r rune) bool { return r < '0' || r > '9' }); i >= 0 {
+		minor = minor[:i] // As in "go1.21rc2".
+	}
+	return parts[0] + "." + minor
+}
@@ -0,0 +1,123 @@
+package modules
+
+import (
+	"context"
+	"log/slog"
+	"path/filepath"
+
+	"github.com/bobg/errors"
+	"golang.org/x/sync/errgroup"
+)
+
+// scanNode is a directory scanned by [Walker.eachParallel].
+// Its other fields are valid once done is closed.
+type scanNode struct {
+	dir  string
+	done chan struct{}
+
+	revisit  bool  // already visited via a link
+	found    bool  // contains the file being sought
+	statErr  error // error checking for the file
+	readErr  error // error reading the directory
+	children []*scanNode
+}
+
+// eachParallel is like [Walker.each]
+// but scans directories with up to w.ScanConcurrency goroutines.
+// Calls to f are still made one at a time,
+// in the same order as [Walker.each] makes them.
+func (w *Walker) eachParallel(ws *walkState, dir, filename string, f func(string) error) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var g errgroup.Group
+	g.SetLimit(w.ScanConcurrency)
+
+	root := w.scan(ctx, &g, ws, dir, filename)
+	err := w.visitScanned(root, filename, f)
+
+	cancel()
+	_ = g.Wait() // Scan tasks record their errors in their nodes.
+	return err
+}
+
+// scan starts scanning dir and,
+// recursively,
+// the subdirectories w walks into.
+// The scan runs in a new goroutine if g has room for one,
+// and otherwise in this one.
+func (w *Walker) scan(ctx context.Context, g *errgroup.Group, ws *walkState, dir, filename string) *scanNode {
+	n := &scanNode{dir: dir, done: make(chan struct{})}
+
+	task := func() error {
+		defer close(n.done)
+
+		if ctx.Err() != nil {
+			return nil // Nobody is waiting for the result.
+		}
+
+		first, err := ws.firstVisit(dir)
+		if err != nil {
+			n.statErr = WalkError{Dir: dir, Op: "visiting", Err: err}
+			return nil
+		}
+		if !first {
+			n.revisit = true
+			return nil
+		}
+		w.log(LevelTrace, "scanning directory", "dir", dir)
+
+		found, entries, err := w.subdirs(ws, dir, filename)
+		if err != nil {
+			n.readErr = WalkError{Dir: dir, Op: "reading directory", Err: err}
+			n.found, n.statErr = hasFile(dir, filename)
+			return nil
+		}
+		n.found = found
+		for _, entry := range entries {
+			n.children = append(n.children, w.scan(ctx, g, ws, filepath.Join(dir, entry.Name()), filename))
+		}
+		return nil
+	}
+
+	if !g.TryGo(task) {
+		_ = task()
+	}
+	return n
+}
+
+// visitScanned calls f for n and its descendants that contain the file being sought,
+// waiting for each to be scanned,
+// and handling errors from f as [Walker.each] does.
+func (w *Walker) visitScanned(n *scanNode, filename string, f func(string) error) error {
+	<-n.done
+
+	if n.statErr != nil {
+		return n.statErr
+	}
+	if n.revisit {
+		w.logRevisit(n.dir)
+		return nil
+	}
+	if n.found {
+		w.log(slog.LevelDebug, "found "+filename, "dir", n.dir)
+		err := f(n.dir)
+		switch {
+		case errors.Is(err, filepath.SkipDir):
+			return nil
+		case errors.Is(err, filepath.SkipAll):
+			return err // Filtered out in Walker.eachFile.
+		case err != nil:
+			return visitError(n.dir, err)
+		}
+	}
+	if n.readErr != nil {
+		return n.readErr
+	}
+	for _, child := range n.children {
+		if err := w.visitScanned(child, filename, f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
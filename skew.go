@@ -0,0 +1,191 @@
+package modules
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/mod/modfile"
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/semver"
+)
+
+// SkewKind is the kind of a [DependencySkew].
+type SkewKind int
+
+const (
+	// SkewMajor means different major versions of the dependency are required.
+	SkewMajor SkewKind = iota + 1
+
+	// SkewMinor means versions of the dependency with the same major version
+	// but widely different minor versions are required.
+	SkewMinor
+)
+
+func (k SkewKind) String() string {
+	switch k {
+	case SkewMajor:
+		return "major"
+	case SkewMinor:
+		return "minor"
+	}
+	return "unknown"
+}
+
+// SkewOptions are options for [Walker.DependencySkews].
+type SkewOptions struct {
+	// MinorSpread, if positive,
+	// is the difference between the highest and lowest minor versions
+	// (within a single major version)
+	// at which a dependency is reported as a [SkewMinor].
+	// If it is zero,
+	// only major-version skew is reported.
+	MinorSpread int
+}
+
+// SkewRequire is a require directive involved in a [DependencySkew].
+type SkewRequire struct {
+	// Dir is the directory of the module with the require directive.
+	Dir string
+
+	// Path and Version are the required module path and version.
+	Path, Version string
+
+	// Indirect tells whether the require directive is marked "// indirect".
+	Indirect bool
+}
+
+// DependencySkew is a dependency required at inconsistent versions
+// by the modules in a tree.
+// See [Walker.DependencySkews].
+type DependencySkew struct {
+	// Family is the dependency's module path without any major-version suffix,
+	// such as "github.com/foo/bar" for both github.com/foo/bar and github.com/foo/bar/v2.
+	Family string
+
+	// Kind is the kind of skew.
+	Kind SkewKind
+
+	// Requires are the require directives for the family
+	// (for the offending major version, if Kind is SkewMinor),
+	// sorted by version and then by directory.
+	Requires []SkewRequire
+}
+
+// DependencySkews finds dependencies that the Go modules in dir and its subdirectories
+// require at inconsistent versions.
+// This function calls Walker.DependencySkews with a default Walker.
+func DependencySkews(dir string, opts SkewOptions) ([]DependencySkew, error) {
+	var w Walker
+	return w.DependencySkews(dir, opts)
+}
+
+// DependencySkews finds dependencies that the Go modules in dir and its subdirectories
+// require at inconsistent versions,
+// according to their go.mod files.
+//
+// A dependency "family" is the set of major versions of a module,
+// such as github.com/foo/bar and github.com/foo/bar/v2.
+// A family has major-version skew if the tree requires more than one of its major versions,
+// whether in different modules or in the same one.
+// Within one major version,
+// it has minor-version skew if the required minor versions differ by opts.MinorSpread or more.
+// Both kinds may be reported for the same family.
+//
+// Requires of modules that are themselves in the tree are not considered.
+// The result is sorted by family,
+// with major-version skew before minor-version skew.
+func (w *Walker) DependencySkews(dir string, opts SkewOptions) ([]DependencySkew, error) {
+	var (
+		treePaths = make(map[string]bool)
+		families  = make(map[string][]SkewRequire)
+	)
+	err := w.EachGomod(dir, func(subdir string, mf *modfile.File) error {
+		if mf.Module != nil {
+			treePaths[mf.Module.Mod.Path] = true
+		}
+		for _, req := range mf.Require {
+			family, _, ok := module.SplitPathVersion(req.Mod.Path)
+			if !ok {
+				family = req.Mod.Path
+			}
+			families[family] = append(families[family], SkewRequire{
+				Dir:      subdir,
+				Path:     req.Mod.Path,
+				Version:  req.Mod.Version,
+				Indirect: req.Indirect,
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var result []DependencySkew
+	for family, reqs := range families {
+		var filtered []SkewRequire
+		for _, r := range reqs {
+			if !treePaths[r.Path] {
+				filtered = append(filtered, r)
+			}
+		}
+		if len(filtered) < 2 {
+			continue
+		}
+		sort.Slice(filtered, func(i, j int) bool {
+			if c := semver.Compare(filtered[i].Version, filtered[j].Version); c != 0 {
+				return c < 0
+			}
+			return filtered[i].Dir < filtered[j].Dir
+		})
+
+		byMajor := make(map[string][]SkewRequire)
+		var majors []string
+		for _, r := range filtered {
+			major := semver.Major(r.Version)
+			if _, ok := byMajor[major]; !ok {
+				majors = append(majors, major)
+			}
+			byMajor[major] = append(byMajor[major], r)
+		}
+		if len(majors) > 1 {
+			result = append(result, DependencySkew{Family: family, Kind: SkewMajor, Requires: filtered})
+		}
+
+		if opts.MinorSpread <= 0 {
+			continue
+		}
+		for _, major := range majors {
+			group := byMajor[major]
+			lo, hi := minorVersion(group[0].Version), minorVersion(group[len(group)-1].Version)
+			if hi-lo >= opts.MinorSpread {
+				result = append(result, DependencySkew{Family: family, Kind: SkewMinor, Requires: group})
+			}
+		}
+	}
+
+	sort.SliceStable(result, func(i, j int) bool {
+		if result[i].Family != result[j].Family {
+			return result[i].Family < result[j].Family
+		}
+		if result[i].Kind != result[j].Kind {
+			return result[i].Kind < result[j].Kind
+		}
+		return semver.Compare(result[i].Requires[0].Version, result[j].Requires[0].Version) < 0
+	})
+	return result, nil
+}
+
+// minorVersion returns the minor version number of a semantic version,
+// such as 3 for "v1.3.5",
+// or 0 if it cannot be determined.
+func minorVersion(v string) int {
+	mm := semver.MajorMinor(v)
+	_, minor, ok := strings.Cut(mm, ".")
+	if !ok {
+		return 0
+	}
+	n, _ := strconv.Atoi(minor)
+	return n
+}
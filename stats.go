@@ -0,0 +1,135 @@
+package modules
+
+import (
+	"bytes"
+	"io/fs"
+	"os"
+	"strings"
+
+	"github.com/bobg/errors"
+	"golang.org/x/tools/go/packages"
+)
+
+// Stats holds statistics about a single Go module.
+type Stats struct {
+	// Dir is the directory containing the module's go.mod file.
+	Dir string
+
+	// Packages is the number of packages in the module.
+	Packages int
+
+	// GoFiles is the number of non-test Go files in the module's packages.
+	GoFiles int
+
+	// TestFiles is the number of _test.go files in the module.
+	TestFiles int
+
+	// Lines is the total number of lines in the files counted by GoFiles.
+	Lines int
+
+	// TestLines is the total number of lines in the files counted by TestFiles.
+	TestLines int
+
+	// Deps is the number of distinct other modules that the module's packages depend on,
+	// directly or indirectly.
+	Deps int
+
+	// EmbedFiles is the number of files embedded with //go:embed directives in the module's packages.
+	EmbedFiles int
+}
+
+// ModuleStats computes statistics for each Go module in dir and its subdirectories.
+// This function calls Walker.ModuleStats with a default Walker.
+func ModuleStats(dir string) ([]Stats, error) {
+	var w Walker
+	return w.ModuleStats(dir)
+}
+
+// ModuleStats computes statistics for each Go module in dir and its subdirectories.
+// Packages are loaded as with [Walker.LoadEach].
+// Test files are counted by scanning the module's directories,
+// whether or not w.LoadTests is set.
+func (w *Walker) ModuleStats(dir string) ([]Stats, error) {
+	var result []Stats
+	err := w.loadEach(dir, statsLoadMode, func(subdir string, pkgs []*packages.Package) error {
+		stats, err := moduleStats(subdir, pkgs)
+		if err != nil {
+			return err
+		}
+		result = append(result, stats)
+		return nil
+	})
+	return result, err
+}
+
+// statsLoadMode is what [moduleStats] needs loaded.
+const statsLoadMode = packages.NeedName | packages.NeedFiles | packages.NeedImports | packages.NeedDeps | packages.NeedModule | packages.NeedEmbedFiles
+
+// moduleStats computes the statistics for the module in dir,
+// given its loaded packages.
+func moduleStats(dir string, pkgs []*packages.Package) (Stats, error) {
+	stats := Stats{Dir: dir}
+
+	var mainModule string
+	deps := make(map[string]bool)
+
+	for _, pkg := range pkgs {
+		if isTestVariant(pkg) {
+			continue
+		}
+		if pkg.Module != nil {
+			mainModule = pkg.Module.Path
+		}
+		stats.Packages++
+		stats.GoFiles += len(pkg.GoFiles)
+		stats.EmbedFiles += len(pkg.EmbedFiles)
+		for _, filename := range pkg.GoFiles {
+			n, err := countLines(filename)
+			if err != nil {
+				return stats, err
+			}
+			stats.Lines += n
+		}
+	}
+
+	packages.Visit(pkgs, nil, func(pkg *packages.Package) {
+		if pkg.Module != nil && pkg.Module.Path != mainModule {
+			deps[pkg.Module.Path] = true
+		}
+	})
+	stats.Deps = len(deps)
+
+	err := walkModuleFiles(dir, func(path string, _ fs.DirEntry) error {
+		if !strings.HasSuffix(path, "_test.go") {
+			return nil
+		}
+		n, err := countLines(path)
+		if err != nil {
+			return err
+		}
+		stats.TestFiles++
+		stats.TestLines += n
+		return nil
+	})
+	return stats, err
+}
+
+// isTestVariant tells whether pkg is a test variant of a package
+// (including the synthesized test main package)
+// as loaded when [packages.Config.Tests] is true.
+func isTestVariant(pkg *packages.Package) bool {
+	return pkg.ID != pkg.PkgPath || strings.HasSuffix(pkg.PkgPath, ".test")
+}
+
+// countLines counts the lines in the file at path.
+func countLines(path string) (int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, errors.Wrapf(err, "reading %s", path)
+	}
+	n := bytes.Count(data, []byte{'\n'})
+	if len(data) > 0 && data[len(data)-1] != '\n' {
+		n++
+	}
+	return n, nil
+}
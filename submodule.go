@@ -0,0 +1,107 @@
+package modules
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bobg/errors"
+)
+
+// SubmodulePolicy controls whether a [Walker] walks into git submodule checkouts.
+// See [Walker.Submodules].
+type SubmodulePolicy int
+
+const (
+	// SubmoduleEnter means submodule checkouts are walked into like other directories.
+	// This is the default.
+	SubmoduleEnter SubmodulePolicy = iota + 1
+
+	// SubmoduleSkip means submodule checkouts are not walked into.
+	SubmoduleSkip
+)
+
+func (p SubmodulePolicy) String() string {
+	switch p {
+	case SubmoduleEnter:
+		return "enter"
+	case SubmoduleSkip:
+		return "skip"
+	}
+	return "unknown"
+}
+
+// isSubmodule tells whether dir is the top of a git submodule checkout.
+// Such a directory has a .git file,
+// rather than a .git directory,
+// pointing to the repository's git directory.
+// Linked worktrees (see git-worktree(1)) have .git files too,
+// but are not submodules;
+// their git directories,
+// unlike those of submodules,
+// have a commondir file pointing to the main repository's.
+func isSubmodule(dir string) (bool, error) {
+	path := filepath.Join(dir, ".git")
+	info, err := os.Lstat(osPath(path))
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return false, nil
+	case err != nil:
+		return false, WalkError{Dir: dir, Op: "checking for .git in", Err: err}
+	case !info.Mode().IsRegular():
+		return false, nil
+	}
+
+	data, err := os.ReadFile(osPath(path))
+	if err != nil {
+		return false, WalkError{Dir: dir, Op: "reading .git in", Err: err}
+	}
+	gitdir, ok := strings.CutPrefix(strings.TrimSpace(string(data)), "gitdir:")
+	if !ok {
+		return false, nil
+	}
+	gitdir = filepath.FromSlash(strings.TrimSpace(gitdir))
+	if !filepath.IsAbs(gitdir) {
+		gitdir = filepath.Join(dir, gitdir)
+	}
+	_, err = os.Stat(osPath(filepath.Join(gitdir, "commondir")))
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return true, nil
+	case err != nil:
+		return false, WalkError{Dir: dir, Op: "checking git directory of", Err: err}
+	}
+	return false, nil
+}
+
+// submoduleOf returns the top of the innermost git submodule checkout containing dir,
+// looking no higher than root,
+// or the empty string if there is none.
+// If known is not nil,
+// it caches the results of [isSubmodule] across calls.
+func submoduleOf(root, dir string, known map[string]bool) (string, error) {
+	if rel, err := filepath.Rel(root, dir); err != nil || !filepath.IsLocal(rel) {
+		return "", nil
+	}
+	for {
+		sub, ok := known[dir]
+		if !ok {
+			var err error
+			if sub, err = isSubmodule(dir); err != nil {
+				return "", err
+			}
+			if known != nil {
+				known[dir] = sub
+			}
+		}
+		if sub {
+			return dir, nil
+		}
+		parent := filepath.Dir(dir)
+		if dir == root || parent == dir {
+			return "", nil
+		}
+		dir = parent
+	}
+}
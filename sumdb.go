@@ -0,0 +1,424 @@
+package modules
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/bobg/errors"
+	"golang.org/x/mod/modfile"
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/sumdb"
+	"golang.org/x/mod/sumdb/dirhash"
+)
+
+// ChecksumProblemKind is the kind of a [ChecksumProblem].
+type ChecksumProblemKind int
+
+const (
+	// ChecksumGosumMismatch means the hash in go.sum differs from the checksum database's.
+	ChecksumGosumMismatch ChecksumProblemKind = iota + 1
+
+	// ChecksumGosumMissing means go.sum has no hash for the module's go.mod file.
+	ChecksumGosumMissing
+
+	// ChecksumCacheMismatch means the copy in the local module cache
+	// has a hash different from the checksum database's.
+	ChecksumCacheMismatch
+
+	// ChecksumNotInDB means the checksum database has no record of the module version.
+	ChecksumNotInDB
+)
+
+func (k ChecksumProblemKind) String() string {
+	switch k {
+	case ChecksumGosumMismatch:
+		return "go.sum mismatch"
+	case ChecksumGosumMissing:
+		return "missing from go.sum"
+	case ChecksumCacheMismatch:
+		return "module cache mismatch"
+	case ChecksumNotInDB:
+		return "not in checksum database"
+	}
+	return "unknown"
+}
+
+// ChecksumProblem is a discrepancy between the checksum database
+// and a module's go.sum file or the local module cache.
+// See [Walker.VerifyChecksumsEach].
+type ChecksumProblem struct {
+	// Path and Version identify the required module version.
+	// For a require that is replaced with another module version,
+	// these identify the replacement.
+	Path, Version string
+
+	// GoMod tells whether the problem concerns the hash of the module's go.mod file
+	// rather than that of its full contents.
+	GoMod bool
+
+	// Kind is the kind of problem.
+	Kind ChecksumProblemKind
+
+	// Expected is the hash from the checksum database,
+	// and Found is the conflicting hash from go.sum or the module cache.
+	// Either may be empty,
+	// depending on Kind.
+	Expected, Found string
+}
+
+// ModuleChecksums is the result of [Walker.VerifyChecksumsEach] for a single module.
+type ModuleChecksums struct {
+	// Dir is the module's directory.
+	Dir string
+
+	// Checked is the number of required module versions checked against the database.
+	Checked int
+
+	// Problems are the discrepancies found.
+	Problems []ChecksumProblem
+}
+
+// VerifyChecksumsEach checks the requires of each Go module in dir and its subdirectories
+// against the Go checksum database.
+// This function calls Walker.VerifyChecksumsEach with a default Walker.
+func VerifyChecksumsEach(ctx context.Context, dir string) ([]ModuleChecksums, error) {
+	var w Walker
+	return w.VerifyChecksumsEach(ctx, dir)
+}
+
+// VerifyChecksumsEach checks the requires of each Go module in dir and its subdirectories
+// against the Go checksum database,
+// reporting go.sum hashes that differ from the database's (tampering),
+// go.sum files lacking hashes for required modules (drift),
+// and copies in the local module cache whose hashes differ from the database's.
+// The result has one entry per module,
+// including those with no problems.
+//
+// The database is the one given by GOSUMDB,
+// reached through the first proxy in GOPROXY if that proxy supports it,
+// as the go command does.
+// Modules matching GONOSUMDB or GOPRIVATE are not checked,
+// nor are requires replaced with a local directory.
+// If GOSUMDB is "off",
+// nothing is checked.
+// The database's signed tree is verified in memory;
+// the go command's on-disk record of it is neither consulted nor updated.
+// Any evidence that the database itself is misbehaving is returned as an error.
+func (w *Walker) VerifyChecksumsEach(ctx context.Context, dir string) ([]ModuleChecksums, error) {
+	var (
+		result []ModuleChecksums
+		ops    *sumdbOps
+		client *sumdb.Client
+		cache  string
+	)
+	err := w.EachGomod(dir, func(subdir string, mf *modfile.File) error {
+		if client == nil {
+			env, err := w.goEnv(subdir, "GOSUMDB", "GOPROXY", "GONOSUMDB", "GOPRIVATE", "GOMODCACHE")
+			if err != nil {
+				return err
+			}
+			ops, err = newSumdbOps(ctx, env["GOSUMDB"], env["GOPROXY"])
+			if err != nil {
+				return err
+			}
+			if ops == nil {
+				return filepath.SkipAll // GOSUMDB=off
+			}
+			client = sumdb.NewClient(ops)
+			nosumdb := env["GONOSUMDB"]
+			if nosumdb == "" {
+				nosumdb = env["GOPRIVATE"]
+			}
+			client.SetGONOSUMDB(nosumdb)
+			cache = env["GOMODCACHE"]
+		}
+
+		res, err := verifyChecksums(client, ops, cache, subdir, mf)
+		if err != nil {
+			return err
+		}
+		result = append(result, res)
+		return nil
+	})
+	return result, err
+}
+
+func verifyChecksums(client *sumdb.Client, ops *sumdbOps, cache, dir string, mf *modfile.File) (ModuleChecksums, error) {
+	res := ModuleChecksums{Dir: dir}
+
+	gosum, err := readGosum(dir)
+	if err != nil {
+		return res, err
+	}
+
+	for _, req := range mf.Require {
+		mod := req.Mod
+		if rep := findReplace(mf, mod.Path, mod.Version); rep != nil {
+			if rep.New.Version == "" {
+				continue // local directory
+			}
+			mod = rep.New
+		}
+
+		lines, err := client.Lookup(mod.Path, mod.Version)
+		if errors.Is(err, sumdb.ErrGONOSUMDB) {
+			continue
+		}
+		if errors.Is(err, sumdb.ErrSecurity) {
+			return res, errors.Wrapf(err, "looking up %s@%s in checksum database: %s", mod.Path, mod.Version, strings.Join(ops.securityErrors(), "; "))
+		}
+		if err != nil {
+			if strings.Contains(err.Error(), "not found") {
+				res.Problems = append(res.Problems, ChecksumProblem{Path: mod.Path, Version: mod.Version, Kind: ChecksumNotInDB})
+				continue
+			}
+			return res, errors.Wrapf(err, "looking up %s@%s in checksum database", mod.Path, mod.Version)
+		}
+		res.Checked++
+
+		for _, line := range lines {
+			fields := strings.Fields(line)
+			if len(fields) != 3 || fields[0] != mod.Path {
+				continue
+			}
+			version, expected := fields[1], fields[2]
+			isGoMod := strings.HasSuffix(version, "/go.mod")
+			problem := ChecksumProblem{Path: mod.Path, Version: mod.Version, GoMod: isGoMod, Expected: expected}
+
+			// Go.sum may omit the hash of the full module contents,
+			// e.g. when none of the module's packages are needed,
+			// but not that of its go.mod file.
+			switch found, ok := gosum[mod.Path+" "+version]; {
+			case ok && found != expected:
+				problem.Kind, problem.Found = ChecksumGosumMismatch, found
+				res.Problems = append(res.Problems, problem)
+			case !ok && isGoMod:
+				problem.Kind = ChecksumGosumMissing
+				res.Problems = append(res.Problems, problem)
+			}
+
+			found, err := cachedHash(cache, mod, isGoMod)
+			if err != nil {
+				return res, err
+			}
+			if found != "" && found != expected {
+				problem.Kind, problem.Found = ChecksumCacheMismatch, found
+				res.Problems = append(res.Problems, problem)
+			}
+		}
+	}
+
+	return res, nil
+}
+
+// readGosum reads the go.sum file in dir,
+// returning a map from "path version" to hash.
+// A missing go.sum file is treated as empty.
+func readGosum(dir string) (map[string]string, error) {
+	result := make(map[string]string)
+	data, err := os.ReadFile(filepath.Join(dir, "go.sum"))
+	if errors.Is(err, fs.ErrNotExist) {
+		return result, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "reading %s", filepath.Join(dir, "go.sum"))
+	}
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) == 3 {
+			result[fields[0]+" "+fields[1]] = fields[2]
+		}
+	}
+	return result, nil
+}
+
+// cachedHash returns the hash of mod's contents
+// (or of its go.mod file, if goMod is true)
+// as found in the download cache of the module cache rooted at cache,
+// or the empty string if it is not there.
+func cachedHash(cache string, mod module.Version, goMod bool) (string, error) {
+	if cache == "" {
+		return "", nil
+	}
+	escPath, err := module.EscapePath(mod.Path)
+	if err != nil {
+		return "", errors.Wrapf(err, "escaping module path %s", mod.Path)
+	}
+	escVersion, err := module.EscapeVersion(mod.Version)
+	if err != nil {
+		return "", errors.Wrapf(err, "escaping version %s", mod.Version)
+	}
+	base := filepath.Join(cache, "cache", "download", filepath.FromSlash(escPath), "@v", escVersion)
+
+	if !goMod {
+		data, err := os.ReadFile(base + ".ziphash")
+		if errors.Is(err, fs.ErrNotExist) {
+			return "", nil
+		}
+		return strings.TrimSpace(string(data)), errors.Wrapf(err, "reading %s.ziphash", base)
+	}
+
+	if _, err := os.Stat(base + ".mod"); errors.Is(err, fs.ErrNotExist) {
+		return "", nil
+	}
+	h, err := dirhash.Hash1([]string{"go.mod"}, func(string) (io.ReadCloser, error) {
+		return os.Open(base + ".mod")
+	})
+	return h, errors.Wrapf(err, "hashing %s.mod", base)
+}
+
+// knownSumdbKeys are the verifier keys of checksum databases
+// that may be named in GOSUMDB without a key.
+var knownSumdbKeys = map[string]string{
+	"sum.golang.org": "sum.golang.org+033de0ae+Ac4zctda0e5eza+HJyk9SxEdh+s3Ux18htTTAD8OuAn8",
+}
+
+// sumdbOps implements [sumdb.ClientOps],
+// keeping the database's configuration and cache in memory.
+type sumdbOps struct {
+	ctx context.Context
+	key string
+	url string // base URL for remote reads
+
+	mu     sync.Mutex
+	config map[string][]byte
+	cache  map[string][]byte
+	errs   []string
+}
+
+// newSumdbOps returns the [sumdb.ClientOps] for the given GOSUMDB and GOPROXY settings,
+// or nil if GOSUMDB is "off".
+func newSumdbOps(ctx context.Context, gosumdb, goproxy string) (*sumdbOps, error) {
+	if gosumdb == "" {
+		gosumdb = "sum.golang.org"
+	}
+	if gosumdb == "off" {
+		return nil, nil
+	}
+	if gosumdb == "sum.golang.google.cn" {
+		// An alias for sum.golang.org, as in the go command.
+		gosumdb = "sum.golang.org https://sum.golang.google.cn"
+	}
+
+	fields := strings.Fields(gosumdb)
+	if len(fields) == 0 || len(fields) > 2 {
+		return nil, fmt.Errorf("invalid GOSUMDB %q", gosumdb)
+	}
+	key, name := fields[0], fields[0]
+	if known, ok := knownSumdbKeys[key]; ok {
+		key = known
+	} else if i := strings.Index(name, "+"); i >= 0 {
+		name = name[:i]
+	} else {
+		return nil, fmt.Errorf("unknown checksum database %s in GOSUMDB", name)
+	}
+
+	url := "https://" + name
+	if len(fields) == 2 {
+		url = strings.TrimSuffix(fields[1], "/")
+	}
+
+	ops := &sumdbOps{
+		ctx:    ctx,
+		key:    key,
+		url:    url,
+		config: make(map[string][]byte),
+		cache:  make(map[string][]byte),
+	}
+
+	// Use the first proxy if it supports proxying this database.
+	proxy := goproxy
+	if i := strings.IndexAny(proxy, ",|"); i >= 0 {
+		proxy = proxy[:i]
+	}
+	if proxy != "" && proxy != "direct" && proxy != "off" {
+		proxyURL := strings.TrimSuffix(proxy, "/") + "/sumdb/" + name
+		if _, err := ops.get(proxyURL + "/supported"); err == nil {
+			ops.url = proxyURL
+		}
+	}
+
+	return ops, nil
+}
+
+func (o *sumdbOps) get(url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(o.ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, errors.Wrapf(err, "creating request for %s", url)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, errors.Wrapf(err, "getting %s", url)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errors.Wrapf(err, "reading %s", url)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("getting %s: %s: %s", url, resp.Status, bytes.TrimSpace(data))
+	}
+	return data, nil
+}
+
+func (o *sumdbOps) ReadRemote(path string) ([]byte, error) {
+	return o.get(o.url + path)
+}
+
+func (o *sumdbOps) ReadConfig(file string) ([]byte, error) {
+	if file == "key" {
+		return []byte(o.key), nil
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.config[file], nil // Nil for the initial "latest" means start with an empty tree.
+}
+
+func (o *sumdbOps) WriteConfig(file string, old, new []byte) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if !bytes.Equal(o.config[file], old) {
+		return sumdb.ErrWriteConflict
+	}
+	o.config[file] = new
+	return nil
+}
+
+func (o *sumdbOps) ReadCache(file string) ([]byte, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if data, ok := o.cache[file]; ok {
+		return data, nil
+	}
+	return nil, fs.ErrNotExist
+}
+
+func (o *sumdbOps) WriteCache(file string, data []byte) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.cache[file] = data
+}
+
+func (o *sumdbOps) Log(string) {}
+
+func (o *sumdbOps) SecurityError(msg string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.errs = append(o.errs, msg)
+}
+
+func (o *sumdbOps) securityErrors() []string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return append([]string{}, o.errs...)
+}
@@ -0,0 +1,162 @@
+package modules
+
+import (
+	"path/filepath"
+
+	"github.com/bobg/errors"
+	"golang.org/x/mod/modfile"
+)
+
+// TagStatus is the release status of a module,
+// as determined by [Walker.AuditTags].
+type TagStatus int
+
+const (
+	// TagCurrent means the module's files have not changed since its latest tag.
+	TagCurrent TagStatus = iota + 1
+
+	// TagUntagged means the module has never been tagged
+	// (with a version matching its module path's major version).
+	TagUntagged
+
+	// TagDrifted means the module's files have changed since its latest tag.
+	TagDrifted
+)
+
+func (s TagStatus) String() string {
+	switch s {
+	case TagCurrent:
+		return "current"
+	case TagUntagged:
+		return "untagged"
+	case TagDrifted:
+		return "drifted"
+	}
+	return "unknown"
+}
+
+// TagAudit describes the git tags of a module
+// and whether it has changed since the latest of them.
+// See [Walker.AuditTags].
+type TagAudit struct {
+	// Dir is the directory containing the module's go.mod file,
+	// as passed to the callback of [Walker.Each].
+	Dir string
+
+	// Path is the module path.
+	Path string
+
+	// Prefix is the prefix of the module's tags:
+	// its directory relative to the root of its repository,
+	// with a trailing slash,
+	// or the empty string if it is at the root.
+	Prefix string
+
+	// Versions are the versions for which the module has tags,
+	// in increasing semver order,
+	// without Prefix.
+	Versions []string
+
+	// Latest is the highest of Versions
+	// with the major version implied by Path
+	// (v0 or v1 if Path has no /vN suffix),
+	// or the empty string if there is none.
+	Latest string
+
+	// Status says whether the module is untagged,
+	// or has changed since Latest.
+	Status TagStatus
+
+	// Changed are the files in the module
+	// (not counting nested modules)
+	// that changed between Latest and HEAD,
+	// when Status is TagDrifted.
+	// They are absolute paths.
+	Changed []string
+}
+
+// AuditTags reports the git tags of each Go module in dir and its subdirectories,
+// flagging modules that have never been tagged
+// and modules that have changed since their latest tag.
+// This function calls Walker.AuditTags with a default Walker.
+func AuditTags(dir string) ([]TagAudit, error) {
+	var w Walker
+	return w.AuditTags(dir)
+}
+
+// AuditTags reports the git tags of each Go module in dir and its subdirectories,
+// flagging modules that have never been tagged
+// and modules that have changed since their latest tag,
+// in the order [Walker.Each] visits the modules.
+//
+// Tags follow the Go convention for modules in subdirectories of a repository:
+// a module in sub/dir is tagged sub/dir/vX.Y.Z.
+// A module has changed since its latest tag
+// if any of its files
+// (not counting those of nested modules)
+// differ between the tag and HEAD,
+// as reported by "git diff tag...HEAD".
+// Uncommitted changes are not considered.
+func (w *Walker) AuditTags(dir string) ([]TagAudit, error) {
+	var result []TagAudit
+	err := w.EachGomod(dir, func(subdir string, mf *modfile.File) error {
+		audit := TagAudit{Dir: subdir}
+		if mf.Module != nil {
+			audit.Path = mf.Module.Mod.Path
+		}
+
+		var err error
+		if audit.Prefix, err = moduleTagPrefix(subdir); err != nil {
+			return errors.Wrapf(err, "getting tag prefix for %s", subdir)
+		}
+		if audit.Versions, err = moduleVersions(subdir, ""); err != nil {
+			return errors.Wrapf(err, "getting tagged versions in %s", subdir)
+		}
+		major, err := modulePathMajor(audit.Path)
+		if err != nil {
+			return err
+		}
+		audit.Latest = latestVersion(audit.Versions, major)
+
+		result = append(result, audit)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var absModuleDirs map[string]string // computed only if needed
+	for i, audit := range result {
+		if audit.Latest == "" {
+			result[i].Status = TagUntagged
+			continue
+		}
+
+		if absModuleDirs == nil {
+			if absModuleDirs, err = w.absModuleDirs(dir); err != nil {
+				return nil, err
+			}
+		}
+		absDir, err := filepath.Abs(audit.Dir)
+		if err != nil {
+			return nil, errors.Wrapf(err, "getting absolute path of %s", audit.Dir)
+		}
+
+		files, err := changedFiles(audit.Dir, audit.Prefix+audit.Latest, "HEAD")
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range files {
+			if m, ok := containingModule(file, absModuleDirs); ok && m == absDir {
+				result[i].Changed = append(result[i].Changed, file)
+			}
+		}
+		if len(result[i].Changed) > 0 {
+			result[i].Status = TagDrifted
+		} else {
+			result[i].Status = TagCurrent
+		}
+	}
+
+	return result, nil
+}
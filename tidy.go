@@ -0,0 +1,96 @@
+package modules
+
+import (
+	"bytes"
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/bobg/errors"
+)
+
+// TidyEach runs "go mod tidy" in each Go module in dir and its subdirectories.
+// This function calls Walker.TidyEach with a default Walker.
+func TidyEach(ctx context.Context, dir string, check bool) ([]string, error) {
+	var w Walker
+	return w.TidyEach(ctx, dir, check)
+}
+
+// TidyEach runs "go mod tidy" in each Go module in dir and its subdirectories,
+// returning the directories of the modules whose go.mod or go.sum files it changed,
+// in the order [Walker.Each] visits them.
+//
+// If check is true,
+// each module's go.mod and go.sum files are restored afterwards,
+// so the result is the list of modules that are not tidy
+// and nothing is changed.
+//
+// The settings in w.Env, w.GOFLAGS, and w.GOWORK,
+// and the environment in w.LoadConfig,
+// are used when running "go mod tidy".
+func (w *Walker) TidyEach(ctx context.Context, dir string, check bool) ([]string, error) {
+	var result []string
+	err := w.Each(dir, func(subdir string) error {
+		changed, err := w.tidy(ctx, subdir, check)
+		if err != nil {
+			return err
+		}
+		if changed {
+			result = append(result, subdir)
+		}
+		return nil
+	})
+	return result, err
+}
+
+// tidy runs "go mod tidy" in the module in dir,
+// reporting whether it changed go.mod or go.sum.
+// If restore is true,
+// the files are put back as they were.
+func (w *Walker) tidy(ctx context.Context, dir string, restore bool) (changed bool, err error) {
+	names := []string{"go.mod", "go.sum"}
+	before := make(map[string][]byte, len(names))
+	for _, name := range names {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return false, errors.Wrapf(err, "reading %s", name)
+		}
+		before[name] = data // nil if the file doesn't exist
+	}
+
+	if restore {
+		defer func() {
+			for _, name := range names {
+				path := filepath.Join(dir, name)
+				var rerr error
+				if before[name] == nil {
+					rerr = os.Remove(path)
+					if errors.Is(rerr, fs.ErrNotExist) {
+						rerr = nil
+					}
+				} else {
+					rerr = os.WriteFile(path, before[name], 0644)
+				}
+				if rerr != nil {
+					err = errors.Join(err, errors.Wrapf(rerr, "restoring %s", path))
+				}
+			}
+		}()
+	}
+
+	if _, err := w.goCmdContext(ctx, dir, "mod", "tidy"); err != nil {
+		return false, err
+	}
+
+	for _, name := range names {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return false, errors.Wrapf(err, "reading %s", name)
+		}
+		if !bytes.Equal(data, before[name]) || (data == nil) != (before[name] == nil) {
+			changed = true
+		}
+	}
+	return changed, nil
+}
@@ -0,0 +1,50 @@
+package modules
+
+import "log/slog"
+
+// Names of the spans a [Walker] reports to its [Tracer].
+const (
+	// SpanScan is the name of the span for reading a directory during a walk.
+	SpanScan = "modules.scan"
+
+	// SpanParse is the name of the span for reading and parsing a go.mod file.
+	SpanParse = "modules.parse"
+
+	// SpanLoad is the name of the span for loading the packages of a module,
+	// whether with [packages.Load] or from a [LoadCache].
+	SpanLoad = "modules.load"
+)
+
+// Tracer receives spans describing the work a [Walker] does,
+// so it can be shown in tracing tools such as those based on OpenTelemetry.
+// See [Walker.Tracer].
+//
+// An adapter for a tracing library will typically start each span
+// as a child of a span or context captured when the adapter is created.
+// Implementations must be safe for concurrent use.
+type Tracer interface {
+	// Start starts a span with the given name
+	// (one of SpanScan, SpanParse, or SpanLoad)
+	// and attributes.
+	// Every span has a "dir" attribute
+	// naming the directory involved.
+	Start(name string, attrs ...slog.Attr) Span
+}
+
+// Span is a span started by a [Tracer].
+type Span interface {
+	// End ends the span.
+	// If err is not nil,
+	// the work the span describes failed with that error.
+	End(err error)
+}
+
+// startSpan starts a span with w.Tracer,
+// if there is one,
+// returning a function that ends it.
+func (w *Walker) startSpan(name string, attrs ...slog.Attr) func(error) {
+	if w.Tracer == nil {
+		return func(error) {}
+	}
+	return w.Tracer.Start(name, attrs...).End
+}
@@ -0,0 +1,82 @@
+package modules
+
+import (
+	"github.com/bobg/errors"
+	"golang.org/x/mod/modfile"
+)
+
+// UnusedRequire is a direct require directive for a module that no package in the requiring module imports.
+// See [Walker.UnusedRequires].
+type UnusedRequire struct {
+	// Dir is the directory of the requiring module.
+	Dir string
+
+	// Path and Version are the required module path and version.
+	Path, Version string
+}
+
+// UnusedRequires finds direct requires in the Go modules in dir and its subdirectories
+// that none of the module's packages import,
+// optionally removing them.
+// This function calls Walker.UnusedRequires with a default Walker.
+func UnusedRequires(dir string, remove bool) ([]UnusedRequire, error) {
+	var w Walker
+	return w.UnusedRequires(dir, remove)
+}
+
+// UnusedRequires finds direct requires
+// (those not marked "// indirect")
+// in the Go modules in dir and its subdirectories
+// that none of the module's packages import.
+// Requires marked indirect are not considered.
+//
+// Imports are read from every Go file in each module,
+// regardless of build constraints,
+// so requires used only by tests,
+// by files for other platforms,
+// or by tool-tracking files (such as tools.go with a "tools" build tag)
+// are not reported.
+// Nested modules and directories the go command ignores are skipped.
+//
+// If remove is true,
+// the unused requires are also removed from the go.mod files.
+// An unused direct require may still be needed indirectly,
+// to select a higher version of a dependency than the rest of the build list would,
+// so running "go mod tidy" afterwards is advisable;
+// it restores such requires as indirect ones.
+func (w *Walker) UnusedRequires(dir string, remove bool) ([]UnusedRequire, error) {
+	w = w.forEdit()
+
+	var result []UnusedRequire
+	err := w.EachGomod(dir, func(subdir string, mf *modfile.File) error {
+		imports, err := moduleImports(subdir)
+		if err != nil {
+			return err
+		}
+		used := make(map[string]bool)
+		for _, imp := range imports {
+			if req := requireFor(mf, imp); req != nil {
+				used[req.Mod.Path] = true
+			}
+		}
+
+		var unused []UnusedRequire
+		for _, req := range mf.Require {
+			if !req.Indirect && !used[req.Mod.Path] {
+				unused = append(unused, UnusedRequire{Dir: subdir, Path: req.Mod.Path, Version: req.Mod.Version})
+			}
+		}
+		result = append(result, unused...)
+
+		if !remove || len(unused) == 0 {
+			return nil
+		}
+		for _, u := range unused {
+			if err := mf.DropRequire(u.Path); err != nil {
+				return errors.Wrapf(err, "removing require of %s", u.Path)
+			}
+		}
+		return w.writeGomod(subdir, mf)
+	})
+	return result, err
+}
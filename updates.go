@@ -0,0 +1,235 @@
+package modules
+
+import (
+	"context"
+	"fmt"
+	"path"
+
+	"github.com/bobg/errors"
+	"golang.org/x/mod/modfile"
+	"golang.org/x/mod/semver"
+)
+
+// UpdatePolicy controls which dependency updates [Walker.PlanUpdates] proposes.
+type UpdatePolicy struct {
+	// Max is the largest kind of upgrade to propose.
+	// With UpgradePatch,
+	// the latest patch release of the required minor version is proposed
+	// even when a newer minor version exists.
+	// UpgradeMajor allows only upgrades from v0 to v1,
+	// since higher major versions have different module paths.
+	// If Max is zero,
+	// UpgradeMinor is used.
+	Max UpgradeKind
+
+	// Indirect, if true,
+	// includes requires marked "// indirect".
+	Indirect bool
+
+	// Ignore are patterns,
+	// in the syntax of [path.Match],
+	// for the module paths of dependencies not to update.
+	Ignore []string
+
+	// FixRetracted, if true,
+	// proposes updating a dependency whose required version is retracted
+	// to its latest version,
+	// even if that exceeds Max.
+	FixRetracted bool
+}
+
+// ProposedUpdate is a proposed change to a require directive.
+// See [Walker.PlanUpdates].
+type ProposedUpdate struct {
+	// Path is the module path of the dependency.
+	Path string
+
+	// From is the currently required version,
+	// and To is the proposed one.
+	From, To string
+
+	// Indirect tells whether the require directive is marked "// indirect".
+	Indirect bool
+
+	// Kind classifies the upgrade from From to To.
+	Kind UpgradeKind
+
+	// Reason explains the update,
+	// such as "minor update" or "v1.2.3 is retracted: broken build".
+	Reason string
+}
+
+// ModuleUpdatePlan is the part of an [UpdatePlan] for a single module.
+type ModuleUpdatePlan struct {
+	// Dir is the module's directory.
+	Dir string
+
+	// Updates are the proposed updates,
+	// in go.mod order.
+	Updates []ProposedUpdate
+}
+
+// UpdatePlan is a plan for updating the dependencies of the modules in a tree.
+// It is produced by [Walker.PlanUpdates]
+// and carried out by [Walker.ApplyUpdates].
+type UpdatePlan struct {
+	// Modules are the modules with proposed updates,
+	// in the order [Walker.Each] visits them.
+	Modules []ModuleUpdatePlan
+}
+
+// PlanUpdates proposes dependency updates for the Go modules in dir and its subdirectories.
+// This function calls Walker.PlanUpdates with a default Walker.
+func PlanUpdates(ctx context.Context, dir string, policy UpdatePolicy) (*UpdatePlan, error) {
+	var w Walker
+	return w.PlanUpdates(ctx, dir, policy)
+}
+
+// PlanUpdates proposes dependency updates for the Go modules in dir and its subdirectories,
+// according to policy,
+// without changing anything.
+// See [Walker.ApplyUpdates] for carrying out the plan.
+//
+// Available versions are found as for [Walker.OutdatedEach].
+// Modules with no proposed updates are omitted from the plan.
+func (w *Walker) PlanUpdates(ctx context.Context, dir string, policy UpdatePolicy) (*UpdatePlan, error) {
+	maxKind := policy.Max
+	if maxKind == UpgradeNone {
+		maxKind = UpgradeMinor
+	}
+
+	w2 := *w
+	w2.GOWORK = "off"
+
+	plan := new(UpdatePlan)
+	err := w.EachGomod(dir, func(subdir string, mf *modfile.File) error {
+		outdated, err := w2.outdatedRequires(ctx, subdir, mf, false)
+		if err != nil {
+			return errors.Wrapf(err, "checking %s", subdir)
+		}
+
+		var updates []ProposedUpdate
+		for _, o := range outdated {
+			if o.Indirect && !policy.Indirect {
+				continue
+			}
+			if ignored, err := matchAny(policy.Ignore, o.Path); err != nil {
+				return err
+			} else if ignored {
+				continue
+			}
+
+			u := ProposedUpdate{Path: o.Path, From: o.Version, Indirect: o.Indirect}
+			switch {
+			case o.Latest == "":
+				// Nothing newer.
+			case o.Kind <= maxKind:
+				u.To, u.Kind, u.Reason = o.Latest, o.Kind, o.Kind.String()+" update"
+			case maxKind == UpgradePatch:
+				patch, err := w2.queryVersion(ctx, subdir, o.Path+"@patch")
+				if err != nil {
+					return err
+				}
+				if semver.Compare(patch, o.Version) > 0 {
+					u.To, u.Kind, u.Reason = patch, UpgradePatch, "patch update"
+				}
+			}
+			if len(o.Retracted) > 0 && policy.FixRetracted && o.Latest != "" {
+				if u.To == "" {
+					u.To, u.Kind = o.Latest, o.Kind
+				}
+				u.Reason = o.Version + " is retracted"
+				if o.Retracted[0] != "" {
+					u.Reason += ": " + o.Retracted[0]
+				}
+			}
+			if u.To != "" {
+				updates = append(updates, u)
+			}
+		}
+
+		if len(updates) > 0 {
+			plan.Modules = append(plan.Modules, ModuleUpdatePlan{Dir: subdir, Updates: updates})
+		}
+		return nil
+	})
+	return plan, err
+}
+
+// queryVersion resolves a module query such as "example.com/foo@patch"
+// in the module in dir,
+// returning the resulting version.
+func (w *Walker) queryVersion(ctx context.Context, dir, query string) (string, error) {
+	out, err := w.goCmdContext(ctx, dir, "list", "-m", "-json", query)
+	if err != nil {
+		return "", err
+	}
+	listed, err := decodeListedModules(out)
+	if err != nil {
+		return "", err
+	}
+	if len(listed) == 0 {
+		return "", fmt.Errorf("no result for %s", query)
+	}
+	return listed[0].Version, nil
+}
+
+// matchAny tells whether modpath matches any of the [path.Match] patterns.
+func matchAny(patterns []string, modpath string) (bool, error) {
+	for _, pattern := range patterns {
+		ok, err := path.Match(pattern, modpath)
+		if err != nil {
+			return false, errors.Wrapf(err, "matching pattern %s", pattern)
+		}
+		if ok {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// ApplyUpdates rewrites go.mod files to carry out the updates in plan.
+// This function calls Walker.ApplyUpdates with a default Walker.
+func ApplyUpdates(plan *UpdatePlan) error {
+	var w Walker
+	return w.ApplyUpdates(plan)
+}
+
+// ApplyUpdates rewrites go.mod files to carry out the updates in plan,
+// as produced by [Walker.PlanUpdates].
+// It is an error if a require directive in the plan no longer has its From version,
+// in which case the plan is stale
+// and no change is made to that module.
+//
+// Only go.mod files are changed.
+// Running "go mod tidy" afterwards is advisable,
+// to update go.sum files and the requires of indirect dependencies.
+func (w *Walker) ApplyUpdates(plan *UpdatePlan) error {
+	w = w.forEdit()
+
+	for _, m := range plan.Modules {
+		_, mf, err := w.readGomod(m.Dir)
+		if err != nil {
+			return err
+		}
+		for _, u := range m.Updates {
+			var found bool
+			for _, req := range mf.Require {
+				if req.Mod.Path == u.Path && req.Mod.Version == u.From {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return fmt.Errorf("%s does not require %s@%s", m.Dir, u.Path, u.From)
+			}
+			if err := mf.AddRequire(u.Path, u.To); err != nil {
+				return errors.Wrapf(err, "updating require of %s in %s", u.Path, m.Dir)
+			}
+		}
+		if err := w.writeGomod(m.Dir, mf); err != nil {
+			return err
+		}
+	}
+	return nil
+}
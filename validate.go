@@ -0,0 +1,93 @@
+package modules
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/bobg/errors"
+	"golang.org/x/tools/go/packages"
+)
+
+// Validate checks w for inconsistent or ineffective settings,
+// returning an error describing each problem found
+// (joined with [errors.Join]),
+// or nil if there are none.
+// [NewWalker] calls this after applying its options.
+//
+// A Walker that fails validation can still be used,
+// but some of its settings will be ignored or overridden.
+func (w *Walker) Validate() error {
+	var errs []error
+
+	if w.LoadConfig.Dir != "" {
+		errs = append(errs, fmt.Errorf("LoadConfig.Dir is %q, but it is replaced with each module's directory when loading; leave it empty", w.LoadConfig.Dir))
+	}
+
+	mode := w.LoadConfig.Mode
+	if mode == 0 {
+		mode = DefaultLoadMode
+	}
+	if (w.LoadTests || w.LoadConfig.Tests) && mode&(packages.NeedFiles|packages.NeedSyntax) == 0 {
+		errs = append(errs, fmt.Errorf("test packages are requested, but the load mode includes neither NeedFiles nor NeedSyntax, so they cannot be told apart; add one of those to LoadConfig.Mode"))
+	}
+	if w.FastTypes && mode&packages.NeedTypes == 0 {
+		errs = append(errs, fmt.Errorf("FastTypes is set, but the load mode does not include NeedTypes, so it has no effect; add NeedTypes to LoadConfig.Mode or unset FastTypes"))
+	}
+
+	for _, kind := range w.FailOn {
+		switch kind {
+		case packages.UnknownError, packages.ListError, packages.ParseError, packages.TypeError:
+		default:
+			errs = append(errs, fmt.Errorf("FailOn contains unknown package error kind %d", kind))
+		}
+	}
+
+	for _, flag := range w.BuildFlags {
+		if !strings.HasPrefix(flag, "-") {
+			errs = append(errs, fmt.Errorf("build flag %q does not begin with -", flag))
+		}
+	}
+	for _, pattern := range w.LoadPatterns {
+		if pattern == "" {
+			errs = append(errs, fmt.Errorf("LoadPatterns contains an empty pattern"))
+		}
+	}
+	for _, kv := range w.Env {
+		if k, _, ok := strings.Cut(kv, "="); !ok || k == "" {
+			errs = append(errs, fmt.Errorf("environment setting %q is not in KEY=value form", kv))
+		}
+	}
+	for path := range w.Overlay {
+		if !filepath.IsAbs(path) {
+			errs = append(errs, fmt.Errorf("overlay path %s is not absolute", path))
+		}
+	}
+
+	switch w.Links {
+	case 0, LinkSkip, LinkFollow:
+	default:
+		errs = append(errs, fmt.Errorf("unknown link policy %d", w.Links))
+	}
+
+	switch w.Submodules {
+	case 0, SubmoduleEnter, SubmoduleSkip:
+	default:
+		errs = append(errs, fmt.Errorf("unknown submodule policy %d", w.Submodules))
+	}
+
+	if w.Concurrency < 0 {
+		errs = append(errs, fmt.Errorf("Concurrency is negative (%d); use 0 for the default", w.Concurrency))
+	}
+	if w.ScanConcurrency < 0 {
+		errs = append(errs, fmt.Errorf("ScanConcurrency is negative (%d); use 0 for the default", w.ScanConcurrency))
+	}
+	if w.Pipeline.Parse < 0 || w.Pipeline.Load < 0 {
+		errs = append(errs, fmt.Errorf("Pipeline has a negative concurrency (Parse %d, Load %d); use 0 for the default", w.Pipeline.Parse, w.Pipeline.Load))
+	}
+	if w.Limit < 0 {
+		errs = append(errs, fmt.Errorf("Limit is negative (%d); use 0 for no limit", w.Limit))
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,559 @@
+package modules
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/bobg/errors"
+	"golang.org/x/mod/modfile"
+	"golang.org/x/mod/module"
+	"golang.org/x/sync/errgroup"
+)
+
+// VendorDriftKind is the kind of a [VendorDrift].
+type VendorDriftKind int
+
+const (
+	// VendorMissingModule means go.mod requires a module that vendor/modules.txt does not list.
+	VendorMissingModule VendorDriftKind = iota + 1
+
+	// VendorExtraModule means vendor/modules.txt lists a module as explicitly required
+	// but go.mod does not require it.
+	VendorExtraModule
+
+	// VendorVersionMismatch means vendor/modules.txt lists a different version of a module than go.mod requires.
+	VendorVersionMismatch
+
+	// VendorNotExplicit means go.mod requires a module
+	// that vendor/modules.txt does not mark as explicitly required.
+	VendorNotExplicit
+
+	// VendorReplaceMismatch means a replace directive in go.mod
+	// does not match the replacement recorded in vendor/modules.txt,
+	// or vice versa.
+	VendorReplaceMismatch
+
+	// VendorMissingPackage means vendor/modules.txt lists a package
+	// whose directory is missing from vendor or has no Go files.
+	VendorMissingPackage
+
+	// VendorExtraPackage means the vendor directory contains a package
+	// that vendor/modules.txt does not list.
+	VendorExtraPackage
+)
+
+func (k VendorDriftKind) String() string {
+	switch k {
+	case VendorMissingModule:
+		return "module not vendored"
+	case VendorExtraModule:
+		return "module vendored but not required"
+	case VendorVersionMismatch:
+		return "version mismatch"
+	case VendorNotExplicit:
+		return "not marked explicit"
+	case VendorReplaceMismatch:
+		return "replacement mismatch"
+	case VendorMissingPackage:
+		return "package missing"
+	case VendorExtraPackage:
+		return "package not listed"
+	}
+	return "unknown"
+}
+
+// VendorDrift is an inconsistency between a module's go.mod file,
+// its vendor/modules.txt file,
+// and the contents of its vendor directory.
+// See [Walker.VerifyVendorEach].
+type VendorDrift struct {
+	// Kind is the kind of inconsistency.
+	Kind VendorDriftKind
+
+	// Path is the module path,
+	// or for VendorMissingPackage and VendorExtraPackage,
+	// the package import path.
+	Path string
+
+	// Expected is what go.mod says
+	// (a version, or a replacement in "path version" form),
+	// and Found is what vendor/modules.txt says.
+	// Either may be empty,
+	// depending on Kind.
+	Expected, Found string
+}
+
+// ModuleVendorDrift is the result of [Walker.VerifyVendorEach] for a single module.
+type ModuleVendorDrift struct {
+	// Dir is the module's directory.
+	Dir string
+
+	// Drift are the inconsistencies found,
+	// sorted by Path and then by Kind.
+	Drift []VendorDrift
+}
+
+// VerifyVendorEach checks the vendor directory of each Go module in dir and its subdirectories
+// for consistency with the module's go.mod file.
+// This function calls Walker.VerifyVendorEach with a default Walker.
+func VerifyVendorEach(dir string) ([]ModuleVendorDrift, error) {
+	var w Walker
+	return w.VerifyVendorEach(dir)
+}
+
+// VerifyVendorEach checks the vendor directory of each Go module in dir and its subdirectories
+// for consistency with the module's go.mod file,
+// as the go command does before building with -mod=vendor,
+// and also checks that the packages listed in vendor/modules.txt
+// are the ones actually in the vendor directory.
+// Modules without a vendor/modules.txt file are skipped.
+// The result has an entry for each module checked,
+// in the order [Walker.Each] visits them,
+// including those with no drift.
+//
+// The contents of vendored files are not checked against the modules' sources;
+// running "go mod vendor" and comparing the result does that
+// (see [Walker.VendorEach] with opts.Check set).
+func (w *Walker) VerifyVendorEach(dir string) ([]ModuleVendorDrift, error) {
+	var result []ModuleVendorDrift
+	err := w.EachGomod(dir, func(subdir string, mf *modfile.File) error {
+		vendored, err := readModulesTxt(subdir)
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		drift, err := vendorDrift(subdir, mf, vendored)
+		if err != nil {
+			return err
+		}
+		result = append(result, ModuleVendorDrift{Dir: subdir, Drift: drift})
+		return nil
+	})
+	return result, err
+}
+
+// vendoredModule is a module as listed in vendor/modules.txt.
+type vendoredModule struct {
+	mod      module.Version
+	replace  *module.Version
+	explicit bool
+	packages []string
+}
+
+// readModulesTxt parses the vendor/modules.txt file of the module in dir.
+func readModulesTxt(dir string) ([]*vendoredModule, error) {
+	path := filepath.Join(dir, "vendor", "modules.txt")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "reading %s", path)
+	}
+
+	var (
+		result []*vendoredModule
+		cur    *vendoredModule
+	)
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for sc.Scan() {
+		line := sc.Text()
+		switch {
+		case strings.HasPrefix(line, "## "):
+			if cur == nil {
+				continue
+			}
+			for _, annotation := range strings.Split(strings.TrimPrefix(line, "## "), ";") {
+				if strings.TrimSpace(annotation) == "explicit" {
+					cur.explicit = true
+				}
+			}
+
+		case strings.HasPrefix(line, "# "):
+			// "# path version" or "# path [version] => newpath [newversion]".
+			left, right, isReplace := strings.Cut(strings.TrimPrefix(line, "# "), " => ")
+			fields := strings.Fields(left)
+			if len(fields) == 0 {
+				cur = nil
+				continue
+			}
+			cur = &vendoredModule{mod: module.Version{Path: fields[0]}}
+			if len(fields) > 1 {
+				cur.mod.Version = fields[1]
+			}
+			if isReplace {
+				fields = strings.Fields(right)
+				if len(fields) > 0 {
+					cur.replace = &module.Version{Path: fields[0]}
+					if len(fields) > 1 {
+						cur.replace.Version = fields[1]
+					}
+				}
+			}
+			result = append(result, cur)
+
+		case line != "" && !strings.HasPrefix(line, "#"):
+			if cur != nil {
+				cur.packages = append(cur.packages, line)
+			}
+		}
+	}
+	return result, errors.Wrapf(sc.Err(), "scanning %s", path)
+}
+
+// vendorDrift compares go.mod file mf and the vendored modules of the module in dir.
+func vendorDrift(dir string, mf *modfile.File, vendored []*vendoredModule) ([]VendorDrift, error) {
+	var (
+		result []VendorDrift
+		byPath = make(map[string]*vendoredModule)
+	)
+	for _, vm := range vendored {
+		if vm.mod.Version != "" || byPath[vm.mod.Path] == nil {
+			byPath[vm.mod.Path] = vm
+		}
+	}
+
+	// Explicit requirements are recorded starting with go 1.14.
+	checkExplicit := mf.Go != nil && compareGoVersions(mf.Go.Version, "1.14") >= 0
+
+	required := make(map[string]bool)
+	for _, req := range mf.Require {
+		required[req.Mod.Path] = true
+		vm := byPath[req.Mod.Path]
+		switch {
+		case vm == nil || vm.mod.Version == "":
+			result = append(result, VendorDrift{Kind: VendorMissingModule, Path: req.Mod.Path, Expected: req.Mod.Version})
+		case vm.mod.Version != req.Mod.Version:
+			result = append(result, VendorDrift{Kind: VendorVersionMismatch, Path: req.Mod.Path, Expected: req.Mod.Version, Found: vm.mod.Version})
+		case checkExplicit && !vm.explicit:
+			result = append(result, VendorDrift{Kind: VendorNotExplicit, Path: req.Mod.Path, Expected: req.Mod.Version, Found: vm.mod.Version})
+		}
+	}
+
+	for _, vm := range vendored {
+		if checkExplicit && vm.explicit && !required[vm.mod.Path] {
+			result = append(result, VendorDrift{Kind: VendorExtraModule, Path: vm.mod.Path, Found: vm.mod.Version})
+		}
+
+		var want *module.Version
+		if vm.mod.Version == "" {
+			// A wildcard replacement recorded for a module not in the build list.
+			for _, rep := range mf.Replace {
+				if rep.Old.Path == vm.mod.Path && rep.Old.Version == "" {
+					want = &rep.New
+				}
+			}
+		} else if rep := findReplace(mf, vm.mod.Path, vm.mod.Version); rep != nil {
+			want = &rep.New
+		}
+		if !sameVersion(want, vm.replace) {
+			result = append(result, VendorDrift{Kind: VendorReplaceMismatch, Path: vm.mod.Path, Expected: versionString(want), Found: versionString(vm.replace)})
+		}
+	}
+
+	// Starting with go 1.17, replacements are recorded even for modules that provide no packages.
+	// Those for vendored modules were compared above.
+	if mf.Go != nil && compareGoVersions(mf.Go.Version, "1.17") >= 0 {
+		for _, rep := range mf.Replace {
+			if rep.Old.Version == "" && byPath[rep.Old.Path] == nil {
+				result = append(result, VendorDrift{Kind: VendorReplaceMismatch, Path: rep.Old.Path, Expected: versionString(&rep.New)})
+			}
+		}
+	}
+
+	listed := make(map[string]bool)
+	vendorDir := filepath.Join(dir, "vendor")
+	for _, vm := range vendored {
+		for _, pkg := range vm.packages {
+			listed[pkg] = true
+			ok, err := hasGoFilesIn(filepath.Join(vendorDir, filepath.FromSlash(pkg)))
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				result = append(result, VendorDrift{Kind: VendorMissingPackage, Path: pkg})
+			}
+		}
+	}
+	err := filepath.WalkDir(vendorDir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !entry.IsDir() || path == vendorDir {
+			return nil
+		}
+		rel, err := filepath.Rel(vendorDir, path)
+		if err != nil {
+			return err
+		}
+		pkg := filepath.ToSlash(rel)
+		if listed[pkg] {
+			return nil
+		}
+		ok, err := hasGoFilesIn(path)
+		if err != nil {
+			return err
+		}
+		if ok {
+			result = append(result, VendorDrift{Kind: VendorExtraPackage, Path: pkg})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "walking %s", vendorDir)
+	}
+
+	sort.SliceStable(result, func(i, j int) bool {
+		if result[i].Path != result[j].Path {
+			return result[i].Path < result[j].Path
+		}
+		return result[i].Kind < result[j].Kind
+	})
+	return result, nil
+}
+
+// hasGoFilesIn tells whether dir directly contains any .go files.
+// It returns false if dir does not exist.
+func hasGoFilesIn(dir string) (bool, error) {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, errors.Wrapf(err, "reading directory %s", dir)
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".go") {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func sameVersion(a, b *module.Version) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+// versionString renders mod in "path version" form,
+// or as just the path if it has no version,
+// or as the empty string if mod is nil.
+func versionString(mod *module.Version) string {
+	if mod == nil {
+		return ""
+	}
+	if mod.Version == "" {
+		return mod.Path
+	}
+	return mod.Path + " " + mod.Version
+}
+
+// VendorOptions are options for [Walker.VendorEach].
+type VendorOptions struct {
+	// All, if true,
+	// vendors every module,
+	// not only those that already have a vendor/modules.txt file.
+	All bool
+
+	// Check, if true,
+	// reports what vendoring would change without changing anything.
+	Check bool
+
+	// Concurrency is the number of modules to vendor at once.
+	// If it is zero or negative,
+	// [Walker.Concurrency] is used instead.
+	Concurrency int
+}
+
+// VendorResult is the result of [Walker.VendorEach] for a single module.
+type VendorResult struct {
+	// Dir is the module's directory.
+	Dir string
+
+	// Changes are the paths of the files in the vendor directory
+	// that vendoring adds, removes, or modifies,
+	// relative to the vendor directory,
+	// with forward slashes,
+	// sorted.
+	Changes []string
+}
+
+// VendorEach vendors the dependencies of the Go modules in dir and its subdirectories.
+// This function calls Walker.VendorEach with a default Walker.
+func VendorEach(ctx context.Context, dir string, opts VendorOptions) ([]VendorResult, error) {
+	var w Walker
+	return w.VendorEach(ctx, dir, opts)
+}
+
+// VendorEach vendors the dependencies of the Go modules in dir and its subdirectories,
+// as "go mod vendor" does,
+// for the modules that already vendor
+// (or for all modules, if opts.All is true).
+// The result has an entry for each module vendored,
+// in the order [Walker.Each] visits them,
+// reporting what changed
+// (or with opts.Check, what would change).
+//
+// Each module is vendored into a temporary directory first,
+// which replaces the module's vendor directory only if the contents differ
+// and opts.Check is false.
+// The go command runs in each module with GOWORK=off,
+// and with the settings in w.Env and w.GOFLAGS,
+// and the environment in w.LoadConfig.
+func (w *Walker) VendorEach(ctx context.Context, dir string, opts VendorOptions) ([]VendorResult, error) {
+	var dirs []string
+	err := w.Each(dir, func(subdir string) error {
+		if !opts.All {
+			if _, err := os.Stat(filepath.Join(subdir, "vendor", "modules.txt")); err != nil {
+				return nil
+			}
+		}
+		dirs = append(dirs, subdir)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ww := *w
+	ww.GOWORK = "off"
+
+	var (
+		result   = make([]VendorResult, len(dirs))
+		g, gctx  = errgroup.WithContext(ctx)
+		parallel = opts.Concurrency
+	)
+	if parallel < 1 {
+		parallel = w.Concurrency
+	}
+	if parallel < 1 {
+		parallel = 1
+	}
+	g.SetLimit(parallel)
+	for i, subdir := range dirs {
+		i, subdir := i, subdir
+		g.Go(func() error {
+			changes, err := ww.vendor(gctx, subdir, opts.Check)
+			if err != nil {
+				return errors.Wrapf(err, "vendoring %s", subdir)
+			}
+			result[i] = VendorResult{Dir: subdir, Changes: changes}
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// vendor vendors the module in dir,
+// returning the changes to its vendor directory.
+// If check is true,
+// the vendor directory is left unchanged.
+func (w *Walker) vendor(ctx context.Context, dir string, check bool) ([]string, error) {
+	// Within dir, so it can be renamed into place,
+	// and with a leading dot, so it's ignored by the go command.
+	tmpdir, err := os.MkdirTemp(dir, ".vendor")
+	if err != nil {
+		return nil, errors.Wrap(err, "creating temp dir")
+	}
+	defer os.RemoveAll(tmpdir)
+
+	newVendor := filepath.Join(tmpdir, "vendor")
+	if _, err := w.goCmdContext(ctx, dir, "mod", "vendor", "-o", newVendor); err != nil {
+		return nil, err
+	}
+
+	vendorDir := filepath.Join(dir, "vendor")
+	changes, err := diffDirs(vendorDir, newVendor)
+	if err != nil {
+		return nil, err
+	}
+	if check || len(changes) == 0 {
+		return changes, nil
+	}
+
+	if err := os.RemoveAll(vendorDir); err != nil {
+		return nil, errors.Wrapf(err, "removing %s", vendorDir)
+	}
+	if _, err := os.Stat(newVendor); errors.Is(err, fs.ErrNotExist) {
+		return changes, nil // no dependencies to vendor
+	}
+	return changes, errors.Wrapf(os.Rename(newVendor, vendorDir), "renaming %s to %s", newVendor, vendorDir)
+}
+
+// diffDirs returns the paths of the regular files that differ between directories a and b,
+// relative to them,
+// with forward slashes,
+// sorted.
+// A directory that does not exist is treated as empty.
+func diffDirs(a, b string) ([]string, error) {
+	filesA, err := dirFiles(a)
+	if err != nil {
+		return nil, err
+	}
+	filesB, err := dirFiles(b)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []string
+	for rel := range filesA {
+		if !filesB[rel] {
+			result = append(result, rel)
+		}
+	}
+	for rel := range filesB {
+		if !filesA[rel] {
+			result = append(result, rel)
+			continue
+		}
+		dataA, err := os.ReadFile(filepath.Join(a, filepath.FromSlash(rel)))
+		if err != nil {
+			return nil, errors.Wrapf(err, "reading %s", rel)
+		}
+		dataB, err := os.ReadFile(filepath.Join(b, filepath.FromSlash(rel)))
+		if err != nil {
+			return nil, errors.Wrapf(err, "reading %s", rel)
+		}
+		if !bytes.Equal(dataA, dataB) {
+			result = append(result, rel)
+		}
+	}
+	sort.Strings(result)
+	return result, nil
+}
+
+// dirFiles returns the set of regular files in dir and its subdirectories,
+// relative to dir,
+// with forward slashes.
+// It returns an empty set if dir does not exist.
+func dirFiles(dir string) (map[string]bool, error) {
+	result := make(map[string]bool)
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if errors.Is(err, fs.ErrNotExist) && path == dir {
+			return filepath.SkipAll
+		}
+		if err != nil {
+			return err
+		}
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		result[filepath.ToSlash(rel)] = true
+		return nil
+	})
+	return result, errors.Wrapf(err, "walking %s", dir)
+}
@@ -0,0 +1,145 @@
+package modules
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"golang.org/x/mod/modfile"
+	"golang.org/x/tools/go/packages"
+)
+
+// Visit describes a Go module found by [Walker.EachVisit].
+// New fields may be added in the future,
+// so callers should not create Visit values themselves.
+type Visit struct {
+	// Root is the directory the walk started in.
+	Root string
+
+	// Dir is the directory containing the module's go.mod file,
+	// which will have Root as a prefix.
+	Dir string
+
+	// Depth is the number of directory levels between Root and Dir.
+	// It is 0 when Dir is Root.
+	Depth int
+
+	// Index is the number of modules visited before this one.
+	Index int
+
+	// Skipped are the names of the subdirectories of Dir
+	// that the walk does not enter,
+	// such as vendor and testdata directories,
+	// those beginning with "." or "_",
+	// and those excluded by [IgnoreFileName] files
+	// (see [Walker.IncludeVendor], [Walker.IncludeTestdata], and [Walker.NoIgnoreFiles]),
+	// and git submodule checkouts when [Walker.Submodules] is [SubmoduleSkip].
+	Skipped []string
+
+	// Submodule is the top directory of the git submodule checkout containing Dir
+	// (which may be Dir itself or Root),
+	// or the empty string if Dir is not in a submodule checkout at or below Root.
+	// Modules in submodules typically have their own release process,
+	// separate from that of the superproject.
+	Submodule string
+
+	// Gomod parses the module's go.mod file,
+	// as [Walker.EachGomod] does.
+	// Calling it more than once returns the same result without reparsing.
+	Gomod func() (*modfile.File, error)
+
+	// Packages loads the module's packages,
+	// as [Walker.LoadEach] does.
+	// Packages are loaded only if this is called,
+	// and calling it more than once returns the same result without reloading.
+	Packages func() ([]*packages.Package, error)
+}
+
+// EachVisit calls f for each Go module in dir and its subdirectories,
+// passing it a [Visit] describing the module.
+// This function calls Walker.EachVisit with a default Walker.
+func EachVisit(dir string, f func(Visit) error) error {
+	var w Walker
+	return w.EachVisit(dir, f)
+}
+
+// EachVisit calls f for each Go module in dir and its subdirectories,
+// passing it a [Visit] describing the module.
+// It visits modules in the same order as [Walker.Each],
+// and f may return [filepath.SkipDir] or [filepath.SkipAll] in the same way.
+//
+// Unlike the callbacks of [Walker.Each], [Walker.EachGomod], and [Walker.LoadEach],
+// the Visit type can grow to carry more information
+// without changing the signature of f.
+func (w *Walker) EachVisit(dir string, f func(Visit) error) error {
+	var (
+		index      int
+		ig         = w.newIgnorer(dir)
+		submodules = make(map[string]bool)
+	)
+	return w.Each(dir, func(subdir string) error {
+		v := Visit{
+			Root:  dir,
+			Dir:   subdir,
+			Depth: visitDepth(dir, subdir),
+			Index: index,
+		}
+		index++
+
+		var err error
+		if v.Submodule, err = submoduleOf(dir, subdir, submodules); err != nil {
+			return err
+		}
+
+		entries, err := os.ReadDir(subdir)
+		if err != nil {
+			return WalkError{Dir: subdir, Op: "reading directory", Err: err}
+		}
+		for _, entry := range entries {
+			if !entry.IsDir() {
+				continue
+			}
+			if skip, err := w.skipDir(ig, filepath.Join(subdir, entry.Name())); err != nil {
+				return err
+			} else if skip {
+				v.Skipped = append(v.Skipped, entry.Name())
+			}
+		}
+
+		var (
+			gomodOnce sync.Once
+			mf        *modfile.File
+			gomodErr  error
+		)
+		v.Gomod = func() (*modfile.File, error) {
+			gomodOnce.Do(func() {
+				_, mf, gomodErr = w.readGomod(subdir)
+			})
+			return mf, gomodErr
+		}
+
+		var (
+			loadOnce sync.Once
+			pkgs     []*packages.Package
+			loadErr  error
+		)
+		v.Packages = func() ([]*packages.Package, error) {
+			loadOnce.Do(func() {
+				pkgs, loadErr = w.load(subdir, 0)
+			})
+			return pkgs, loadErr
+		}
+
+		return f(v)
+	})
+}
+
+// visitDepth is the number of directory levels between root and dir.
+func visitDepth(root, dir string) int {
+	rel, err := filepath.Rel(root, dir)
+	if err != nil || rel == "." {
+		return 0
+	}
+	return strings.Count(rel, string(filepath.Separator)) + 1
+}
@@ -0,0 +1,287 @@
+package modules
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/bobg/errors"
+	"golang.org/x/vuln/scan"
+)
+
+// VulnFinding is a known vulnerability affecting a Go module.
+// See [Walker.VulnEach].
+type VulnFinding struct {
+	// ID is the vulnerability's identifier in the Go vulnerability database,
+	// such as "GO-2023-1234".
+	ID string
+
+	// Aliases are other identifiers for the vulnerability,
+	// such as CVE and GHSA numbers.
+	Aliases []string
+
+	// Summary is a short description of the vulnerability.
+	Summary string
+
+	// Module and Version identify the vulnerable dependency.
+	// For vulnerabilities in the standard library,
+	// Module is "stdlib".
+	Module  string
+	Version string
+
+	// FixedVersion is the earliest version of Module without the vulnerability,
+	// or the empty string if there is none.
+	FixedVersion string
+
+	// Packages are the vulnerable packages imported by the module,
+	// sorted.
+	// It is empty if the module requires Module
+	// but imports none of its vulnerable packages.
+	Packages []string
+
+	// Called tells whether the module's code calls a vulnerable function.
+	// If false,
+	// the module imports a vulnerable package,
+	// or only requires a vulnerable module
+	// (when Packages is empty),
+	// but does not reach the vulnerable code.
+	Called bool
+
+	// Traces are call stacks leading to vulnerable functions,
+	// one per vulnerable function called.
+	// Each begins with the vulnerable function and ends in the module's own code.
+	// Traces is empty when Called is false.
+	Traces [][]VulnFrame
+}
+
+// VulnFrame is a frame in a call stack in a [VulnFinding].
+type VulnFrame struct {
+	// Module, Version, and Package identify the package containing the function.
+	Module  string
+	Version string
+	Package string
+
+	// Function is the name of the function,
+	// qualified with the name of its receiver type if it is a method,
+	// as in "Reader.Read".
+	Function string
+
+	// Position is the source position of the call in this frame,
+	// as "file:line:column",
+	// or the empty string if unknown.
+	Position string
+}
+
+// VulnSummary summarizes the results of [Walker.VulnEach].
+type VulnSummary struct {
+	// Modules is the number of modules scanned.
+	Modules int
+
+	// Affected is the number of modules with at least one finding,
+	// whether or not it is called
+	// (see [VulnFinding.Called]).
+	Affected int
+
+	// Called is the number of modules calling vulnerable code.
+	Called int
+
+	// ByID maps the ID of each vulnerability found
+	// to the directories of the modules it affects.
+	ByID map[string][]string
+}
+
+// VulnEach scans each Go module in dir and its subdirectories for known vulnerabilities.
+// This function calls Walker.VulnEach with a default Walker.
+func VulnEach(ctx context.Context, dir string, f func(string, []VulnFinding) error) (*VulnSummary, error) {
+	var w Walker
+	return w.VulnEach(ctx, dir, f)
+}
+
+// VulnEach scans each Go module in dir and its subdirectories for known vulnerabilities,
+// using govulncheck
+// (via [golang.org/x/vuln/scan])
+// and the Go vulnerability database.
+// The callback receives the module's directory
+// (which will have dir as a prefix)
+// and its findings,
+// sorted by ID.
+// It is called for every module,
+// including those with no findings.
+//
+// The scan covers the packages that [Walker.LoadEach] would load.
+// The settings in w.Env, w.GOFLAGS, and w.GOWORK,
+// and the environment in w.LoadConfig,
+// are used when running the scan.
+//
+// The result summarizes the findings across all modules.
+func (w *Walker) VulnEach(ctx context.Context, dir string, f func(string, []VulnFinding) error) (*VulnSummary, error) {
+	summary := &VulnSummary{ByID: make(map[string][]string)}
+
+	err := w.Each(dir, func(subdir string) error {
+		findings, err := w.vulnScan(ctx, subdir)
+		if err != nil {
+			return errors.Wrapf(err, "scanning %s", subdir)
+		}
+
+		summary.Modules++
+		if len(findings) > 0 {
+			summary.Affected++
+		}
+		for _, finding := range findings {
+			if finding.Called {
+				summary.Called++
+				break
+			}
+		}
+		for _, finding := range findings {
+			summary.ByID[finding.ID] = append(summary.ByID[finding.ID], subdir)
+		}
+
+		return f(subdir, findings)
+	})
+	return summary, err
+}
+
+// vulnScan runs govulncheck on the module in dir.
+func (w *Walker) vulnScan(ctx context.Context, dir string) ([]VulnFinding, error) {
+	args := []string{"-C", dir, "-json"}
+	if w.LoadTests {
+		args = append(args, "-test")
+	}
+	args = append(args, w.loadPatterns(dir)...)
+
+	var stdout, stderr bytes.Buffer
+	cmd := scan.Command(ctx, args...)
+	cmd.Stdin = strings.NewReader("")
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	cmd.Env = w.loadEnv(w.LoadConfig.Env)
+
+	if err := cmd.Start(); err != nil {
+		return nil, errors.Wrap(err, "starting govulncheck")
+	}
+	if err := cmd.Wait(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, errors.Wrapf(err, "running govulncheck: %s", msg)
+		}
+		return nil, errors.Wrap(err, "running govulncheck")
+	}
+
+	return decodeVulnStream(&stdout)
+}
+
+// These types mirror the parts of govulncheck's JSON output that VulnEach uses.
+
+type vulnMessage struct {
+	OSV     *vulnOSV     `json:"osv"`
+	Finding *vulnFinding `json:"finding"`
+}
+
+type vulnOSV struct {
+	ID      string   `json:"id"`
+	Aliases []string `json:"aliases"`
+	Summary string   `json:"summary"`
+}
+
+type vulnFinding struct {
+	OSV          string       `json:"osv"`
+	FixedVersion string       `json:"fixed_version"`
+	Trace        []*vulnFrame `json:"trace"`
+}
+
+type vulnFrame struct {
+	Module   string `json:"module"`
+	Version  string `json:"version"`
+	Package  string `json:"package"`
+	Function string `json:"function"`
+	Receiver string `json:"receiver"`
+	Position *struct {
+		Filename string `json:"filename"`
+		Line     int    `json:"line"`
+		Column   int    `json:"column"`
+	} `json:"position"`
+}
+
+// decodeVulnStream reads govulncheck's JSON output from r,
+// combining the findings for each vulnerability into a single VulnFinding.
+func decodeVulnStream(r io.Reader) ([]VulnFinding, error) {
+	var (
+		dec  = json.NewDecoder(r)
+		osvs = make(map[string]*vulnOSV)
+		byID = make(map[string]*VulnFinding)
+	)
+	for {
+		var msg vulnMessage
+		err := dec.Decode(&msg)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "decoding govulncheck output")
+		}
+
+		if msg.OSV != nil {
+			osvs[msg.OSV.ID] = msg.OSV
+		}
+		if msg.Finding == nil || len(msg.Finding.Trace) == 0 {
+			continue
+		}
+
+		vf, ok := byID[msg.Finding.OSV]
+		if !ok {
+			vf = &VulnFinding{ID: msg.Finding.OSV}
+			byID[vf.ID] = vf
+		}
+		if vf.FixedVersion == "" {
+			vf.FixedVersion = msg.Finding.FixedVersion
+		}
+
+		top := msg.Finding.Trace[0]
+		if vf.Module == "" {
+			vf.Module, vf.Version = top.Module, top.Version
+		}
+		if top.Package != "" && !slices.Contains(vf.Packages, top.Package) {
+			vf.Packages = append(vf.Packages, top.Package)
+		}
+		if top.Function == "" {
+			continue
+		}
+
+		vf.Called = true
+		trace := make([]VulnFrame, 0, len(msg.Finding.Trace))
+		for _, fr := range msg.Finding.Trace {
+			frame := VulnFrame{
+				Module:   fr.Module,
+				Version:  fr.Version,
+				Package:  fr.Package,
+				Function: fr.Function,
+			}
+			if fr.Receiver != "" {
+				frame.Function = strings.TrimPrefix(fr.Receiver, "*") + "." + fr.Function
+			}
+			if fr.Position != nil && fr.Position.Filename != "" {
+				frame.Position = fmt.Sprintf("%s:%d:%d", fr.Position.Filename, fr.Position.Line, fr.Position.Column)
+			}
+			trace = append(trace, frame)
+		}
+		vf.Traces = append(vf.Traces, trace)
+	}
+
+	result := make([]VulnFinding, 0, len(byID))
+	for id, vf := range byID {
+		if o, ok := osvs[id]; ok {
+			vf.Aliases, vf.Summary = o.Aliases, o.Summary
+		}
+		sort.Strings(vf.Packages)
+		result = append(result, *vf)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].ID < result[j].ID
+	})
+	return result, nil
+}
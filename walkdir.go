@@ -0,0 +1,95 @@
+package modules
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/bobg/errors"
+)
+
+// WalkDir walks the tree rooted at dir like [filepath.WalkDir],
+// but calls fn only for Go module directories.
+// This function calls Walker.WalkDir with a default Walker.
+func WalkDir(dir string, fn fs.WalkDirFunc) error {
+	var w Walker
+	return w.WalkDir(dir, fn)
+}
+
+// WalkDir walks the tree rooted at dir like [filepath.WalkDir],
+// but calls fn only for Go module directories,
+// in the same order as [Walker.Each]
+// and skipping the same subdirectories.
+// The path passed to fn is a module directory,
+// which will have dir as a prefix,
+// and the [fs.DirEntry] describes it.
+//
+// As with [filepath.WalkDir],
+// if fn returns [fs.SkipDir],
+// the walk skips the subdirectories of the module,
+// including any nested modules;
+// and if it returns [fs.SkipAll],
+// the walk stops with no error.
+// If a directory in the tree cannot be read,
+// fn is called for it with a non-nil error,
+// even if it is not a module directory,
+// and fn decides how to proceed.
+// Links are handled according to w.Links.
+func (w *Walker) WalkDir(dir string, fn fs.WalkDirFunc) (err error) {
+	if w.Metrics != nil {
+		start := time.Now()
+		defer func() { w.Metrics.ObserveWalk(dir, time.Since(start), err) }()
+	}
+
+	if info, statErr := os.Stat(osPath(dir)); statErr != nil {
+		err = fn(dir, nil, statErr)
+	} else {
+		err = w.walkDir(w.newWalkState(dir), dir, fs.FileInfoToDirEntry(info), fn)
+	}
+	if errors.Is(err, fs.SkipDir) || errors.Is(err, fs.SkipAll) {
+		return nil
+	}
+	return err
+}
+
+func (w *Walker) walkDir(ws *walkState, dir string, d fs.DirEntry, fn fs.WalkDirFunc) error {
+	if first, err := ws.firstVisit(dir); err != nil {
+		return fn(dir, d, err)
+	} else if !first {
+		w.logRevisit(dir)
+		return nil
+	}
+	w.log(LevelTrace, "visiting directory", "dir", dir)
+
+	found, entries, readErr := w.subdirs(ws, dir, "go.mod")
+	if readErr != nil {
+		var err error
+		if found, err = hasFile(dir, "go.mod"); err != nil {
+			return skipDirOK(fn(dir, d, err))
+		}
+	}
+	if found {
+		if err := fn(dir, d, nil); err != nil {
+			return skipDirOK(err)
+		}
+	}
+	if readErr != nil {
+		return skipDirOK(fn(dir, d, readErr))
+	}
+	for _, entry := range entries {
+		if err := w.walkDir(ws, filepath.Join(dir, entry.Name()), entry, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// skipDirOK returns nil if err is [fs.SkipDir],
+// and err otherwise.
+func skipDirOK(err error) error {
+	if errors.Is(err, fs.SkipDir) {
+		return nil
+	}
+	return err
+}
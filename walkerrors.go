@@ -0,0 +1,63 @@
+package modules
+
+import (
+	"fmt"
+
+	"github.com/bobg/errors"
+)
+
+// WalkError is an error encountered while walking a tree of Go modules,
+// including an error returned by a callback.
+// Use [errors.As] to get the directory where it happened.
+type WalkError struct {
+	// Dir is the directory being walked when the error happened.
+	// For an error from a callback,
+	// this is the module directory passed to it.
+	Dir string
+
+	// Op is the operation that failed,
+	// such as "visiting" for an error from a callback,
+	// or "reading directory".
+	Op string
+
+	Err error
+}
+
+func (e WalkError) Error() string {
+	return fmt.Sprintf("%s %s: %s", e.Op, e.Dir, e.Err)
+}
+
+func (e WalkError) Unwrap() error {
+	return e.Err
+}
+
+// visitError wraps err,
+// from visiting the module in dir,
+// in a [WalkError]
+// unless it already is one for dir.
+func visitError(dir string, err error) error {
+	var walkErr WalkError
+	if errors.As(err, &walkErr) && walkErr.Dir == dir {
+		return err
+	}
+	return WalkError{Dir: dir, Op: "visiting", Err: err}
+}
+
+// ParseError is an error parsing a go.mod or go.work file.
+// Use [errors.As] to get the file's path.
+type ParseError struct {
+	// GomodPath is the path of the go.mod
+	// (or go.work)
+	// file.
+	GomodPath string
+
+	Err error
+}
+
+func (e ParseError) Error() string {
+	return fmt.Sprintf("parsing %s: %s", e.GomodPath, e.Err)
+}
+
+func (e ParseError) Unwrap() error {
+	return e.Err
+}
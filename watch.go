@@ -0,0 +1,316 @@
+package modules
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bobg/errors"
+	"github.com/fsnotify/fsnotify"
+)
+
+// WatchEventKind is the kind of a [WatchEvent].
+type WatchEventKind int
+
+const (
+	// ModuleAdded means a new module appeared in the tree.
+	ModuleAdded WatchEventKind = iota + 1
+
+	// ModuleRemoved means a module disappeared from the tree.
+	ModuleRemoved
+
+	// GomodChanged means a module's go.mod file changed.
+	GomodChanged
+
+	// PackagesChanged means Go files in a module were created, changed, or removed.
+	PackagesChanged
+)
+
+func (k WatchEventKind) String() string {
+	switch k {
+	case ModuleAdded:
+		return "added"
+	case ModuleRemoved:
+		return "removed"
+	case GomodChanged:
+		return "go.mod changed"
+	case PackagesChanged:
+		return "packages changed"
+	}
+	return "unknown"
+}
+
+// WatchEvent is a change to the Go modules in a tree.
+// See [Walker.Watch].
+type WatchEvent struct {
+	// Kind is the kind of change.
+	Kind WatchEventKind
+
+	// Dir is the directory containing the module's go.mod file.
+	Dir string
+
+	// Files are the Go files that changed,
+	// sorted.
+	// It is set only for PackagesChanged events.
+	Files []string
+}
+
+// watchDelay is how long [Walker.Watch] waits for filesystem activity to settle
+// before reporting changes.
+// This coalesces the bursts of notifications that a single save,
+// checkout,
+// or build step typically produces.
+const watchDelay = 100 * time.Millisecond
+
+// Watch monitors the Go modules in dir and its subdirectories for changes.
+// This function calls Walker.Watch with a default Walker.
+func Watch(ctx context.Context, dir string, f func(WatchEvent) error) error {
+	var w Walker
+	return w.Watch(ctx, dir, f)
+}
+
+// Watch monitors the Go modules in dir and its subdirectories for changes,
+// using filesystem notifications
+// (via [github.com/fsnotify/fsnotify]),
+// and calls f for each change until ctx is canceled.
+// Directories are skipped as in [Walker.Each].
+// Modules already present when Watch starts are not reported;
+// callers typically use [Walker.Each] for an initial scan.
+//
+// Changes are reported in batches,
+// once filesystem activity has paused briefly,
+// with related notifications coalesced:
+// a module gets at most one event of each kind per batch.
+// Within a batch,
+// removals are reported first,
+// then additions,
+// then go.mod changes,
+// then package changes,
+// each sorted by directory.
+// Changes to Go files are attributed to the innermost module containing them;
+// those outside any module are not reported.
+//
+// If f returns an error,
+// Watch stops and returns it,
+// except that [filepath.SkipAll] stops Watch with no error.
+// Otherwise Watch returns ctx.Err() when ctx is canceled.
+func (w *Walker) Watch(ctx context.Context, dir string, f func(WatchEvent) error) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return errors.Wrap(err, "creating watcher")
+	}
+	defer watcher.Close()
+
+	s := &watchState{
+		w:       w,
+		root:    dir,
+		ig:      w.newIgnorer(dir),
+		watcher: watcher,
+		modules: make(map[string]bool),
+	}
+	s.reset()
+	if err := s.addTree(dir, false); err != nil {
+		return err
+	}
+
+	timer := time.NewTimer(watchDelay)
+	timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+
+		case err := <-watcher.Errors:
+			return errors.Wrap(err, "watching")
+
+		case ev := <-watcher.Events:
+			if err := s.handle(ev); err != nil {
+				return err
+			}
+			timer.Reset(watchDelay)
+
+		case <-timer.C:
+			for _, event := range s.flush() {
+				err := f(event)
+				if errors.Is(err, filepath.SkipAll) {
+					return nil
+				}
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+}
+
+// watchState is the state of a call to [Walker.Watch].
+type watchState struct {
+	w       *Walker
+	root    string
+	ig      *ignorer
+	watcher *fsnotify.Watcher
+
+	// modules is the set of known module directories.
+	modules map[string]bool
+
+	// These accumulate the changes in the current batch.
+	gomods  map[string]bool // directories whose go.mod files were touched
+	removed map[string]bool // paths that were removed or renamed
+	files   map[string]bool // Go files that were touched
+}
+
+func (s *watchState) reset() {
+	s.gomods = make(map[string]bool)
+	s.removed = make(map[string]bool)
+	s.files = make(map[string]bool)
+}
+
+// addTree watches dir and its subdirectories.
+// If isNew is true,
+// dir has just been created,
+// and the go.mod and Go files in it are recorded as changes.
+func (s *watchState) addTree(dir string, isNew bool) error {
+	return filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil // removed while walking
+		}
+		if err != nil {
+			return err
+		}
+		if !entry.IsDir() {
+			if isNew {
+				s.fileChanged(path)
+			}
+			return nil
+		}
+		if path != dir {
+			if skip, err := s.w.skipDir(s.ig, path); err != nil {
+				return err
+			} else if skip {
+				return filepath.SkipDir
+			}
+		}
+		if err := s.watcher.Add(path); err != nil {
+			return errors.Wrapf(err, "watching %s", path)
+		}
+		if !isNew {
+			if _, err := os.Stat(filepath.Join(path, "go.mod")); err == nil {
+				s.modules[path] = true
+			}
+		}
+		return nil
+	})
+}
+
+// handle records the change described by ev.
+func (s *watchState) handle(ev fsnotify.Event) error {
+	if ev.Has(fsnotify.Remove) || ev.Has(fsnotify.Rename) {
+		s.removed[ev.Name] = true
+	}
+	if ev.Has(fsnotify.Create) {
+		info, err := os.Lstat(ev.Name)
+		if err == nil && info.IsDir() {
+			if skip, err := s.w.skipDir(s.ig, ev.Name); err != nil || skip {
+				return err
+			}
+			return s.addTree(ev.Name, true)
+		}
+	}
+	s.fileChanged(ev.Name)
+	return nil
+}
+
+// fileChanged records a change to the file at path.
+func (s *watchState) fileChanged(path string) {
+	name := filepath.Base(path)
+	switch {
+	case name == "go.mod":
+		s.gomods[filepath.Dir(path)] = true
+	case strings.HasSuffix(name, ".go"):
+		s.files[path] = true
+	}
+}
+
+// moduleFor returns the innermost directory containing dir
+// that is a known module directory or is in also,
+// or the empty string if there is none.
+func (s *watchState) moduleFor(dir string, also map[string]bool) string {
+	for {
+		if s.modules[dir] || also[dir] {
+			return dir
+		}
+		if dir == s.root {
+			return ""
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// flush returns the events for the changes in the current batch,
+// updating the set of known modules,
+// and starts a new batch.
+func (s *watchState) flush() []WatchEvent {
+	var (
+		added, removed, gomodChanged []string
+		skip                         = make(map[string]bool) // modules whose Go file changes are not reported
+	)
+
+	for path := range s.removed {
+		for modDir := range s.modules {
+			if rel, err := filepath.Rel(path, modDir); err == nil && filepath.IsLocal(rel) {
+				s.gomods[modDir] = true
+			}
+		}
+	}
+	for modDir := range s.gomods {
+		_, err := os.Stat(filepath.Join(modDir, "go.mod"))
+		switch {
+		case err == nil && s.modules[modDir]:
+			gomodChanged = append(gomodChanged, modDir)
+		case err == nil:
+			s.modules[modDir] = true
+			skip[modDir] = true
+			added = append(added, modDir)
+		case s.modules[modDir]:
+			delete(s.modules, modDir)
+			skip[modDir] = true
+			removed = append(removed, modDir)
+		}
+	}
+
+	changed := make(map[string][]string)
+	for path := range s.files {
+		if modDir := s.moduleFor(filepath.Dir(path), skip); modDir != "" && !skip[modDir] {
+			changed[modDir] = append(changed[modDir], path)
+		}
+	}
+
+	var result []WatchEvent
+	appendEvents := func(kind WatchEventKind, dirs []string) {
+		sort.Strings(dirs)
+		for _, d := range dirs {
+			result = append(result, WatchEvent{Kind: kind, Dir: d})
+		}
+	}
+	appendEvents(ModuleRemoved, removed)
+	appendEvents(ModuleAdded, added)
+	appendEvents(GomodChanged, gomodChanged)
+
+	for _, modDir := range sortedKeys(changed) {
+		files := changed[modDir]
+		sort.Strings(files)
+		result = append(result, WatchEvent{Kind: PackagesChanged, Dir: modDir, Files: files})
+	}
+
+	s.reset()
+	return result
+}
@@ -0,0 +1,150 @@
+package modules
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+
+	"github.com/bobg/errors"
+	"golang.org/x/mod/modfile"
+)
+
+// WhyResult explains why a Go module depends on a target module.
+// See [Walker.WhyEach].
+type WhyResult struct {
+	// Dir is the module's directory.
+	Dir string
+
+	// Requires is the shortest chain of requirements from the module to the target,
+	// as module paths with versions
+	// (except for the module itself, which is first and has no version),
+	// such as ["example.com/a", "golang.org/x/tools@v0.13.0", "golang.org/x/mod@v0.12.0"].
+	// It is empty if the target is not in the module's requirement graph at all.
+	Requires []string
+
+	// Packages is the shortest chain of imports from a package in the module
+	// to a package in the target,
+	// as reported by "go mod why -m".
+	// It is empty if the module's packages
+	// (and their tests)
+	// do not import the target,
+	// in which case the target is at most a requirement that builds do not use.
+	Packages []string
+}
+
+// Needed tells whether the module depends on the target at all.
+func (r WhyResult) Needed() bool {
+	return len(r.Requires) > 0 || len(r.Packages) > 0
+}
+
+// WhyEach explains why each Go module in dir and its subdirectories depends on the module target.
+// This function calls Walker.WhyEach with a default Walker.
+func WhyEach(dir, target string) ([]WhyResult, error) {
+	var w Walker
+	return w.WhyEach(dir, target)
+}
+
+// WhyEach explains why each Go module in dir and its subdirectories depends on the module with path target,
+// reporting for each one the shortest import chain
+// (from "go mod why -m")
+// and the shortest requirement chain
+// (from "go mod graph")
+// leading to it.
+// The result has one entry per module,
+// in the order [Walker.Each] visits them,
+// including modules that do not depend on target;
+// see [WhyResult.Needed].
+//
+// The go commands run with the settings in w.Env, w.GOFLAGS, and w.GOWORK,
+// and the environment in w.LoadConfig.
+func (w *Walker) WhyEach(dir, target string) ([]WhyResult, error) {
+	var result []WhyResult
+	err := w.EachGomod(dir, func(subdir string, mf *modfile.File) error {
+		res := WhyResult{Dir: subdir}
+
+		out, err := w.goCmd(subdir, "mod", "why", "-m", target)
+		if err != nil {
+			return err
+		}
+		res.Packages = parseModWhy(out)
+
+		out, err = w.goCmd(subdir, "mod", "graph")
+		if err != nil {
+			return err
+		}
+		var modPath string
+		if mf.Module != nil {
+			modPath = mf.Module.Mod.Path
+		}
+		res.Requires, err = requireChain(out, modPath, target)
+		if err != nil {
+			return errors.Wrapf(err, "parsing module graph of %s", subdir)
+		}
+
+		result = append(result, res)
+		return nil
+	})
+	return result, err
+}
+
+// parseModWhy parses the output of "go mod why -m" for a single module,
+// returning the import chain it shows,
+// or nil if the main module does not need the module.
+func parseModWhy(out []byte) []string {
+	var result []string
+	sc := bufio.NewScanner(bytes.NewReader(out))
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasPrefix(line, "(") {
+			return nil // "(main module does not need module ...)"
+		}
+		result = append(result, line)
+	}
+	return result
+}
+
+// requireChain finds the shortest path from the main module modPath
+// to any version of the module target
+// in the output of "go mod graph",
+// returning nil if there is none.
+func requireChain(graph []byte, modPath, target string) ([]string, error) {
+	edges := make(map[string][]string)
+	sc := bufio.NewScanner(bytes.NewReader(graph))
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) != 2 {
+			continue
+		}
+		edges[fields[0]] = append(edges[fields[0]], fields[1])
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+
+	// Breadth-first search.
+	var (
+		prev  = map[string]string{modPath: ""}
+		queue = []string{modPath}
+	)
+	for len(queue) > 0 {
+		node := queue[0]
+		queue = queue[1:]
+		if path, _, _ := strings.Cut(node, "@"); path == target && node != modPath {
+			var chain []string
+			for n := node; n != ""; n = prev[n] {
+				chain = append([]string{n}, chain...)
+			}
+			return chain, nil
+		}
+		for _, next := range edges[node] {
+			if _, ok := prev[next]; !ok {
+				prev[next] = node
+				queue = append(queue, next)
+			}
+		}
+	}
+	return nil, nil
+}
@@ -0,0 +1,192 @@
+package modules
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bobg/errors"
+	"golang.org/x/mod/modfile"
+	"golang.org/x/mod/semver"
+	"golang.org/x/tools/go/packages"
+)
+
+// LoadAllWorkspace is like [Walker.LoadEach],
+// but loads the packages of all Go modules in dir and its subdirectories
+// with a single call to [packages.Load].
+// This function calls Walker.LoadAllWorkspace with a default Walker.
+func LoadAllWorkspace(dir string, f func(string, []*packages.Package) error) error {
+	var w Walker
+	return w.LoadAllWorkspace(dir, f)
+}
+
+// LoadAllWorkspace is like [Walker.LoadEach],
+// but loads the packages of all Go modules in dir and its subdirectories
+// with a single call to [packages.Load].
+// This can be much faster than loading each module separately,
+// since the underlying go list invocation is done only once.
+//
+// It works by synthesizing a temporary go.work file that uses every module found,
+// and loading the packages of all modules in that workspace.
+// The results are then partitioned by module,
+// and f is called once for each module,
+// in the same order as [Walker.Each] would visit them.
+// If f returns [filepath.SkipDir],
+// modules nested within the current one are skipped.
+// If f returns [filepath.SkipAll],
+// LoadAllWorkspace returns early with no error.
+//
+// Note that in workspace mode
+// dependency versions are selected across all modules together,
+// so results may differ from those of [Walker.LoadEach].
+// Also, all packages in each module are loaded;
+// w.LoadPatterns and w.PatternsFor are not used.
+func (w *Walker) LoadAllWorkspace(dir string, f func(string, []*packages.Package) error) error {
+	var (
+		dirs      []string
+		goVersion string
+	)
+	err := w.EachGomod(dir, func(subdir string, mf *modfile.File) error {
+		dirs = append(dirs, subdir)
+		if mf.Go != nil && compareGoVersions(mf.Go.Version, goVersion) > 0 {
+			goVersion = mf.Go.Version
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if len(dirs) == 0 {
+		return nil
+	}
+
+	tmpdir, err := os.MkdirTemp("", "modules")
+	if err != nil {
+		return errors.Wrap(err, "creating temp dir")
+	}
+	defer os.RemoveAll(tmpdir)
+
+	goworkPath, absDirs, err := writeTempGowork(tmpdir, dirs, goVersion)
+	if err != nil {
+		return err
+	}
+	var patterns []string
+	for _, subdir := range dirs {
+		absDir, err := filepath.Abs(subdir)
+		if err != nil {
+			return errors.Wrapf(err, "getting absolute path of %s", subdir)
+		}
+		patterns = append(patterns, filepath.ToSlash(absDir)+"/...")
+	}
+
+	conf := w.loadConfig(dir, 0)
+	env := conf.Env
+	if env == nil {
+		env = os.Environ()
+	}
+	conf.Env = append(workspaceEnv(env), "GOWORK="+goworkPath)
+
+	pkgs, err := packages.Load(&conf, patterns...)
+	if err != nil {
+		return errors.Wrapf(err, "loading packages in %s", dir)
+	}
+	if err := w.checkPackageErrors(pkgs); err != nil {
+		return err
+	}
+
+	byDir := make(map[string][]*packages.Package)
+	for _, pkg := range pkgs {
+		if pkg.Module == nil {
+			continue
+		}
+		if subdir, ok := absDirs[filepath.Clean(pkg.Module.Dir)]; ok {
+			byDir[subdir] = append(byDir[subdir], pkg)
+		}
+	}
+
+	var skip []string
+	for _, subdir := range dirs {
+		if isWithinAny(subdir, skip) {
+			continue
+		}
+		err := f(subdir, byDir[subdir])
+		switch {
+		case errors.Is(err, filepath.SkipDir):
+			skip = append(skip, subdir)
+		case errors.Is(err, filepath.SkipAll):
+			return nil
+		case err != nil:
+			return errors.Wrapf(err, "in %s", subdir)
+		}
+	}
+
+	return nil
+}
+
+// writeTempGowork writes a go.work file in tmpdir that uses the modules in dirs,
+// with the given go version (if not empty).
+// It returns the path of the file
+// and a map from the absolute path of each of dirs to the dir itself.
+func writeTempGowork(tmpdir string, dirs []string, goVersion string) (string, map[string]string, error) {
+	wf := &modfile.WorkFile{Syntax: new(modfile.FileSyntax)}
+	if goVersion != "" {
+		if err := wf.AddGoStmt(goVersion); err != nil {
+			return "", nil, errors.Wrapf(err, "adding go %s to go.work", goVersion)
+		}
+	}
+
+	absDirs := make(map[string]string)
+	for _, subdir := range dirs {
+		absDir, err := filepath.Abs(subdir)
+		if err != nil {
+			return "", nil, errors.Wrapf(err, "getting absolute path of %s", subdir)
+		}
+		absDirs[absDir] = subdir
+		if err := wf.AddUse(absDir, ""); err != nil {
+			return "", nil, errors.Wrapf(err, "adding %s to go.work", absDir)
+		}
+	}
+
+	goworkPath := filepath.Join(tmpdir, "go.work")
+	if err := os.WriteFile(goworkPath, modfile.Format(wf.Syntax), 0644); err != nil {
+		return "", nil, errors.Wrapf(err, "writing %s", goworkPath)
+	}
+	return goworkPath, absDirs, nil
+}
+
+// workspaceEnv returns a copy of env suitable for use in workspace mode.
+// The go command rejects most -mod flags in workspace mode,
+// so any are removed from GOFLAGS.
+func workspaceEnv(env []string) []string {
+	result := make([]string, 0, len(env)+1)
+	for _, kv := range env {
+		if goflags, ok := strings.CutPrefix(kv, "GOFLAGS="); ok {
+			var keep []string
+			for _, flag := range strings.Fields(goflags) {
+				if !strings.HasPrefix(flag, "-mod=") && !strings.HasPrefix(flag, "--mod=") {
+					keep = append(keep, flag)
+				}
+			}
+			kv = "GOFLAGS=" + strings.Join(keep, " ")
+		}
+		result = append(result, kv)
+	}
+	return result
+}
+
+// isWithinAny tells whether path is strictly inside any of the given directories.
+func isWithinAny(path string, dirs []string) bool {
+	for _, dir := range dirs {
+		if strings.HasPrefix(path, dir+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// compareGoVersions compares two Go versions as found in go directives,
+// such as "1.21" and "1.21.0".
+// The empty string is less than any other version.
+func compareGoVersions(a, b string) int {
+	return semver.Compare("v"+a, "v"+b)
+}